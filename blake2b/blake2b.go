@@ -0,0 +1,149 @@
+// Package blake2b implements the unkeyed BLAKE2b hash function of RFC 7693
+// with a 256-bit digest.
+package blake2b
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	// Size256 is the size of a BLAKE2b-256 digest in bytes.
+	Size256 = 32
+	// BlockSize is the block size of BLAKE2b in bytes.
+	BlockSize = 128
+)
+
+var iv = [8]uint64{
+	0x6a09e667f3bcc908, 0xbb67ae8584caa73b, 0x3c6ef372fe94f82b, 0xa54ff53a5f1d36f1,
+	0x510e527fade682d1, 0x9b05688c2b3e6c1f, 0x1f83d9abfb41bd6b, 0x5be0cd19137e2179,
+}
+
+var sigma = [12][16]byte{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+	{11, 8, 12, 0, 5, 2, 15, 13, 10, 14, 3, 6, 7, 1, 9, 4},
+	{7, 9, 3, 1, 13, 12, 11, 14, 2, 6, 5, 10, 4, 0, 15, 8},
+	{9, 0, 5, 7, 2, 4, 10, 15, 14, 1, 11, 12, 6, 8, 3, 13},
+	{2, 12, 6, 10, 0, 11, 8, 3, 4, 13, 7, 5, 15, 14, 1, 9},
+	{12, 5, 1, 15, 14, 13, 4, 10, 0, 7, 6, 3, 9, 2, 8, 11},
+	{13, 11, 7, 14, 12, 1, 3, 9, 5, 0, 15, 4, 8, 6, 2, 10},
+	{6, 15, 14, 9, 11, 3, 0, 8, 12, 2, 13, 7, 1, 4, 10, 5},
+	{10, 2, 8, 4, 7, 6, 1, 5, 15, 11, 9, 14, 3, 12, 13, 0},
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{14, 10, 4, 8, 9, 15, 13, 6, 1, 12, 0, 2, 11, 7, 5, 3},
+}
+
+type digest struct {
+	h   [8]uint64
+	t   uint64
+	buf [BlockSize]byte
+	n   int
+}
+
+// New256 returns a new hash.Hash computing BLAKE2b-256.
+func New256() hash.Hash {
+	d := &digest{}
+	d.Reset()
+	return d
+}
+
+// Sum256 returns the BLAKE2b-256 digest of data.
+func Sum256(data []byte) [Size256]byte {
+	var d digest
+	d.Reset()
+	d.Write(data)
+	var sum [Size256]byte
+	d.checkSum(sum[:0])
+	return sum
+}
+
+func (d *digest) Size() int      { return Size256 }
+func (d *digest) BlockSize() int { return BlockSize }
+
+func (d *digest) Reset() {
+	d.h = iv
+	// Parameter block: digest length, no key, fanout and depth of 1.
+	d.h[0] ^= 0x01010000 | Size256
+	d.t = 0
+	d.n = 0
+}
+
+func (d *digest) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		// The last block is compressed with the final flag, so a full buffer
+		// is only compressed once more data follows it.
+		if d.n == BlockSize {
+			d.t += BlockSize
+			d.compress(d.buf[:], false)
+			d.n = 0
+		}
+		c := copy(d.buf[d.n:], p)
+		d.n += c
+		p = p[c:]
+	}
+	return written, nil
+}
+
+// Sum appends the digest to b without changing the state of the hash.
+func (d *digest) Sum(b []byte) []byte {
+	dup := *d
+	return dup.checkSum(b)
+}
+
+func (d *digest) checkSum(b []byte) []byte {
+	for i := d.n; i < BlockSize; i++ {
+		d.buf[i] = 0
+	}
+	d.t += uint64(d.n)
+	d.compress(d.buf[:], true)
+
+	var out [64]byte
+	for i, h := range d.h {
+		binary.LittleEndian.PutUint64(out[i*8:], h)
+	}
+	return append(b, out[:Size256]...)
+}
+
+func (d *digest) compress(block []byte, final bool) {
+	var m [16]uint64
+	for i := range m {
+		m[i] = binary.LittleEndian.Uint64(block[i*8:])
+	}
+	var v [16]uint64
+	copy(v[:8], d.h[:])
+	copy(v[8:], iv[:])
+	// Messages are shorter than 2^64 bytes, so the high word of the counter
+	// is always zero.
+	v[12] ^= d.t
+	if final {
+		v[14] = ^v[14]
+	}
+
+	for _, s := range sigma {
+		g(&v, 0, 4, 8, 12, m[s[0]], m[s[1]])
+		g(&v, 1, 5, 9, 13, m[s[2]], m[s[3]])
+		g(&v, 2, 6, 10, 14, m[s[4]], m[s[5]])
+		g(&v, 3, 7, 11, 15, m[s[6]], m[s[7]])
+		g(&v, 0, 5, 10, 15, m[s[8]], m[s[9]])
+		g(&v, 1, 6, 11, 12, m[s[10]], m[s[11]])
+		g(&v, 2, 7, 8, 13, m[s[12]], m[s[13]])
+		g(&v, 3, 4, 9, 14, m[s[14]], m[s[15]])
+	}
+	for i := range d.h {
+		d.h[i] ^= v[i] ^ v[i+8]
+	}
+}
+
+func g(v *[16]uint64, a, b, c, d int, x, y uint64) {
+	v[a] = v[a] + v[b] + x
+	v[d] = bits.RotateLeft64(v[d]^v[a], -32)
+	v[c] = v[c] + v[d]
+	v[b] = bits.RotateLeft64(v[b]^v[c], -24)
+	v[a] = v[a] + v[b] + y
+	v[d] = bits.RotateLeft64(v[d]^v[a], -16)
+	v[c] = v[c] + v[d]
+	v[b] = bits.RotateLeft64(v[b]^v[c], -63)
+}
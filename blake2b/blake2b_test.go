@@ -0,0 +1,71 @@
+package blake2b
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func allBytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+// Known answers of BLAKE2b-256, including inputs at and around the block size.
+var katTests = []struct {
+	in   []byte
+	want string
+}{
+	{[]byte(""), "0e5751c026e543b2e8ab2eb06099daa1d1e5df47778f7787faab45cdf12fe3a8"},
+	{[]byte("abc"), "bddd813c634239723171ef3fee98579b94964e3bb1cb3e427262c8c068d52319"},
+	{[]byte("The quick brown fox jumps over the lazy dog"), "01718cec35cd3d796dd00020e0bfecb473ad23457d063b75eff29c0ffa2e58a9"},
+	{bytes.Repeat([]byte("a"), 128), "ae2aa48507885c4c950fb809b2076f959cde9f8ea6da260d9a3587df33dac450"},
+	{bytes.Repeat([]byte("a"), 129), "2f64744a6de0d2c0b56e64cf6e29a5aaa255010d415d51c75ccc82f73dccd865"},
+	{bytes.Repeat(allBytes(256), 3), "b8007121274217790e2923e0ad7027986e5a99d5531ef6ae7d294140fc81615d"},
+}
+
+func TestKnownAnswers(t *testing.T) {
+	for _, test := range katTests {
+		h := New256()
+		h.Write(test.in)
+		if got := hex.EncodeToString(h.Sum(nil)); got != test.want {
+			t.Errorf("BLAKE2b-256 of %d bytes = %s, want %s", len(test.in), got, test.want)
+		}
+		sum := Sum256(test.in)
+		if got := hex.EncodeToString(sum[:]); got != test.want {
+			t.Errorf("Sum256 of %d bytes = %s, want %s", len(test.in), got, test.want)
+		}
+	}
+}
+
+func TestIncremental(t *testing.T) {
+	data := bytes.Repeat(allBytes(256), 3)
+	want := Sum256(data)
+
+	for _, step := range []int{1, 7, BlockSize - 1, BlockSize, BlockSize + 1, 500} {
+		h := New256()
+		for i := 0; i < len(data); i += step {
+			end := i + step
+			if end > len(data) {
+				end = len(data)
+			}
+			h.Write(data[i:end])
+		}
+		if got := h.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Errorf("step %d: got %x, want %x", step, got, want)
+		}
+		if got := h.Sum(nil); !bytes.Equal(got, want[:]) {
+			t.Errorf("step %d: second Sum returned %x", step, got)
+		}
+	}
+
+	h := New256()
+	h.Write([]byte("garbage"))
+	h.Reset()
+	if got := hex.EncodeToString(h.Sum(nil)); got != katTests[0].want {
+		t.Errorf("digest after Reset = %s, want the empty digest", got)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// codec converts keys and values between bytes and command-line arguments.
+type codec struct {
+	decode func(string) ([]byte, error)
+	encode func([]byte) string
+}
+
+var codecs = map[string]codec{
+	"utf8": {
+		decode: func(s string) ([]byte, error) { return []byte(s), nil },
+		encode: func(b []byte) string { return string(b) },
+	},
+	"hex": {
+		decode: decodeHex,
+		encode: hex.EncodeToString,
+	},
+	"base64": {
+		decode: base64.StdEncoding.DecodeString,
+		encode: base64.StdEncoding.EncodeToString,
+	},
+}
+
+// lookupCodec returns the codec with the given name.
+func lookupCodec(name string) (codec, error) {
+	c, ok := codecs[name]
+	if !ok {
+		return codec{}, fmt.Errorf("unknown encoding %q (want utf8, hex or base64)", name)
+	}
+	return c, nil
+}
+
+// decodeHex decodes a hex string, with or without a 0x prefix.
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
@@ -0,0 +1,670 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"MPT_MOI/smt-master"
+)
+
+// errInvalidProof is returned by verify for proofs that do not verify.
+var errInvalidProof = errors.New("proof is invalid")
+
+// errCheckFailed is returned by check for trees with problems.
+var errCheckFailed = errors.New("tree has problems")
+
+// errNotFound is returned by get for absent keys.
+var errNotFound = errors.New("key not found")
+
+// openStores opens the node and value stores in the store directory.
+func (c *cli) openStores() (nodes, values *dirStore, err error) {
+	if nodes, err = openDirStore(filepath.Join(c.store, "nodes")); err != nil {
+		return nil, nil, err
+	}
+	if values, err = openDirStore(filepath.Join(c.store, "values")); err != nil {
+		return nil, nil, err
+	}
+	return nodes, values, nil
+}
+
+// layoutFile is the name of the file recording the layout of a tree with its
+// values in its leaves in the store directory. Trees with their values in the
+// values store, as created by init, have no layout file.
+const layoutFile = "layout"
+
+// inlineLayout is the layout of trees created with the InlineValues option.
+const inlineLayout = "inline"
+
+// treeOptions returns the options of the layout of the tree in the store
+// directory.
+func (c *cli) treeOptions() ([]smt.Option, error) {
+	data, err := os.ReadFile(filepath.Join(c.store, layoutFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if layout := strings.TrimSpace(string(data)); layout != inlineLayout {
+		return nil, fmt.Errorf("unknown tree layout %q in %s", layout, c.store)
+	}
+	return []smt.Option{smt.InlineValues()}, nil
+}
+
+// openTree opens the tree in the store directory at its last committed root.
+func (c *cli) openTree() (*smt.SparseMerkleTree, error) {
+	nodes, values, err := c.openStores()
+	if err != nil {
+		return nil, err
+	}
+	options, err := c.treeOptions()
+	if err != nil {
+		return nil, err
+	}
+	tree, err := smt.OpenSparseMerkleTree(nodes, values, nil, options...)
+	if errors.Is(err, smt.ErrNoTreeMetadata) {
+		return nil, fmt.Errorf("no tree in %s (see smt init)", c.store)
+	}
+	return tree, err
+}
+
+// output prints v as JSON with -json, and text otherwise.
+func (c *cli) output(text string, v interface{}) error {
+	if c.json {
+		return json.NewEncoder(c.stdout).Encode(v)
+	}
+	_, err := fmt.Fprintln(c.stdout, text)
+	return err
+}
+
+// parseArgs parses the flags of a command and checks its number of arguments.
+func parseArgs(fs *flag.FlagSet, args []string, n int) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil || fs.NArg() != n {
+		return errUsage
+	}
+	return nil
+}
+
+// decodeArgs decodes keys and values with the encoding of the tool.
+func (c *cli) decodeArgs(args []string) ([][]byte, error) {
+	decoded := make([][]byte, len(args))
+	for i, arg := range args {
+		var err error
+		if decoded[i], err = c.enc.decode(arg); err != nil {
+			return nil, fmt.Errorf("argument %d: %v", i+1, err)
+		}
+	}
+	return decoded, nil
+}
+
+type rootResult struct {
+	Root    string `json:"root"`
+	Hash    string `json:"hash"`
+	Version uint64 `json:"version"`
+}
+
+func newRootResult(tree *smt.SparseMerkleTree) rootResult {
+	return rootResult{
+		Root:    hex.EncodeToString(tree.Root()),
+		Hash:    tree.HasherID().String(),
+		Version: tree.Version(),
+	}
+}
+
+func runInit(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("init", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	id, err := smt.HasherByName(c.hash)
+	if err != nil {
+		return err
+	}
+	hasher, err := id.New()
+	if err != nil {
+		return err
+	}
+	nodes, values, err := c.openStores()
+	if err != nil {
+		return err
+	}
+	if _, err := smt.ReadTreeMetadata(nodes); !errors.Is(err, smt.ErrNoTreeMetadata) {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("%s already contains a tree", c.store)
+	}
+
+	tree := smt.NewSparseMerkleTree(nodes, values, hasher, smt.PersistRoot())
+	if err := tree.CommitRoot(); err != nil {
+		return err
+	}
+	return c.output(hex.EncodeToString(tree.Root()), newRootResult(tree))
+}
+
+func runPut(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("put", flag.ContinueOnError), args, 2); err != nil {
+		return err
+	}
+	kv, err := c.decodeArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(kv[1]) == 0 {
+		return errors.New("empty values cannot be stored; use delete")
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+	if _, err := tree.Update(kv[0], kv[1]); err != nil {
+		return err
+	}
+	return c.output(hex.EncodeToString(tree.Root()), newRootResult(tree))
+}
+
+type getResult struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+func runGet(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("get", flag.ContinueOnError), args, 1); err != nil {
+		return err
+	}
+	key, err := c.decodeArgs(args)
+	if err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+	value, err := tree.Get(key[0])
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return errNotFound
+	}
+	return c.output(c.enc.encode(value), getResult{Key: args[0], Value: c.enc.encode(value)})
+}
+
+func runDelete(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("delete", flag.ContinueOnError), args, 1); err != nil {
+		return err
+	}
+	key, err := c.decodeArgs(args)
+	if err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+	if _, err := tree.Delete(key[0]); err != nil {
+		return err
+	}
+	return c.output(hex.EncodeToString(tree.Root()), newRootResult(tree))
+}
+
+func runRoot(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("root", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+	return c.output(hex.EncodeToString(tree.Root()), newRootResult(tree))
+}
+
+type proveResult struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Root    string `json:"root"`
+	Compact bool   `json:"compact"`
+	Proof   string `json:"proof"`
+}
+
+func runProve(c *cli, args []string) error {
+	fs := flag.NewFlagSet("prove", flag.ContinueOnError)
+	compact := fs.Bool("compact", false, "")
+	updatable := fs.Bool("updatable", false, "")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	if *compact && *updatable {
+		return fmt.Errorf("%w: -compact and -updatable are exclusive", errUsage)
+	}
+	key, err := c.decodeArgs(fs.Args())
+	if err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+	value, err := tree.Get(key[0])
+	if err != nil {
+		return err
+	}
+
+	var encoded []byte
+	switch {
+	case *compact:
+		proof, err := tree.ProveCompact(key[0])
+		if err != nil {
+			return err
+		}
+		encoded, err = proof.MarshalBinary()
+		if err != nil {
+			return err
+		}
+	case *updatable:
+		proof, err := tree.ProveUpdatable(key[0])
+		if err != nil {
+			return err
+		}
+		encoded, err = proof.MarshalBinary()
+		if err != nil {
+			return err
+		}
+	default:
+		proof, err := tree.Prove(key[0])
+		if err != nil {
+			return err
+		}
+		encoded, err = proof.MarshalBinary()
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.output(hex.EncodeToString(encoded), proveResult{
+		Key:     fs.Arg(0),
+		Value:   c.enc.encode(value),
+		Root:    hex.EncodeToString(tree.Root()),
+		Compact: *compact,
+		Proof:   hex.EncodeToString(encoded),
+	})
+}
+
+type verifyResult struct {
+	Valid bool `json:"valid"`
+}
+
+func runVerify(c *cli, args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	rootHex := fs.String("root", "", "")
+	if err := parseArgs(fs, args, 3); err != nil {
+		return err
+	}
+	kv, err := c.decodeArgs(fs.Args()[:2])
+	if err != nil {
+		return err
+	}
+	encoded, err := decodeHex(fs.Arg(2))
+	if err != nil {
+		return fmt.Errorf("proof: %v", err)
+	}
+
+	var root []byte
+	if *rootHex != "" {
+		if root, err = decodeHex(*rootHex); err != nil {
+			return fmt.Errorf("root: %v", err)
+		}
+	} else {
+		tree, err := c.openTree()
+		if err != nil {
+			return err
+		}
+		root = tree.Root()
+	}
+
+	var valid bool
+	var proof smt.SparseMerkleProof
+	var compactProof smt.SparseCompactMerkleProof
+	if err := proof.UnmarshalBinary(encoded); err == nil {
+		hasher, err := c.proofHasher(proof.HasherID)
+		if err != nil {
+			return err
+		}
+		valid = smt.VerifyProof(proof, root, kv[0], kv[1], hasher)
+	} else if err := compactProof.UnmarshalBinary(encoded); err == nil {
+		hasher, err := c.proofHasher(compactProof.HasherID)
+		if err != nil {
+			return err
+		}
+		valid = smt.VerifyCompactProof(compactProof, root, kv[0], kv[1], hasher)
+	} else {
+		return fmt.Errorf("proof: %v", err)
+	}
+
+	text := "valid"
+	if !valid {
+		text = "invalid"
+	}
+	if err := c.output(text, verifyResult{Valid: valid}); err != nil {
+		return err
+	}
+	if !valid {
+		return errInvalidProof
+	}
+	return nil
+}
+
+// proofHasher returns the hash function identified by a proof, or the one
+// selected with -hash for proofs of unregistered hash functions.
+func (c *cli) proofHasher(id smt.HasherID) (hash.Hash, error) {
+	if id == smt.HasherUnknown {
+		var err error
+		if id, err = smt.HasherByName(c.hash); err != nil {
+			return nil, err
+		}
+	}
+	return id.New()
+}
+
+type leafResult struct {
+	Path  string `json:"path"`
+	Value string `json:"value"`
+}
+
+type dumpResult struct {
+	Root   string       `json:"root"`
+	Leaves []leafResult `json:"leaves"`
+}
+
+func runDump(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("dump", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+
+	result := dumpResult{Root: hex.EncodeToString(tree.Root()), Leaves: []leafResult{}}
+	err = tree.IterateLeaves(func(path, value []byte) error {
+		leaf := leafResult{Path: hex.EncodeToString(path), Value: c.enc.encode(value)}
+		if c.json {
+			result.Leaves = append(result.Leaves, leaf)
+			return nil
+		}
+		return c.output(leaf.Path+" "+leaf.Value, nil)
+	})
+	if err != nil || !c.json {
+		return err
+	}
+	return c.output("", result)
+}
+
+type renderResult struct {
+	Root      string `json:"root"`
+	Format    string `json:"format"`
+	Rendering string `json:"rendering"`
+}
+
+func runRender(c *cli, args []string) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	format := fs.String("format", "ascii", "")
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return errUsage
+	}
+	if *format != "ascii" && *format != "dot" {
+		return fmt.Errorf("%w: unknown format %q (want ascii or dot)", errUsage, *format)
+	}
+	var key []byte
+	if fs.NArg() == 1 {
+		decoded, err := c.decodeArgs(fs.Args())
+		if err != nil {
+			return err
+		}
+		key = decoded[0]
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+
+	var rendering strings.Builder
+	if *format == "dot" {
+		err = tree.RenderDOT(&rendering, key)
+	} else {
+		err = tree.RenderASCII(&rendering, key)
+	}
+	if err != nil {
+		return err
+	}
+	return c.output(strings.TrimSuffix(rendering.String(), "\n"), renderResult{
+		Root:      hex.EncodeToString(tree.Root()),
+		Format:    *format,
+		Rendering: rendering.String(),
+	})
+}
+
+type problemResult struct {
+	Kind   string `json:"kind"`
+	Key    string `json:"key"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type checkResult struct {
+	Root     string          `json:"root"`
+	Nodes    int             `json:"nodes"`
+	Leaves   int             `json:"leaves"`
+	OK       bool            `json:"ok"`
+	Problems []problemResult `json:"problems"`
+}
+
+func runCheck(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("check", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+	report, err := tree.Check()
+	if err != nil {
+		return err
+	}
+
+	result := checkResult{
+		Root:     hex.EncodeToString(report.Root),
+		Nodes:    report.Nodes,
+		Leaves:   report.Leaves,
+		OK:       report.OK(),
+		Problems: []problemResult{},
+	}
+	var text strings.Builder
+	for _, problem := range report.Problems {
+		result.Problems = append(result.Problems, problemResult{
+			Kind:   problem.Kind.String(),
+			Key:    hex.EncodeToString(problem.Key),
+			Detail: problem.Detail,
+		})
+		fmt.Fprintln(&text, problem)
+	}
+	fmt.Fprintf(&text, "%d nodes, %d leaves, %d problems", report.Nodes, report.Leaves, len(report.Problems))
+	if err := c.output(text.String(), result); err != nil {
+		return err
+	}
+	if !report.OK() {
+		return errCheckFailed
+	}
+	return nil
+}
+
+func runRebuild(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("rebuild", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	if options, err := c.treeOptions(); err != nil {
+		return err
+	} else if len(options) > 0 {
+		return errors.New("the tree has its values in its leaves, without a values store to rebuild it from")
+	}
+	// The nodes are rebuilt aside, and swapped with the old ones once
+	// complete, which are moved aside until then.
+	nodesDir := filepath.Join(c.store, "nodes")
+	rebuiltDir, oldDir := nodesDir+".rebuild", nodesDir+".old"
+	if _, err := os.Stat(oldDir); err == nil {
+		return fmt.Errorf("%s was left by an interrupted rebuild; move it back to %s or remove it", oldDir, nodesDir)
+	}
+	nodes, values, err := c.openStores()
+	if err != nil {
+		return err
+	}
+	// The hash function and the version are read from the metadata if it
+	// survived.
+	id, err := smt.HasherByName(c.hash)
+	var version uint64
+	if md, mdErr := smt.ReadTreeMetadata(nodes); mdErr == nil && md.HasherID != smt.HasherUnknown {
+		id, err, version = md.HasherID, nil, md.Version
+	}
+	if err != nil {
+		return err
+	}
+	hasher, err := id.New()
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(rebuiltDir); err != nil {
+		return err
+	}
+	rebuiltNodes, err := openDirStore(rebuiltDir)
+	if err != nil {
+		return err
+	}
+	tree, err := smt.RebuildSparseMerkleTree(rebuiltNodes, values, hasher)
+	if err != nil {
+		return err
+	}
+	tree.SetVersion(version)
+	if err := tree.CommitRoot(); err != nil {
+		return err
+	}
+	if err := os.Rename(nodesDir, oldDir); err != nil {
+		return err
+	}
+	if err := os.Rename(rebuiltDir, nodesDir); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(oldDir); err != nil {
+		return err
+	}
+	return c.output(hex.EncodeToString(tree.Root()), newRootResult(tree))
+}
+
+func runMigrate(c *cli, args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	inline := fs.Bool("inline", false, "")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+	dst := *c
+	dst.store = fs.Arg(0)
+	nodes, values, err := dst.openStores()
+	if err != nil {
+		return err
+	}
+	if err := checkEmpty(nodes, values); err != nil {
+		return err
+	}
+
+	options := []smt.Option{smt.PersistRoot()}
+	if *inline {
+		// The layout is recorded first, so that the new tree is never
+		// opened with the wrong one.
+		if err := os.WriteFile(filepath.Join(dst.store, layoutFile), []byte(inlineLayout+"\n"), 0o644); err != nil {
+			return err
+		}
+		options = append(options, smt.InlineValues())
+	}
+	migrated, err := smt.MigrateSparseMerkleTree(tree, nodes, values, options...)
+	if err != nil {
+		// The stores were empty, so their partial contents are dropped.
+		for _, name := range []string{"nodes", "values", layoutFile} {
+			os.RemoveAll(filepath.Join(dst.store, name))
+		}
+		return err
+	}
+	return dst.output(hex.EncodeToString(migrated.Root()), newRootResult(migrated))
+}
+
+type statsResult struct {
+	Root                    string  `json:"root"`
+	Leaves                  int     `json:"leaves"`
+	InnerNodes              int     `json:"innerNodes"`
+	PlaceholderSiblings     int     `json:"placeholderSiblings"`
+	LeafDepths              []int   `json:"leafDepths"`
+	AvgProofLength          float64 `json:"avgProofLength"`
+	MaxProofLength          int     `json:"maxProofLength"`
+	AvgPlaceholderSideNodes float64 `json:"avgPlaceholderSideNodes"`
+	AvgCompactProofSize     float64 `json:"avgCompactProofSize"`
+	MaxCompactProofSize     int     `json:"maxCompactProofSize"`
+	NodeBytes               int     `json:"nodeBytes"`
+	ValueBytes              int     `json:"valueBytes"`
+}
+
+func runStats(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("stats", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+	stats, err := tree.Stats()
+	if err != nil {
+		return err
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "leaves                %d\n", stats.Leaves)
+	fmt.Fprintf(&text, "inner nodes           %d\n", stats.InnerNodes)
+	fmt.Fprintf(&text, "placeholder siblings  %d\n", stats.PlaceholderSiblings)
+	fmt.Fprintf(&text, "proof length          avg %.2f, max %d, avg placeholders %.2f\n", stats.AvgProofLength, stats.MaxProofLength, stats.AvgPlaceholderSideNodes)
+	fmt.Fprintf(&text, "compact proof size    avg %.1f, max %d bytes\n", stats.AvgCompactProofSize, stats.MaxCompactProofSize)
+	fmt.Fprintf(&text, "stored bytes          %d nodes, %d values\n", stats.NodeBytes, stats.ValueBytes)
+	fmt.Fprintf(&text, "leaf depths")
+	for depth, count := range stats.LeafDepths {
+		if count > 0 {
+			fmt.Fprintf(&text, "\n  %4d  %d", depth, count)
+		}
+	}
+
+	leafDepths := stats.LeafDepths
+	if leafDepths == nil {
+		leafDepths = []int{}
+	}
+	return c.output(text.String(), statsResult{
+		Root:                    hex.EncodeToString(tree.Root()),
+		Leaves:                  stats.Leaves,
+		InnerNodes:              stats.InnerNodes,
+		PlaceholderSiblings:     stats.PlaceholderSiblings,
+		LeafDepths:              leafDepths,
+		AvgProofLength:          stats.AvgProofLength,
+		MaxProofLength:          stats.MaxProofLength,
+		AvgPlaceholderSideNodes: stats.AvgPlaceholderSideNodes,
+		AvgCompactProofSize:     stats.AvgCompactProofSize,
+		MaxCompactProofSize:     stats.MaxCompactProofSize,
+		NodeBytes:               stats.NodeBytes,
+		ValueBytes:              stats.ValueBytes,
+	})
+}
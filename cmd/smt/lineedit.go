@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// errInterrupted is returned by readLine when the line is interrupted with
+// Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads lines typed on a terminal in raw mode. It supports moving
+// within the line, recalling earlier lines with the up and down arrows, and
+// completing the first word of the line with Tab.
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	// complete returns the completions of the first word of a line.
+	complete func(prefix string) []string
+}
+
+// lineState is the state of the line being edited.
+type lineState struct {
+	prompt string
+	line   []rune
+	pos    int
+}
+
+// readLine reads a line, showing the prompt. history lists the earlier lines,
+// oldest first. It returns io.EOF on Ctrl-D on an empty line, and
+// errInterrupted on Ctrl-C.
+func (le *lineEditor) readLine(prompt string, history []string) (string, error) {
+	ls := lineState{prompt: prompt}
+	// The line being typed is kept while browsing the history.
+	current, index := "", len(history)
+	le.refresh(&ls)
+
+	for {
+		r, _, err := le.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(le.out, "\n")
+			return string(ls.line), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(le.out, "^C\n")
+			return "", errInterrupted
+		case 4: // Ctrl-D
+			if len(ls.line) == 0 {
+				fmt.Fprint(le.out, "\n")
+				return "", io.EOF
+			}
+			ls.deleteAt(ls.pos)
+		case 127, 8: // Backspace
+			if ls.pos > 0 {
+				ls.pos--
+				ls.deleteAt(ls.pos)
+			}
+		case 1: // Ctrl-A
+			ls.pos = 0
+		case 5: // Ctrl-E
+			ls.pos = len(ls.line)
+		case 11: // Ctrl-K
+			ls.line = ls.line[:ls.pos]
+		case 21: // Ctrl-U
+			ls.line, ls.pos = ls.line[ls.pos:], 0
+		case '\t':
+			le.completeLine(&ls)
+		case 27: // Escape sequence
+			key, err := le.readEscape()
+			if err != nil {
+				return "", err
+			}
+			switch key {
+			case 'A', 'B':
+				if index == len(history) {
+					current = string(ls.line)
+				}
+				if key == 'A' && index > 0 {
+					index--
+				} else if key == 'B' && index < len(history) {
+					index++
+				}
+				if index == len(history) {
+					ls.set(current)
+				} else {
+					ls.set(history[index])
+				}
+			case 'C':
+				if ls.pos < len(ls.line) {
+					ls.pos++
+				}
+			case 'D':
+				if ls.pos > 0 {
+					ls.pos--
+				}
+			case 'H':
+				ls.pos = 0
+			case 'F':
+				ls.pos = len(ls.line)
+			case '~': // Delete
+				ls.deleteAt(ls.pos)
+			}
+		default:
+			if r >= ' ' {
+				ls.line = append(ls.line[:ls.pos], append([]rune{r}, ls.line[ls.pos:]...)...)
+				ls.pos++
+			}
+		}
+		le.refresh(&ls)
+	}
+}
+
+// readEscape reads the rest of an escape sequence and returns its final byte,
+// or '~' for the delete key.
+func (le *lineEditor) readEscape() (byte, error) {
+	b, err := le.in.ReadByte()
+	if err != nil || (b != '[' && b != 'O') {
+		return 0, err
+	}
+	for {
+		if b, err = le.in.ReadByte(); err != nil {
+			return 0, err
+		}
+		if b < '0' || b > '9' && b != ';' {
+			return b, nil
+		}
+	}
+}
+
+// completeLine completes the first word of the line, if the cursor is at its
+// end. With several completions, it completes their common prefix or lists
+// them.
+func (le *lineEditor) completeLine(ls *lineState) {
+	prefix := string(ls.line[:ls.pos])
+	if ls.pos != len(ls.line) || strings.ContainsRune(prefix, ' ') {
+		return
+	}
+	candidates := le.complete(prefix)
+	switch len(candidates) {
+	case 0:
+		fmt.Fprint(le.out, "\a")
+	case 1:
+		ls.set(candidates[0] + " ")
+	default:
+		common := candidates[0]
+		for _, candidate := range candidates[1:] {
+			for !strings.HasPrefix(candidate, common) {
+				common = common[:len(common)-1]
+			}
+		}
+		if len(common) > len(prefix) {
+			ls.set(common)
+		} else {
+			fmt.Fprintf(le.out, "\n%s\n", strings.Join(candidates, "  "))
+		}
+	}
+}
+
+// refresh redraws the line and places the cursor.
+func (le *lineEditor) refresh(ls *lineState) {
+	fmt.Fprintf(le.out, "\r%s%s\x1b[K", ls.prompt, string(ls.line))
+	if back := len(ls.line) - ls.pos; back > 0 {
+		fmt.Fprintf(le.out, "\x1b[%dD", back)
+	}
+}
+
+func (ls *lineState) set(line string) {
+	ls.line = []rune(line)
+	ls.pos = len(ls.line)
+}
+
+func (ls *lineState) deleteAt(pos int) {
+	if pos < len(ls.line) {
+		ls.line = append(ls.line[:pos], ls.line[pos+1:]...)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLineEditor(t *testing.T) {
+	history := []string{"get foo", "set foo bar"}
+	tests := []struct {
+		input string
+		line  string
+		err   error
+	}{
+		{"root\r", "root", nil},
+		{"rooot\x7f\x7f\x7fot\r", "root", nil},
+		// Moving the cursor and inserting.
+		{"gt foo\x01\x1b[Ce\r", "get foo", nil},
+		{"gett foo\x01\x1b[C\x1b[C\x1b[3~\r", "get foo", nil},
+		{"get fo\x1b[Do\x05x\r", "get foox", nil},
+		// Recalling the history, and going back to the typed line.
+		{"\x1b[A\r", "set foo bar", nil},
+		{"\x1b[A\x1b[A\x1b[A\r", "get foo", nil},
+		{"typed\x1b[A\x1b[B\r", "typed", nil},
+		// Completing command names.
+		{"ch\tfoo\r", "checkout foo", nil},
+		{"hi\t\r", "history ", nil},
+		{"p\t\r", "p", nil},
+		{"get ch\t\r", "get ch", nil},
+		// Killing.
+		{"set foo\x15get\r", "get", nil},
+		{"set foo\x01\x1b[C\x1b[C\x1b[C\x0b\r", "set", nil},
+		// Interrupting and leaving.
+		{"set\x03", "", errInterrupted},
+		{"\x04", "", io.EOF},
+		{"x\x01\x04\r", "", nil},
+		{"unterminated", "", io.EOF},
+	}
+	for _, test := range tests {
+		var out strings.Builder
+		le := &lineEditor{in: bufio.NewReader(strings.NewReader(test.input)), out: &out, complete: completeShellCommand}
+		line, err := le.readLine("smt> ", history)
+		if line != test.line || !errors.Is(err, test.err) {
+			t.Errorf("%q: got line %q and error %v, want %q and %v", test.input, line, err, test.line, test.err)
+		}
+		if !strings.HasPrefix(out.String(), "\rsmt> ") {
+			t.Errorf("%q: prompt not shown: %q", test.input, out.String())
+		}
+	}
+
+	// Ambiguous completions without a common prefix are listed.
+	var out strings.Builder
+	le := &lineEditor{in: bufio.NewReader(strings.NewReader("p\t\r")), out: &out, complete: completeShellCommand}
+	le.readLine("smt> ", nil)
+	if !strings.Contains(out.String(), "\npath  prove\n") {
+		t.Errorf("completions not listed: %q", out.String())
+	}
+}
@@ -0,0 +1,143 @@
+// Command smt manages a Sparse Merkle tree persisted in a store directory.
+//
+// Usage:
+//
+//	smt [flags] <command> [arguments]
+//
+// Keys and values are read and printed in the encoding selected with -enc;
+// roots, paths and proofs are always hex. With -json, every command prints a
+// single JSON object.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"MPT_MOI/smt-master"
+)
+
+// command is a subcommand of the tool.
+type command struct {
+	name  string
+	args  string
+	short string
+	run   func(c *cli, args []string) error
+}
+
+var commands []command
+
+func init() {
+	// Set in init, as the help command refers to the table.
+	commands = []command{
+		{"init", "", "create a new tree in the store directory", runInit},
+		{"put", "KEY VALUE", "set the value of a key", runPut},
+		{"get", "KEY", "print the value of a key", runGet},
+		{"delete", "KEY", "delete a key", runDelete},
+		{"root", "", "print the root of the tree", runRoot},
+		{"prove", "[-compact] [-updatable] KEY", "print a proof for a key", runProve},
+		{"verify", "[-root ROOT] KEY VALUE PROOF", "verify a proof for a key, with an empty VALUE for non-membership", runVerify},
+		{"dump", "", "print the path and value of every leaf", runDump},
+		{"import", "[-format csv|jsonl|binary] [-batch N] FILE|-", "set the keys and values of a data file", runImport},
+		{"export", "[-format csv|jsonl|binary] FILE|-", "write the path and value of every leaf to a data file", runExport},
+		{"render", "[-format ascii|dot] [KEY]", "draw the tree, or the path of a key, as text or Graphviz DOT", runRender},
+		{"stats", "", "print the shape and the costs of the tree", runStats},
+		{"check", "", "check the integrity of the stores of the tree", runCheck},
+		{"rebuild", "", "rebuild the nodes of the tree from its values, with -hash if its metadata is lost", runRebuild},
+		{"migrate", "[-inline] DIR", "copy the tree into a new store directory, with its values in its leaves with -inline", runMigrate},
+		{"snapshot", "FILE|-", "write a snapshot of the tree", runSnapshot},
+		{"restore", "FILE|-", "create the tree of a snapshot in an empty store directory", runRestore},
+		{"shell", "", "explore and edit the tree in an interactive shell, saving the changes on exit", runShell},
+	}
+}
+
+// errUsage is returned by commands called with invalid arguments.
+var errUsage = errors.New("invalid arguments")
+
+// cli holds the global flags and the output of the tool.
+type cli struct {
+	store   string
+	hash    string
+	enc     codec
+	encName string
+	json    bool
+	stdin   io.Reader
+	stdout  io.Writer
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the tool with the given arguments and returns its exit status: 0 on
+// success, 1 on failure and 2 on invalid arguments.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := cli{stdin: stdin, stdout: stdout}
+	fs := flag.NewFlagSet("smt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&c.store, "store", ".smt", "store `directory` of the tree")
+	fs.StringVar(&c.hash, "hash", "sha256", "hash `function` of new trees: "+hasherNames())
+	encoding := fs.String("enc", "utf8", "`encoding` of keys and values: utf8, hex or base64")
+	fs.BoolVar(&c.json, "json", false, "print results as JSON")
+	fs.Usage = func() { usage(fs) }
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	var err error
+	c.encName = *encoding
+	if c.enc, err = lookupCodec(*encoding); err != nil {
+		fmt.Fprintf(stderr, "smt: %v\n", err)
+		return 2
+	}
+	if fs.NArg() == 0 {
+		usage(fs)
+		return 2
+	}
+	cmd := lookupCommand(fs.Arg(0))
+	if cmd == nil {
+		fmt.Fprintf(stderr, "smt: unknown command %q\n", fs.Arg(0))
+		usage(fs)
+		return 2
+	}
+
+	if err := cmd.run(&c, fs.Args()[1:]); err != nil {
+		fmt.Fprintf(stderr, "smt %s: %v\n", cmd.name, err)
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, "usage: smt %s %s\n", cmd.name, cmd.args)
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+func lookupCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	fmt.Fprintf(w, "usage: smt [flags] <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-8s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(w, "\nflags:\n")
+	fs.PrintDefaults()
+}
+
+func hasherNames() string {
+	var names []string
+	for _, id := range smt.RegisteredHashers() {
+		names = append(names, id.String())
+	}
+	return strings.Join(names, ", ")
+}
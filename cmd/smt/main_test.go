@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runTool runs the tool on a store directory and returns its exit status and
+// output.
+func runTool(t *testing.T, store string, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	status := run(append([]string{"-store", store}, args...), nil, &stdout, &stderr)
+	return status, strings.TrimSpace(stdout.String() + stderr.String())
+}
+
+func TestCommands(t *testing.T) {
+	store := t.TempDir()
+
+	if status, out := runTool(t, store, "get", "foo"); status != 1 || !strings.Contains(out, "no tree") {
+		t.Errorf("get before init: got status %d, output %q", status, out)
+	}
+	if status, out := runTool(t, store, "-hash", "keccak-256", "init"); status != 0 {
+		t.Fatalf("init: got status %d, output %q", status, out)
+	}
+	if status, _ := runTool(t, store, "init"); status != 1 {
+		t.Errorf("second init: got status %d, want 1", status)
+	}
+
+	runTool(t, store, "put", "foo", "bar")
+	runTool(t, store, "-enc", "hex", "put", "0x6b6579", "76616c7565")
+	status, root := runTool(t, store, "put", "baz", "qux")
+	if status != 0 {
+		t.Fatalf("put: got status %d, output %q", status, root)
+	}
+	if _, out := runTool(t, store, "root"); out != root {
+		t.Errorf("got root %q, want %q", out, root)
+	}
+
+	tests := []struct {
+		args []string
+		out  string
+	}{
+		{[]string{"get", "foo"}, "bar"},
+		{[]string{"get", "key"}, "value"},
+		{[]string{"-enc", "base64", "get", "Zm9v"}, "YmFy"},
+		{[]string{"-json", "get", "foo"}, `{"key":"foo","value":"bar"}`},
+		{[]string{"-json", "root"}, `{"root":"` + root + `","hash":"keccak-256","version":4}`},
+	}
+	for _, test := range tests {
+		if status, out := runTool(t, store, test.args...); status != 0 || out != test.out {
+			t.Errorf("%v: got status %d, output %q, want %q", test.args, status, out, test.out)
+		}
+	}
+	if status, _ := runTool(t, store, "get", "absent"); status != 1 {
+		t.Errorf("get absent key: got status %d, want 1", status)
+	}
+
+	// Proofs of membership and non-membership, full and compact.
+	for _, flags := range [][]string{nil, {"-compact"}, {"-updatable"}} {
+		_, proof := runTool(t, store, append(append([]string{"prove"}, flags...), "foo")...)
+		if status, out := runTool(t, store, "verify", "foo", "bar", proof); status != 0 || out != "valid" {
+			t.Errorf("verify %v proof: got status %d, output %q", flags, status, out)
+		}
+		if status, out := runTool(t, store, "verify", "foo", "wrong", proof); status != 1 || !strings.HasPrefix(out, "invalid") {
+			t.Errorf("verify %v proof of wrong value: got status %d, output %q", flags, status, out)
+		}
+		_, proof = runTool(t, store, append(append([]string{"prove"}, flags...), "absent")...)
+		if status, out := runTool(t, t.TempDir(), "verify", "-root", root, "absent", "", proof); status != 0 || out != "valid" {
+			t.Errorf("verify %v non-membership proof without store: got status %d, output %q", flags, status, out)
+		}
+	}
+	var proved proveResult
+	_, out := runTool(t, store, "-json", "prove", "foo")
+	if err := json.Unmarshal([]byte(out), &proved); err != nil || proved.Value != "bar" || proved.Root != root {
+		t.Errorf("got JSON proof %q: %v", out, err)
+	}
+
+	var dump dumpResult
+	_, out = runTool(t, store, "-json", "dump")
+	if err := json.Unmarshal([]byte(out), &dump); err != nil || len(dump.Leaves) != 3 || dump.Root != root {
+		t.Errorf("got JSON dump %q: %v", out, err)
+	}
+	if _, out := runTool(t, store, "dump"); len(strings.Split(out, "\n")) != 3 {
+		t.Errorf("got dump %q, want 3 leaves", out)
+	}
+
+	runTool(t, store, "delete", "baz")
+	if status, _ := runTool(t, store, "get", "baz"); status != 1 {
+		t.Errorf("get deleted key: got status %d, want 1", status)
+	}
+	if _, out := runTool(t, store, "root"); out == root {
+		t.Error("root did not change after delete")
+	}
+}
+
+func TestUsage(t *testing.T) {
+	store := t.TempDir()
+	for _, args := range [][]string{
+		nil,
+		{"unknown"},
+		{"-enc", "latin1", "root"},
+		{"put", "foo"},
+		{"prove", "-compact", "-updatable", "foo"},
+		{"verify", "foo", "bar"},
+		{"import", "-format", "xml", "-"},
+		{"export"},
+		{"render", "-format", "svg"},
+		{"render", "foo", "bar"},
+	} {
+		if status, _ := runTool(t, store, args...); status != 2 {
+			t.Errorf("%v: got status %d, want 2", args, status)
+		}
+	}
+	if status, _ := runTool(t, store, "-hash", "md5", "init"); status != 1 {
+		t.Errorf("init with unknown hash function: got status %d, want 1", status)
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "data.jsonl")
+	if err := os.WriteFile(data, []byte(`{"key":"foo","value":"bar"}`+"\n"+`{"key":"baz","value":"qux"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := t.TempDir()
+	runTool(t, store, "init")
+	status, out := runTool(t, store, "import", "-format", "jsonl", data)
+	if status != 0 || !strings.HasSuffix(out, "(2 records)") {
+		t.Fatalf("import: got status %d and output %q", status, out)
+	}
+	if _, value := runTool(t, store, "get", "baz"); value != "qux" {
+		t.Errorf("got value %q after import, want qux", value)
+	}
+
+	expected := t.TempDir()
+	runTool(t, expected, "init")
+	runTool(t, expected, "put", "foo", "bar")
+	_, root := runTool(t, expected, "put", "baz", "qux")
+	if _, out := runTool(t, store, "root"); out != root {
+		t.Errorf("got root %s after import, want %s", out, root)
+	}
+
+	exported := filepath.Join(dir, "export.bin")
+	if status, out := runTool(t, store, "-json", "export", "-format", "binary", exported); status != 0 || !strings.Contains(out, `"records":2`) {
+		t.Errorf("export: got status %d and output %q", status, out)
+	}
+	_, dump := runTool(t, store, "-enc", "hex", "dump")
+	_, csv := runTool(t, store, "-enc", "hex", "export", "-")
+	if want := "path,value\n" + strings.ReplaceAll(dump, " ", ","); csv != want {
+		t.Errorf("got export %q, want %q", csv, want)
+	}
+	// Paths are hex whatever the encoding of values.
+	if _, text := runTool(t, store, "export", "-"); !strings.Contains(text, "\n"+strings.Fields(dump)[0]+",") {
+		t.Errorf("got export %q without hex paths", text)
+	}
+
+	// Exported paths are not imported as keys into a new tree.
+	fresh := t.TempDir()
+	runTool(t, fresh, "init")
+	if status, out := runTool(t, fresh, "import", "-format", "binary", exported); status != 1 || !strings.Contains(out, "paths") {
+		t.Errorf("import of an export: got status %d and output %q, want 1 and an error", status, out)
+	}
+}
+
+func TestRender(t *testing.T) {
+	store := t.TempDir()
+	runTool(t, store, "init")
+	if status, out := runTool(t, store, "render"); status != 0 || out != "empty" {
+		t.Errorf("got status %d and rendering %q of an empty tree", status, out)
+	}
+	runTool(t, store, "put", "foo", "bar")
+	_, root := runTool(t, store, "put", "baz", "qux")
+
+	status, out := runTool(t, store, "render")
+	if lines := strings.Split(out, "\n"); status != 0 || len(lines) < 3 || lines[0] != "node "+root[:8]+".." {
+		t.Errorf("got status %d and rendering\n%s", status, out)
+	}
+	if strings.Count(out, "leaf ") != 2 {
+		t.Errorf("got rendering without both leaves\n%s", out)
+	}
+	if status, out := runTool(t, store, "render", "-format", "dot", "foo"); status != 0 || !strings.HasPrefix(out, "digraph smt {") {
+		t.Errorf("got status %d and DOT rendering\n%s", status, out)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	store := t.TempDir()
+	runTool(t, store, "init")
+	runTool(t, store, "put", "foo", "bar")
+	runTool(t, store, "put", "baz", "qux")
+	if status, out := runTool(t, store, "check"); status != 0 || out != "3 nodes, 2 leaves, 0 problems" {
+		t.Errorf("got status %d and output %q for a sound tree", status, out)
+	}
+
+	// Corrupt the value of a leaf.
+	_, dump := runTool(t, store, "-enc", "hex", "dump")
+	path := strings.Fields(dump)[0]
+	if err := os.WriteFile(filepath.Join(store, "values", path), []byte("corrupt"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	status, out := runTool(t, store, "check")
+	if status != 1 || !strings.HasPrefix(out, "value mismatch "+path) || !strings.Contains(out, "1 problems") {
+		t.Errorf("got status %d and output %q for a corrupt value", status, out)
+	}
+	_, out = runTool(t, store, "-json", "check")
+	if !strings.Contains(out, `"ok":false`) || !strings.Contains(out, `"kind":"value mismatch"`) {
+		t.Errorf("got JSON output %q for a corrupt value", out)
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	store := t.TempDir()
+	runTool(t, store, "-hash", "keccak-256", "init")
+	runTool(t, store, "put", "foo", "bar")
+	_, root := runTool(t, store, "put", "baz", "qux")
+
+	if status, out := runTool(t, store, "rebuild"); status != 0 || out != root {
+		t.Errorf("got status %d and root %q after rebuilding a sound tree, want %s", status, out, root)
+	}
+	// The rebuild is a commit after the three before.
+	if _, out := runTool(t, store, "-json", "root"); !strings.HasSuffix(out, `"version":4}`) {
+		t.Errorf("got %s after rebuilding, want version 4", out)
+	}
+	if _, err := os.Stat(filepath.Join(store, "nodes.old")); !os.IsNotExist(err) {
+		t.Errorf("old nodes were not removed: %v", err)
+	}
+	// Without the metadata, the hash function is given with -hash.
+	if err := os.RemoveAll(filepath.Join(store, "nodes")); err != nil {
+		t.Fatal(err)
+	}
+	if status, out := runTool(t, store, "-hash", "keccak-256", "rebuild"); status != 0 || out != root {
+		t.Errorf("got status %d and root %q after rebuilding lost nodes, want %s", status, out, root)
+	}
+	if status, out := runTool(t, store, "check"); status != 0 {
+		t.Errorf("got status %d and output %q from check after rebuild", status, out)
+	}
+	if _, value := runTool(t, store, "get", "foo"); value != "bar" {
+		t.Errorf("got value %q after rebuild, want bar", value)
+	}
+
+	// The old nodes of an interrupted rebuild are not overwritten.
+	if err := os.Rename(filepath.Join(store, "nodes"), filepath.Join(store, "nodes.old")); err != nil {
+		t.Fatal(err)
+	}
+	if status, out := runTool(t, store, "rebuild"); status != 1 || !strings.Contains(out, "interrupted") {
+		t.Errorf("got status %d and output %q after an interrupted rebuild", status, out)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	store, inline, separate := t.TempDir(), t.TempDir(), t.TempDir()
+	runTool(t, store, "init")
+	runTool(t, store, "put", "foo", "bar")
+	_, root := runTool(t, store, "put", "baz", "qux")
+
+	status, inlineRoot := runTool(t, store, "migrate", "-inline", inline)
+	if status != 0 || inlineRoot == root {
+		t.Fatalf("got status %d and root %q after migrating to inline values", status, inlineRoot)
+	}
+	if _, out := runTool(t, inline, "root"); out != inlineRoot {
+		t.Errorf("got root %q for the migrated tree, want %s", out, inlineRoot)
+	}
+	if _, value := runTool(t, inline, "get", "foo"); value != "bar" {
+		t.Errorf("got value %q from the migrated tree, want bar", value)
+	}
+	if status, out := runTool(t, inline, "check"); status != 0 {
+		t.Errorf("got status %d and output %q from check after migration", status, out)
+	}
+	if status, _ := runTool(t, inline, "rebuild"); status != 1 {
+		t.Errorf("got status %d when rebuilding a tree with inline values, want 1", status)
+	}
+
+	// Snapshots of the migrated tree are restored with its layout.
+	snapshot, restored := filepath.Join(t.TempDir(), "tree.snap"), t.TempDir()
+	runTool(t, inline, "snapshot", snapshot)
+	if status, out := runTool(t, restored, "restore", snapshot); status != 0 || out != inlineRoot {
+		t.Errorf("got status %d and root %q after restoring the migrated tree, want %s", status, out, inlineRoot)
+	}
+	if _, value := runTool(t, restored, "get", "foo"); value != "bar" {
+		t.Errorf("got value %q from the restored tree, want bar", value)
+	}
+
+	// Migrating back gives the original tree.
+	if status, out := runTool(t, inline, "migrate", separate); status != 0 || out != root {
+		t.Errorf("got status %d and root %q after migrating back, want %s", status, out, root)
+	}
+	if status, _ := runTool(t, store, "migrate", separate); status != 1 {
+		t.Errorf("got status %d when migrating into a store with a tree, want 1", status)
+	}
+}
+
+func TestStats(t *testing.T) {
+	store := t.TempDir()
+	runTool(t, store, "init")
+	runTool(t, store, "put", "foo", "bar")
+	runTool(t, store, "put", "baz", "qux")
+
+	status, out := runTool(t, store, "stats")
+	if status != 0 || !strings.HasPrefix(out, "leaves                2\n") || !strings.Contains(out, "stored bytes          ") {
+		t.Errorf("got status %d and output\n%s", status, out)
+	}
+	var stats statsResult
+	_, out = runTool(t, store, "-json", "stats")
+	if err := json.Unmarshal([]byte(out), &stats); err != nil {
+		t.Fatalf("got invalid JSON output %q: %v", out, err)
+	}
+	if stats.Leaves != 2 || stats.InnerNodes < 1 || stats.MaxProofLength < 1 || stats.ValueBytes != 2*(32+3) {
+		t.Errorf("got stats %+v", stats)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	store := t.TempDir()
+	runTool(t, store, "-hash", "sha512/256", "init")
+	runTool(t, store, "put", "foo", "bar")
+	_, root := runTool(t, store, "put", "baz", "qux")
+
+	snapshot := filepath.Join(t.TempDir(), "tree.snap")
+	if status, out := runTool(t, store, "snapshot", snapshot); status != 0 || out != root {
+		t.Fatalf("snapshot: got status %d and output %q", status, out)
+	}
+	restored := t.TempDir()
+	if status, out := runTool(t, restored, "restore", snapshot); status != 0 || out != root {
+		t.Errorf("restore: got status %d and output %q, want root %s", status, out, root)
+	}
+	if _, value := runTool(t, restored, "get", "baz"); value != "qux" {
+		t.Errorf("got value %q after restore, want qux", value)
+	}
+	if status, out := runTool(t, restored, "restore", snapshot); status != 1 || !strings.Contains(out, "not empty") {
+		t.Errorf("restore into a tree: got status %d and output %q", status, out)
+	}
+
+	// Corrupt snapshots are refused, and leave the store empty.
+	data, err := os.ReadFile(snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(snapshot, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	restored = t.TempDir()
+	if status, out := runTool(t, restored, "restore", snapshot); status != 1 || !strings.Contains(out, "checksum mismatch") {
+		t.Errorf("restore of a corrupt snapshot: got status %d and output %q", status, out)
+	}
+	if status, _ := runTool(t, restored, "root"); status != 1 {
+		t.Error("corrupt snapshot restored")
+	}
+}
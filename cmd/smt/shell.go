@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"MPT_MOI/smt-master"
+)
+
+// shellCommand is a command of the interactive shell.
+type shellCommand struct {
+	name  string
+	args  string
+	short string
+	run   func(sh *shell, args []string) error
+}
+
+var shellCommands []shellCommand
+
+func init() {
+	// Set in init, as the help command refers to the table.
+	shellCommands = []shellCommand{
+		{"set", "KEY VALUE", "set the value of a key", (*shell).runSet},
+		{"get", "KEY", "print the value of a key", (*shell).runGet},
+		{"delete", "KEY", "delete a key", (*shell).runDelete},
+		{"root", "", "print the current root", (*shell).runRoot},
+		{"path", "KEY", "print the path of a key and its side nodes", (*shell).runPath},
+		{"prove", "[-compact] KEY", "print a proof for a key", (*shell).runProve},
+		{"verify", "KEY VALUE PROOF", "verify a proof against the current root", (*shell).runVerify},
+		{"roots", "", "list the roots of the session", (*shell).runRoots},
+		{"checkout", "N|ROOT", "switch to the Nth root of the session, or to a root by a prefix of 8 or more hex digits", (*shell).runCheckout},
+		{"undo", "", "undo the last operation", (*shell).runUndo},
+		{"history", "", "list the commands of the session", (*shell).runHistory},
+		{"help", "", "list the commands", (*shell).runHelp},
+		{"exit", "", "leave the shell", nil},
+	}
+}
+
+// shellOp is an update made in the shell, which can be undone by setting the
+// key back to its old value. As the root of a tree only depends on its
+// contents, this restores the root before the update.
+type shellOp struct {
+	key, oldValue, newValue []byte
+}
+
+// shell is an interactive session on a tree. The session works on in-memory
+// overlays of the stores, and its changes are written to the store in a single
+// commit when the shell exits. It keeps the updates of the session, so that it
+// can move between the roots they produced by replaying them on the overlays,
+// without touching the store.
+type shell struct {
+	c    *cli
+	tree *smt.SparseMerkleTree
+	out  io.Writer
+
+	// ops are the updates of the session, of which the first pos are applied.
+	// roots[i] is the root after the first i updates.
+	ops   []shellOp
+	pos   int
+	roots [][]byte
+
+	lines []string
+}
+
+func runShell(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("shell", flag.ContinueOnError), args, 0); err != nil {
+		return err
+	}
+	stored, err := c.openTree()
+	if err != nil {
+		return err
+	}
+	hasher, err := stored.HasherID().New()
+	if err != nil {
+		return err
+	}
+	options, err := c.treeOptions()
+	if err != nil {
+		return err
+	}
+	nodes, values, err := c.openStores()
+	if err != nil {
+		return err
+	}
+	tree := smt.ImportSparseMerkleTree(smt.NewOverlayMapStore(nodes), smt.NewOverlayMapStore(values), hasher, stored.Root(), options...)
+	sh := &shell{c: c, tree: tree, out: c.stdout, roots: [][]byte{tree.Root()}}
+
+	readLine := sh.plainReader(c.stdin)
+	if f, ok := c.stdin.(*os.File); ok {
+		if restore, err := makeRaw(int(f.Fd())); err == nil {
+			restore()
+			readLine = sh.terminalReader(f)
+		}
+	}
+
+	for {
+		line, err := readLine()
+		if errors.Is(err, errInterrupted) {
+			continue
+		} else if err == io.EOF {
+			return sh.save()
+		} else if err != nil {
+			return err
+		}
+		fields, err := splitArgs(line)
+		if err == nil && len(fields) == 0 {
+			continue
+		}
+		sh.lines = append(sh.lines, line)
+		if err != nil {
+			fmt.Fprintf(sh.out, "error: %v\n", err)
+			continue
+		}
+		if fields[0] == "exit" || fields[0] == "quit" {
+			return sh.save()
+		}
+		if err := sh.exec(fields); err != nil {
+			fmt.Fprintf(sh.out, "error: %v\n", err)
+		}
+	}
+}
+
+// splitArgs splits a line into arguments separated by spaces. As in a POSIX
+// shell, single quotes keep their contents as is, a backslash outside them
+// escapes the next character, and double quotes keep spaces in arguments.
+// Quotes with nothing in them stand for an empty argument.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg, escaped := false, false
+	var quote rune
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote == '"':
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, errors.New("trailing backslash")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// save writes the changes of the session up to the current root to the store
+// as a single commit, unless the session changed nothing. The store must still
+// be at the root the session started from.
+func (sh *shell) save() error {
+	var keys, values [][]byte
+	first, last := make(map[string]int), make(map[string]int)
+	for i, op := range sh.ops[:sh.pos] {
+		if _, ok := first[string(op.key)]; !ok {
+			first[string(op.key)] = i
+			keys = append(keys, op.key)
+		}
+		last[string(op.key)] = i
+	}
+	changed := keys[:0]
+	for _, key := range keys {
+		oldValue, newValue := sh.ops[first[string(key)]].oldValue, sh.ops[last[string(key)]].newValue
+		if !bytes.Equal(oldValue, newValue) {
+			changed = append(changed, key)
+			values = append(values, newValue)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	stored, err := sh.c.openTree()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stored.Root(), sh.roots[0]) {
+		return errors.New("the tree was modified outside the shell; the session was not saved")
+	}
+	root, err := stored.UpdateBatch(changed, values)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(root, sh.tree.Root()) {
+		return fmt.Errorf("saved root %x, want %x", root, sh.tree.Root())
+	}
+	return nil
+}
+
+// plainReader returns a function reading lines from a reader that is not a
+// terminal, without a prompt.
+func (sh *shell) plainReader(in io.Reader) func() (string, error) {
+	scanner := bufio.NewScanner(in)
+	return func() (string, error) {
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return "", err
+			}
+			return "", io.EOF
+		}
+		return scanner.Text(), nil
+	}
+}
+
+// terminalReader returns a function reading lines from a terminal with a line
+// editor, which puts the terminal in raw mode while a line is typed.
+func (sh *shell) terminalReader(f *os.File) func() (string, error) {
+	le := &lineEditor{in: bufio.NewReader(f), out: sh.out, complete: completeShellCommand}
+	return func() (string, error) {
+		restore, err := makeRaw(int(f.Fd()))
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+		return le.readLine("smt> ", sh.lines)
+	}
+}
+
+// completeShellCommand returns the names of the shell commands starting with
+// prefix.
+func completeShellCommand(prefix string) []string {
+	var names []string
+	for _, cmd := range shellCommands {
+		if strings.HasPrefix(cmd.name, prefix) {
+			names = append(names, cmd.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (sh *shell) exec(fields []string) error {
+	for _, cmd := range shellCommands {
+		if cmd.name == fields[0] && cmd.run != nil {
+			err := cmd.run(sh, fields[1:])
+			if errors.Is(err, errUsage) {
+				return fmt.Errorf("usage: %s %s", cmd.name, cmd.args)
+			}
+			return err
+		}
+	}
+	return fmt.Errorf("unknown command %q (see help)", fields[0])
+}
+
+// decodeArgs checks the number of arguments of a command and decodes them
+// with the encoding of the tool.
+func (sh *shell) decodeArgs(args []string, n int) ([][]byte, error) {
+	if len(args) != n {
+		return nil, errUsage
+	}
+	return sh.c.decodeArgs(args)
+}
+
+// apply updates a key, and records the update unless it changes nothing. Any
+// updates undone before are forgotten.
+func (sh *shell) apply(key, value []byte) error {
+	oldValue, err := sh.tree.Get(key)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(oldValue, value) {
+		return nil
+	}
+	if _, err := sh.tree.Update(key, value); err != nil {
+		return err
+	}
+	sh.ops = append(sh.ops[:sh.pos], shellOp{key: key, oldValue: oldValue, newValue: value})
+	sh.roots = append(sh.roots[:sh.pos+1], sh.tree.Root())
+	sh.pos++
+	return nil
+}
+
+func (sh *shell) runSet(args []string) error {
+	kv, err := sh.decodeArgs(args, 2)
+	if err != nil {
+		return err
+	}
+	if len(kv[1]) == 0 {
+		return errors.New("empty values cannot be stored; use delete")
+	}
+	if err := sh.apply(kv[0], kv[1]); err != nil {
+		return err
+	}
+	return sh.runRoot(nil)
+}
+
+func (sh *shell) runGet(args []string) error {
+	key, err := sh.decodeArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	value, err := sh.tree.Get(key[0])
+	if err != nil {
+		return err
+	}
+	if len(value) == 0 {
+		return errNotFound
+	}
+	fmt.Fprintln(sh.out, sh.c.enc.encode(value))
+	return nil
+}
+
+func (sh *shell) runDelete(args []string) error {
+	key, err := sh.decodeArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	if err := sh.apply(key[0], nil); err != nil {
+		return err
+	}
+	return sh.runRoot(nil)
+}
+
+func (sh *shell) runRoot(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	fmt.Fprintf(sh.out, "%x (%d)\n", sh.tree.Root(), sh.pos)
+	return nil
+}
+
+func (sh *shell) runPath(args []string) error {
+	key, err := sh.decodeArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	path, sideNodes, leafHash, leafData, err := sh.tree.SideNodesForRoot(key[0], sh.tree.Root())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sh.out, "path %x\n", path)
+	// Side nodes are listed from the root down.
+	placeholder := make([]byte, len(leafHash))
+	for i := len(sideNodes) - 1; i >= 0; i-- {
+		depth := len(sideNodes) - 1 - i
+		side := "right"
+		if path[depth/8]&(1<<(7-depth%8)) != 0 {
+			side = "left"
+		}
+		if bytes.Equal(sideNodes[i], placeholder) {
+			fmt.Fprintf(sh.out, "%4d %-5s placeholder\n", depth, side)
+		} else {
+			fmt.Fprintf(sh.out, "%4d %-5s %x\n", depth, side, sideNodes[i])
+		}
+	}
+	switch {
+	case leafData == nil:
+		fmt.Fprintf(sh.out, "leaf placeholder\n")
+	default:
+		fmt.Fprintf(sh.out, "leaf %x\n", leafHash)
+		fmt.Fprintf(sh.out, "data %x\n", leafData)
+	}
+	return nil
+}
+
+func (sh *shell) runProve(args []string) error {
+	compact := len(args) > 0 && args[0] == "-compact"
+	if compact {
+		args = args[1:]
+	}
+	key, err := sh.decodeArgs(args, 1)
+	if err != nil {
+		return err
+	}
+	var encoded []byte
+	if compact {
+		proof, err := sh.tree.ProveCompact(key[0])
+		if err != nil {
+			return err
+		}
+		if encoded, err = proof.MarshalBinary(); err != nil {
+			return err
+		}
+	} else {
+		proof, err := sh.tree.Prove(key[0])
+		if err != nil {
+			return err
+		}
+		if encoded, err = proof.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(sh.out, hex.EncodeToString(encoded))
+	return nil
+}
+
+func (sh *shell) runVerify(args []string) error {
+	if len(args) != 3 {
+		return errUsage
+	}
+	var out bytes.Buffer
+	c := *sh.c
+	c.stdout = &out
+	err := runVerify(&c, []string{"-root", hex.EncodeToString(sh.tree.Root()), args[0], args[1], args[2]})
+	if errors.Is(err, errInvalidProof) {
+		err = nil
+	}
+	sh.out.Write(out.Bytes())
+	return err
+}
+
+func (sh *shell) runRoots(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	for i, root := range sh.roots {
+		marker := " "
+		if i == sh.pos {
+			marker = "*"
+		}
+		fmt.Fprintf(sh.out, "%s %3d %x\n", marker, i, root)
+	}
+	return nil
+}
+
+func (sh *shell) runCheckout(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	target := -1
+	prefix := strings.TrimPrefix(args[0], "0x")
+	if n, err := strconv.Atoi(args[0]); err == nil && len(args[0]) < 8 {
+		target = n
+	} else if len(prefix) >= 8 {
+		for i, root := range sh.roots {
+			if strings.HasPrefix(hex.EncodeToString(root), prefix) {
+				if target >= 0 && !bytes.Equal(root, sh.roots[target]) {
+					return fmt.Errorf("ambiguous root %s", args[0])
+				}
+				target = i
+			}
+		}
+	}
+	if target < 0 || target >= len(sh.roots) {
+		return fmt.Errorf("no root %s in the session (see roots)", args[0])
+	}
+	if err := sh.moveTo(target); err != nil {
+		return err
+	}
+	return sh.runRoot(nil)
+}
+
+// moveTo undoes or redoes the updates of the session up to the nth, on the
+// overlays of the stores.
+func (sh *shell) moveTo(n int) error {
+	for sh.pos > n {
+		op := sh.ops[sh.pos-1]
+		if _, err := sh.tree.Update(op.key, op.oldValue); err != nil {
+			return err
+		}
+		sh.pos--
+	}
+	for sh.pos < n {
+		op := sh.ops[sh.pos]
+		if _, err := sh.tree.Update(op.key, op.newValue); err != nil {
+			return err
+		}
+		sh.pos++
+	}
+	if !bytes.Equal(sh.tree.Root(), sh.roots[sh.pos]) {
+		return fmt.Errorf("got root %x, want %x", sh.tree.Root(), sh.roots[sh.pos])
+	}
+	return nil
+}
+
+func (sh *shell) runUndo(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	if sh.pos == 0 {
+		return errors.New("nothing to undo")
+	}
+	if err := sh.moveTo(sh.pos - 1); err != nil {
+		return err
+	}
+	return sh.runRoot(nil)
+}
+
+func (sh *shell) runHistory(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	for i, line := range sh.lines {
+		fmt.Fprintf(sh.out, "%4d  %s\n", i+1, line)
+	}
+	return nil
+}
+
+func (sh *shell) runHelp(args []string) error {
+	for _, cmd := range shellCommands {
+		fmt.Fprintf(sh.out, "  %-22s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.short)
+	}
+	return nil
+}
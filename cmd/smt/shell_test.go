@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// runShellScript runs the shell on a new tree with the given input, and
+// returns its output.
+func runShellScript(t *testing.T, script string) string {
+	t.Helper()
+	store := t.TempDir()
+	if status, out := runTool(t, store, "init"); status != 0 {
+		t.Fatalf("init: got status %d, output %q", status, out)
+	}
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"-store", store, "shell"}, strings.NewReader(script), &stdout, &stderr); status != 0 {
+		t.Fatalf("shell: got status %d, output %q", status, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestShell(t *testing.T) {
+	out := runShellScript(t, strings.Join([]string{
+		"set foo bar",
+		"set baz qux",
+		"get foo",
+		"delete baz",
+		"get baz",
+		"roots",
+		"undo",
+		"get baz",
+		"checkout 1",
+		"get baz",
+		"checkout 3",
+		"get baz",
+		"set foo new",
+		"roots",
+		"bogus",
+		"set foo",
+		"history",
+		"exit",
+		"get foo",
+	}, "\n"))
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+
+	// The roots printed by set, delete, undo and checkout, with the number
+	// of updates applied, and the other output of the commands.
+	var roots, results []string
+	for _, line := range lines {
+		if fields := strings.Fields(line); len(fields) == 2 && len(fields[0]) == 64 {
+			roots = append(roots, line)
+		} else if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "*") {
+			results = append(results, line)
+		}
+	}
+	if len(roots) != 7 {
+		t.Fatalf("got roots %q", roots)
+	}
+	// Moving between roots restores them, and the values of the keys.
+	if roots[2] != strings.Replace(roots[0], "(1)", "(3)", 1) || roots[3] != roots[1] || roots[5] != roots[2] {
+		t.Errorf("got roots %q", roots)
+	}
+	wantResults := []string{
+		"bar",
+		"error: key not found",
+		"qux",
+		"error: key not found",
+		"error: key not found",
+		`error: unknown command "bogus" (see help)`,
+		"error: usage: set KEY VALUE",
+	}
+	if strings.Join(results, "\n") != strings.Join(wantResults, "\n") {
+		t.Errorf("got results %q, want %q", results, wantResults)
+	}
+
+	// Setting a key after moving back forgets the later updates.
+	if !strings.Contains(out, "*   4 ") || strings.Contains(out, "    5 ") {
+		t.Errorf("roots were not truncated:\n%s", out)
+	}
+	if !strings.HasSuffix(out, "  17  history\n") {
+		t.Errorf("history is missing, or commands after exit were run:\n%s", out)
+	}
+}
+
+func TestShellPathAndProofs(t *testing.T) {
+	out := runShellScript(t, "set foo bar\nset baz qux\npath foo\npath absent\n")
+	if !strings.Contains(out, "path 2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae") {
+		t.Errorf("output has no path for foo:\n%s", out)
+	}
+	if !strings.Contains(out, "   0 ") || !strings.Contains(out, "data 00") {
+		t.Errorf("output has no side nodes or leaf data:\n%s", out)
+	}
+
+	out = runShellScript(t, "set foo bar\nset baz qux\nprove foo\nprove -compact absent\n")
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	proof, compact := lines[2], lines[3]
+	out = runShellScript(t, strings.Join([]string{
+		"set foo bar",
+		"set baz qux",
+		"verify foo bar " + proof,
+		"verify foo wrong " + proof,
+		"verify absent '' " + compact,
+		"verify foo bar nothex",
+	}, "\n"))
+	lines = strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 6 || lines[2] != "valid" || lines[3] != "invalid" || lines[4] != "valid" || !strings.HasPrefix(lines[5], "error: proof") {
+		t.Errorf("got output:\n%s", out)
+	}
+}
+
+func TestCompleteShellCommand(t *testing.T) {
+	tests := map[string]string{
+		"":     "",
+		"p":    "path prove",
+		"ch":   "checkout",
+		"hist": "history",
+		"x":    "",
+	}
+	for prefix, want := range tests {
+		got := strings.Join(completeShellCommand(prefix), " ")
+		if prefix == "" {
+			if len(completeShellCommand(prefix)) != len(shellCommands) {
+				t.Errorf("got %q for empty prefix", got)
+			}
+			continue
+		}
+		if got != want {
+			t.Errorf("got completions %q for %q, want %q", got, prefix, want)
+		}
+	}
+}
+
+// Test that the session is written to the store in a single commit on exit,
+// and that moving between roots does not touch the store.
+func TestShellSave(t *testing.T) {
+	store := t.TempDir()
+	runTool(t, store, "init")
+	_, root := runTool(t, store, "put", "foo", "old")
+	shell := func(script string) {
+		t.Helper()
+		var stdout, stderr bytes.Buffer
+		if status := run([]string{"-store", store, "shell"}, strings.NewReader(script), &stdout, &stderr); status != 0 {
+			t.Fatalf("shell: got status %d, output %q", status, stdout.String()+stderr.String())
+		}
+	}
+
+	shell("set foo bar\nundo\nset 'a key' \"a value\"\ndelete 'a key'\ncheckout 2\n")
+	if _, out := runTool(t, store, "-json", "root"); !strings.HasSuffix(out, `"version":2}`) {
+		t.Errorf("session without net changes was written: %s", out)
+	}
+	if _, out := runTool(t, store, "root"); out != root {
+		t.Errorf("got root %q after a session without net changes, want %s", out, root)
+	}
+
+	shell("set foo bar\nset 'a key' \"a value\"\nundo\ncheckout 2\nexit\nset foo ignored\n")
+	if _, out := runTool(t, store, "-json", "root"); !strings.HasSuffix(out, `"version":3}`) {
+		t.Errorf("session was not written in a single commit: %s", out)
+	}
+	if _, value := runTool(t, store, "get", "a key"); value != "a value" {
+		t.Errorf("got value %q for a quoted key, want %q", value, "a value")
+	}
+	if _, value := runTool(t, store, "get", "foo"); value != "bar" {
+		t.Errorf("got value %q after the session, want bar", value)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := map[string]string{
+		`set foo bar`:            `["set","foo","bar"]`,
+		`  set  'a key'  "b c" `: `["set","a key","b c"]`,
+		`verify k '' p`:          `["verify","k","","p"]`,
+		`set a\ b 'it''s' "\""`:  `["set","a b","its","\""]`,
+		`set 'x`:                 `error`,
+		`set x\`:                 `error`,
+	}
+	for line, want := range tests {
+		args, err := splitArgs(line)
+		got := "error"
+		if err == nil {
+			data, _ := json.Marshal(args)
+			got = string(data)
+		}
+		if got != want {
+			t.Errorf("got %s for %q, want %s", got, line, want)
+		}
+	}
+}
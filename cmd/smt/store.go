@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"MPT_MOI/smt-master"
+)
+
+// tempPrefix is the prefix of the names of files being written to a dirStore.
+const tempPrefix = ".tmp-"
+
+// dirStore is a MapStore keeping each key in a file of a directory, named by
+// the hex encoding of the key. Files are written to a temporary file first and
+// renamed, so that an interrupted Set leaves the previous value in place.
+type dirStore struct {
+	dir string
+}
+
+// openDirStore opens the store in a directory, creating the directory if it
+// does not exist.
+func openDirStore(dir string) (*dirStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &dirStore{dir: dir}, nil
+}
+
+func (ds *dirStore) file(key []byte) string {
+	return filepath.Join(ds.dir, hex.EncodeToString(key))
+}
+
+// Get gets the value for a key.
+func (ds *dirStore) Get(key []byte) ([]byte, error) {
+	value, err := os.ReadFile(ds.file(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, &smt.InvalidKeyError{Key: key}
+	}
+	return value, err
+}
+
+// Set updates the value for a key.
+func (ds *dirStore) Set(key []byte, value []byte) error {
+	f, err := os.CreateTemp(ds.dir, tempPrefix)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(value); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), ds.file(key))
+}
+
+// Delete deletes a key.
+func (ds *dirStore) Delete(key []byte) error {
+	err := os.Remove(ds.file(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return &smt.InvalidKeyError{Key: key}
+	}
+	return err
+}
+
+// Iterate calls fn with each key-value pair of the store in ascending order of
+// keys, and stops at the first error returned by fn.
+func (ds *dirStore) Iterate(fn func(key []byte, value []byte) error) error {
+	entries, err := os.ReadDir(ds.dir)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && !strings.HasPrefix(entry.Name(), tempPrefix) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		key, err := hex.DecodeString(name)
+		if err != nil {
+			continue
+		}
+		value, err := os.ReadFile(filepath.Join(ds.dir, name))
+		if err != nil {
+			return err
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
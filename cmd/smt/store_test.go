@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"MPT_MOI/smt-master"
+)
+
+func TestDirStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+	ds, err := openDirStore(dir)
+	if err != nil {
+		t.Fatalf("returned error when opening store: %v", err)
+	}
+
+	var invalidKeyError *smt.InvalidKeyError
+	if _, err := ds.Get([]byte("foo")); !errors.As(err, &invalidKeyError) {
+		t.Errorf("got error %v for absent key, want InvalidKeyError", err)
+	}
+	if err := ds.Delete([]byte("foo")); !errors.As(err, &invalidKeyError) {
+		t.Errorf("got error %v when deleting absent key, want InvalidKeyError", err)
+	}
+	for _, kv := range [][2]string{{"foo", "bar"}, {"\x00key", "value"}, {"foo", "baz"}} {
+		if err := ds.Set([]byte(kv[0]), []byte(kv[1])); err != nil {
+			t.Fatalf("returned error when setting key: %v", err)
+		}
+	}
+	if value, err := ds.Get([]byte("foo")); err != nil || string(value) != "baz" {
+		t.Errorf("got value %q: %v", value, err)
+	}
+
+	// Leftover temporary files are ignored.
+	if err := os.WriteFile(filepath.Join(dir, tempPrefix+"1"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	ds.Iterate(func(key, value []byte) error {
+		keys = append(keys, string(key))
+		return nil
+	})
+	if len(keys) != 2 || keys[0] != "\x00key" || keys[1] != "foo" {
+		t.Errorf("got keys %q", keys)
+	}
+
+	if err := ds.Delete([]byte("foo")); err != nil {
+		t.Errorf("returned error when deleting key: %v", err)
+	}
+	if _, err := ds.Get([]byte("foo")); !errors.As(err, &invalidKeyError) {
+		t.Errorf("got error %v for deleted key, want InvalidKeyError", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// makeRaw is not supported on this platform, so the shell reads plain lines.
+func makeRaw(fd int) (func() error, error) {
+	return nil, errors.New("raw terminal mode is not supported")
+}
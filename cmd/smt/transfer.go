@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"MPT_MOI/kvfile"
+	"MPT_MOI/smt-master"
+)
+
+type transferResult struct {
+	Root    string `json:"root"`
+	Records int    `json:"records"`
+}
+
+// dataFile parses the -format flag of import and export, and the encoding of
+// the tool as an encoding of data files.
+func (c *cli) dataFile(format string) (kvfile.Format, kvfile.Encoding, error) {
+	f, err := kvfile.ParseFormat(format)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %v", errUsage, err)
+	}
+	enc, err := kvfile.ParseEncoding(c.encName)
+	if err != nil {
+		return 0, 0, err
+	}
+	return f, enc, nil
+}
+
+func runImport(c *cli, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "csv", "")
+	batch := fs.Int("batch", kvfile.DefaultBatchSize, "")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	f, enc, err := c.dataFile(*format)
+	if err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+
+	in := c.stdin
+	if name := fs.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	root, n, err := kvfile.Import(tree, kvfile.NewReader(in, f, enc), *batch)
+	if err != nil {
+		return err
+	}
+	return c.output(fmt.Sprintf("%x (%d records)", root, n), transferResult{Root: hex.EncodeToString(root), Records: n})
+}
+
+func runExport(c *cli, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	f, enc, err := c.dataFile(*format)
+	if err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+
+	// The data goes to stdout with -, so the result is not printed.
+	if fs.Arg(0) == "-" {
+		_, err := kvfile.Export(tree, kvfile.NewWriter(c.stdout, f, enc))
+		return err
+	}
+	file, err := os.Create(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	n, err := kvfile.Export(tree, kvfile.NewWriter(file, f, enc))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	root := tree.Root()
+	return c.output(fmt.Sprintf("%x (%d records)", root, n), transferResult{Root: hex.EncodeToString(root), Records: n})
+}
+
+func runSnapshot(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("snapshot", flag.ContinueOnError), args, 1); err != nil {
+		return err
+	}
+	tree, err := c.openTree()
+	if err != nil {
+		return err
+	}
+
+	// The snapshot goes to stdout with -, so the result is not printed.
+	if args[0] == "-" {
+		return tree.ExportSnapshot(c.stdout)
+	}
+	file, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	err = tree.ExportSnapshot(file)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return c.output(hex.EncodeToString(tree.Root()), newRootResult(tree))
+}
+
+// errNotEmpty is returned by checkEmpty for store directories holding data.
+var errNotEmpty = errors.New("not empty")
+
+// checkEmpty returns an error if any of the stores holds data.
+func checkEmpty(stores ...*dirStore) error {
+	for _, store := range stores {
+		err := store.Iterate(func(key, value []byte) error { return errNotEmpty })
+		if err == errNotEmpty {
+			return fmt.Errorf("%s is not empty", store.dir)
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runRestore(c *cli, args []string) error {
+	if err := parseArgs(flag.NewFlagSet("restore", flag.ContinueOnError), args, 1); err != nil {
+		return err
+	}
+	in := c.stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	nodes, values, err := c.openStores()
+	if err != nil {
+		return err
+	}
+	if err := checkEmpty(nodes, values); err != nil {
+		return err
+	}
+
+	// The header is read ahead for the layout of the tree, and the snapshot
+	// is then read again from the start.
+	var read bytes.Buffer
+	header, err := smt.ReadSnapshotHeader(io.TeeReader(in, &read))
+	if err != nil {
+		return err
+	}
+	in = io.MultiReader(&read, in)
+	options := []smt.Option{smt.PersistRoot()}
+	if header.InlineValues {
+		if err := os.WriteFile(filepath.Join(c.store, layoutFile), []byte(inlineLayout+"\n"), 0o644); err != nil {
+			return err
+		}
+		options = append(options, smt.InlineValues())
+	}
+
+	tree, err := smt.ImportSnapshot(in, nodes, values, nil, options...)
+	if err != nil {
+		// The stores were empty, so their partial contents are dropped.
+		for _, name := range []string{"nodes", "values", layoutFile} {
+			os.RemoveAll(filepath.Join(c.store, name))
+		}
+		return err
+	}
+	return c.output(hex.EncodeToString(tree.Root()), newRootResult(tree))
+}
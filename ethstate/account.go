@@ -0,0 +1,124 @@
+// Package ethstate reproduces Ethereum state roots and account proofs with the
+// Merkle Patricia trie of package mpt.
+//
+// The state trie is a secure trie mapping each address to its RLP-encoded
+// account. Each account with storage has its own secure storage trie, whose
+// root is recorded in the account. All tries share one node store.
+package ethstate
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"MPT_MOI/keccak"
+	"MPT_MOI/rlp"
+)
+
+var (
+	// EmptyRoot is the root of an empty trie, the storage root of accounts
+	// without storage.
+	EmptyRoot = hexToBytes("56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421")
+	// EmptyCodeHash is the Keccak-256 digest of empty code, the code hash of
+	// accounts without code.
+	EmptyCodeHash = hexToBytes("c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")
+)
+
+// ErrBadAccount is returned when an account cannot be decoded.
+var ErrBadAccount = errors.New("bad account encoding")
+
+// Account is an Ethereum account as stored in the state trie.
+type Account struct {
+	Nonce       uint64
+	Balance     *big.Int
+	StorageRoot []byte
+	CodeHash    []byte
+}
+
+// NewAccount returns an account with a zero nonce and balance, no storage and
+// no code.
+func NewAccount() *Account {
+	return &Account{
+		Balance:     new(big.Int),
+		StorageRoot: EmptyRoot,
+		CodeHash:    EmptyCodeHash,
+	}
+}
+
+// Encode RLP-encodes the account as [nonce, balance, storageRoot, codeHash].
+func (a *Account) Encode() ([]byte, error) {
+	balance, err := rlp.EncodeBigInt(a.Balance)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeList(
+		rlp.EncodeUint(a.Nonce),
+		balance,
+		rlp.EncodeBytes(a.StorageRoot),
+		rlp.EncodeBytes(a.CodeHash),
+	), nil
+}
+
+// DecodeAccount decodes an account encoded by Account.Encode.
+func DecodeAccount(data []byte) (*Account, error) {
+	content, rest, err := rlp.SplitList(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadAccount, err)
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %v", ErrBadAccount, rlp.ErrMoreThanOneValue)
+	}
+	var fields [4][]byte
+	for i := range fields {
+		if fields[i], content, err = rlp.SplitString(content); err != nil {
+			return nil, fmt.Errorf("%w: field %d: %v", ErrBadAccount, i, err)
+		}
+	}
+	if len(content) != 0 {
+		return nil, fmt.Errorf("%w: too many fields", ErrBadAccount)
+	}
+	a := &Account{StorageRoot: fields[2], CodeHash: fields[3]}
+	if a.Nonce, err = rlp.DecodeUint(fields[0]); err != nil {
+		return nil, fmt.Errorf("%w: nonce: %v", ErrBadAccount, err)
+	}
+	if a.Balance, err = rlp.DecodeBigInt(fields[1]); err != nil {
+		return nil, fmt.Errorf("%w: balance: %v", ErrBadAccount, err)
+	}
+	if len(a.StorageRoot) != keccak.Size || len(a.CodeHash) != keccak.Size {
+		return nil, fmt.Errorf("%w: invalid digest size", ErrBadAccount)
+	}
+	return a, nil
+}
+
+// encodeStorageValue encodes a storage value as it is stored in a storage
+// trie: the RLP string of the value without leading zero bytes. Zero values
+// are not stored, and encode to nil.
+func encodeStorageValue(value []byte) []byte {
+	value = trimLeadingZeros(value)
+	if len(value) == 0 {
+		return nil
+	}
+	return rlp.EncodeBytes(value)
+}
+
+// decodeStorageValue decodes a storage value encoded by encodeStorageValue.
+func decodeStorageValue(data []byte) ([]byte, error) {
+	value, rest, err := rlp.SplitString(data)
+	if err == nil && len(rest) != 0 {
+		err = rlp.ErrMoreThanOneValue
+	}
+	if err == nil && (len(value) == 0 || value[0] == 0) {
+		err = rlp.ErrCanonInt
+	}
+	if err != nil {
+		return nil, fmt.Errorf("bad storage value: %w", err)
+	}
+	return value, nil
+}
+
+func trimLeadingZeros(b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
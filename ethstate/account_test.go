@@ -0,0 +1,49 @@
+package ethstate
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"MPT_MOI/rlp"
+)
+
+func TestAccountEncoding(t *testing.T) {
+	account := NewAccount()
+	data, err := account.Encode()
+	if err != nil {
+		t.Fatalf("returned error when encoding account: %v", err)
+	}
+	// The encoding of an empty account, as in the Ethereum state trie.
+	want := hexToBytes("f8448080a056e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421a0c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470")
+	if !bytes.Equal(data, want) {
+		t.Errorf("got encoding %x, want %x", data, want)
+	}
+
+	account.Nonce = 7
+	account.Balance = new(big.Int).Lsh(big.NewInt(1), 100)
+	data, _ = account.Encode()
+	decoded, err := DecodeAccount(data)
+	if err != nil {
+		t.Fatalf("returned error when decoding account: %v", err)
+	}
+	if decoded.Nonce != 7 || decoded.Balance.Cmp(account.Balance) != 0 ||
+		!bytes.Equal(decoded.StorageRoot, EmptyRoot) || !bytes.Equal(decoded.CodeHash, EmptyCodeHash) {
+		t.Errorf("decoded account %+v differs from %+v", decoded, account)
+	}
+
+	invalid := map[string][]byte{
+		"string":         rlp.EncodeBytes([]byte("account")),
+		"three fields":   rlp.EncodeList(rlp.EncodeUint(1), rlp.EncodeUint(2), rlp.EncodeBytes(EmptyRoot)),
+		"five fields":    append(data[:len(data):len(data)], 0x80),
+		"short digest":   rlp.EncodeList(rlp.EncodeUint(1), rlp.EncodeUint(2), rlp.EncodeBytes(EmptyRoot[:20]), rlp.EncodeBytes(EmptyCodeHash)),
+		"non-canonical":  rlp.EncodeList(rlp.EncodeBytes([]byte{0, 1}), rlp.EncodeUint(2), rlp.EncodeBytes(EmptyRoot), rlp.EncodeBytes(EmptyCodeHash)),
+		"nonce overflow": rlp.EncodeList(rlp.EncodeBytes(bytes.Repeat([]byte{1}, 9)), rlp.EncodeUint(2), rlp.EncodeBytes(EmptyRoot), rlp.EncodeBytes(EmptyCodeHash)),
+	}
+	for name, data := range invalid {
+		if _, err := DecodeAccount(data); !errors.Is(err, ErrBadAccount) {
+			t.Errorf("%s: got error %v, want ErrBadAccount", name, err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package ethstate
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"MPT_MOI/keccak"
+	"MPT_MOI/mpt"
+	smt "MPT_MOI/smt-master"
+)
+
+var (
+	// ErrRootMismatch is returned when an imported state or storage trie does
+	// not have the root recorded in the dump.
+	ErrRootMismatch = errors.New("root mismatch")
+	// ErrMissingKey is returned for dump accounts with neither an address nor
+	// a hashed key.
+	ErrMissingKey = errors.New("account has neither an address nor a key")
+)
+
+// DumpAccount is an account in a state dump, as written by geth dump.
+type DumpAccount struct {
+	Balance  string `json:"balance"`
+	Nonce    uint64 `json:"nonce"`
+	Root     string `json:"root,omitempty"`
+	CodeHash string `json:"codeHash,omitempty"`
+	Code     string `json:"code,omitempty"`
+	// Storage maps the storage slots of the account to their values.
+	Storage map[string]string `json:"storage,omitempty"`
+	Address string            `json:"address,omitempty"`
+	Key     string            `json:"key,omitempty"`
+}
+
+// Dump is a state dump, as written by geth dump.
+type Dump struct {
+	Root string `json:"root,omitempty"`
+	// Accounts maps the addresses of the accounts to the accounts.
+	Accounts map[string]DumpAccount `json:"accounts"`
+}
+
+// ReadDump reads a JSON state dump. Both the single object written by geth
+// dump and the line-per-account output of geth dump --iterative are accepted.
+func ReadDump(r io.Reader) (*Dump, error) {
+	dump := &Dump{Accounts: make(map[string]DumpAccount)}
+	dec := json.NewDecoder(r)
+	for {
+		var fields map[string]json.RawMessage
+		if err := dec.Decode(&fields); err == io.EOF {
+			return dump, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		_, hasAddress := fields["address"]
+		_, hasKey := fields["key"]
+		if hasAddress || hasKey {
+			var account DumpAccount
+			if err := remarshal(fields, &account); err != nil {
+				return nil, err
+			}
+			name := account.Address
+			if name == "" {
+				name = account.Key
+			}
+			dump.Accounts[name] = account
+			continue
+		}
+
+		var part Dump
+		if err := remarshal(fields, &part); err != nil {
+			return nil, err
+		}
+		if part.Root != "" {
+			dump.Root = part.Root
+		}
+		for name, account := range part.Accounts {
+			dump.Accounts[name] = account
+		}
+	}
+}
+
+func remarshal(fields map[string]json.RawMessage, v interface{}) error {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ImportDump imports a state dump into a new state on a MapStore. If the dump
+// records the state root or the storage root of an account, the imported
+// tries are checked against them. Accounts dumped without an address, because
+// the node had no preimage of their key, are imported by their hashed key.
+func ImportDump(nodes smt.MapStore, dump *Dump) (*State, error) {
+	state := NewState(nodes)
+	for name, dumped := range dump.Accounts {
+		if name == "" || strings.HasPrefix(name, "pre(") {
+			name = dumped.Address
+		}
+		setAccount := state.SetAccount
+		if name == "" {
+			name, setAccount = dumped.Key, state.SetAccountByKey
+		}
+		if name == "" {
+			return nil, ErrMissingKey
+		}
+		id, err := decodeHex(name)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %w", name, err)
+		}
+		account, err := importAccount(nodes, &dumped)
+		if err != nil {
+			return nil, fmt.Errorf("account %s: %w", name, err)
+		}
+		if err = setAccount(id, account); err != nil {
+			return nil, fmt.Errorf("account %s: %w", name, err)
+		}
+	}
+	if dump.Root != "" {
+		if err := checkRoot(dump.Root, state.Root()); err != nil {
+			return nil, fmt.Errorf("state: %w", err)
+		}
+	}
+	return state, nil
+}
+
+func importAccount(nodes smt.MapStore, dumped *DumpAccount) (*Account, error) {
+	account := NewAccount()
+	account.Nonce = dumped.Nonce
+	balance, err := parseQuantity(dumped.Balance)
+	if err != nil {
+		return nil, fmt.Errorf("balance: %w", err)
+	}
+	account.Balance = balance
+
+	switch {
+	case dumped.CodeHash != "":
+		if account.CodeHash, err = decodeHex(dumped.CodeHash); err != nil {
+			return nil, fmt.Errorf("code hash: %w", err)
+		}
+	case dumped.Code != "":
+		code, err := decodeHex(dumped.Code)
+		if err != nil {
+			return nil, fmt.Errorf("code: %w", err)
+		}
+		sum := keccak.Sum256(code)
+		account.CodeHash = sum[:]
+	}
+
+	storage := mpt.NewSecureTrie(nodes, keccak.NewLegacyKeccak256())
+	for name, dumpedValue := range dumped.Storage {
+		slot, err := decodeHex(name)
+		if err == nil {
+			slot, err = padSlot(slot)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("storage slot %s: %w", name, err)
+		}
+		value, err := decodeHex(dumpedValue)
+		if err != nil {
+			return nil, fmt.Errorf("storage slot %s: %w", name, err)
+		}
+		if data := encodeStorageValue(value); data != nil {
+			if _, err = storage.Update(slot, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+	account.StorageRoot = storage.Root()
+	if dumped.Root != "" {
+		if err := checkRoot(dumped.Root, account.StorageRoot); err != nil {
+			return nil, fmt.Errorf("storage: %w", err)
+		}
+	}
+	return account, nil
+}
+
+func checkRoot(want string, got []byte) error {
+	root, err := decodeHex(want)
+	if err != nil {
+		return err
+	}
+	if string(root) != string(got) {
+		return fmt.Errorf("%w: dump has %x, imported %x", ErrRootMismatch, root, got)
+	}
+	return nil
+}
+
+// decodeHex decodes a hex string with or without the 0x prefix.
+func decodeHex(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+	if len(s)%2 == 1 {
+		s = "0" + s
+	}
+	return hex.DecodeString(s)
+}
+
+func hexToBytes(s string) []byte {
+	b, err := decodeHex(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// parseQuantity parses a non-negative integer in decimal, or in hex with the
+// 0x prefix.
+func parseQuantity(s string) (*big.Int, error) {
+	if s == "" {
+		return new(big.Int), nil
+	}
+	base := 10
+	if strings.HasPrefix(s, "0x") {
+		s, base = s[2:], 16
+	}
+	i, ok := new(big.Int).SetString(s, base)
+	if !ok || i.Sign() < 0 {
+		return nil, fmt.Errorf("invalid quantity %q", s)
+	}
+	return i, nil
+}
@@ -0,0 +1,143 @@
+package ethstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"MPT_MOI/keccak"
+	smt "MPT_MOI/smt-master"
+)
+
+// The fixtures in testdata describe a small synthetic state, not one recorded
+// from an Ethereum node. Their roots and proofs are regression values; the
+// trie itself is checked against the Ethereum trie tests in package mpt, and
+// the hashed keys and code hashes of the fixtures against their definitions
+// in TestDumpFixtureHashes.
+func readDumpFixture(t *testing.T) *Dump {
+	f, err := os.Open("testdata/dump.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	dump, err := ReadDump(f)
+	if err != nil {
+		t.Fatalf("returned error when reading dump: %v", err)
+	}
+	return dump
+}
+
+func TestImportDump(t *testing.T) {
+	dump := readDumpFixture(t)
+	state, err := ImportDump(smt.NewSimpleMap(), dump)
+	if err != nil {
+		t.Fatalf("returned error when importing dump: %v", err)
+	}
+	if want := hexToBytes(dump.Root); !bytes.Equal(state.Root(), want) {
+		t.Errorf("got state root %x, want %x", state.Root(), want)
+	}
+
+	for name, dumped := range dump.Accounts {
+		account, err := state.GetAccount(hexToBytes(name))
+		if err != nil || account == nil {
+			t.Fatalf("got %v, %v for account %s", account, err, name)
+		}
+		if account.Nonce != dumped.Nonce || account.Balance.String() != dumped.Balance {
+			t.Errorf("account %s: got nonce %d and balance %s", name, account.Nonce, account.Balance)
+		}
+		for slot, value := range dumped.Storage {
+			got, err := state.GetStorage(hexToBytes(name), hexToBytes(slot))
+			if err != nil || !bytes.Equal(got, trimLeadingZeros(hexToBytes(value))) {
+				t.Errorf("account %s slot %s: got %x, %v, want %s", name, slot, got, err, value)
+			}
+		}
+	}
+}
+
+// Test that the keys and code hashes of the fixture accounts are the Keccak-256
+// digests of their addresses and code.
+func TestDumpFixtureHashes(t *testing.T) {
+	dump := readDumpFixture(t)
+	for name, account := range dump.Accounts {
+		if key := keccak.Sum256(hexToBytes(account.Address)); !bytes.Equal(hexToBytes(account.Key), key[:]) {
+			t.Errorf("account %s: got key %s, want %x", name, account.Key, key)
+		}
+		if codeHash := keccak.Sum256(hexToBytes(account.Code)); !bytes.Equal(hexToBytes(account.CodeHash), codeHash[:]) {
+			t.Errorf("account %s: got code hash %s, want %x", name, account.CodeHash, codeHash)
+		}
+	}
+}
+
+// Test that the line-per-account form of the dump gives the same state.
+func TestImportIterativeDump(t *testing.T) {
+	dump := readDumpFixture(t)
+	var lines strings.Builder
+	enc := json.NewEncoder(&lines)
+	enc.Encode(map[string]string{"root": dump.Root})
+	for _, account := range dump.Accounts {
+		enc.Encode(account)
+	}
+
+	iterative, err := ReadDump(strings.NewReader(lines.String()))
+	if err != nil {
+		t.Fatalf("returned error when reading iterative dump: %v", err)
+	}
+	if iterative.Root != dump.Root || len(iterative.Accounts) != len(dump.Accounts) {
+		t.Fatalf("iterative dump has root %s and %d accounts", iterative.Root, len(iterative.Accounts))
+	}
+	if _, err = ImportDump(smt.NewSimpleMap(), iterative); err != nil {
+		t.Errorf("returned error when importing iterative dump: %v", err)
+	}
+}
+
+func TestImportDumpMismatch(t *testing.T) {
+	dump := readDumpFixture(t)
+	for name, account := range dump.Accounts {
+		if len(account.Storage) == 0 {
+			continue
+		}
+		for slot := range account.Storage {
+			account.Storage[slot] = "ff"
+			break
+		}
+		if _, err := ImportDump(smt.NewSimpleMap(), dump); !errors.Is(err, ErrRootMismatch) || !strings.Contains(err.Error(), name) {
+			t.Errorf("got error %v for altered storage, want ErrRootMismatch for account %s", err, name)
+		}
+		account.Root = ""
+		dump.Accounts[name] = account
+		if _, err := ImportDump(smt.NewSimpleMap(), dump); !errors.Is(err, ErrRootMismatch) || !strings.Contains(err.Error(), "state") {
+			t.Errorf("got error %v for altered storage, want ErrRootMismatch for the state", err)
+		}
+		break
+	}
+
+	dump = &Dump{Accounts: map[string]DumpAccount{"pre(0x01)": {Key: "0x01"}}}
+	if _, err := ImportDump(smt.NewSimpleMap(), dump); !errors.Is(err, ErrBadKey) {
+		t.Errorf("got error %v for an account with a short key, want ErrBadKey", err)
+	}
+	dump = &Dump{Accounts: map[string]DumpAccount{"pre()": {}}}
+	if _, err := ImportDump(smt.NewSimpleMap(), dump); !errors.Is(err, ErrMissingKey) {
+		t.Errorf("got error %v for an account without address or key, want ErrMissingKey", err)
+	}
+}
+
+// Test that accounts dumped without an address are imported by their hashed
+// key, into the same state.
+func TestImportDumpWithoutPreimages(t *testing.T) {
+	dump := readDumpFixture(t)
+	stripped := &Dump{Root: dump.Root, Accounts: make(map[string]DumpAccount)}
+	for _, account := range dump.Accounts {
+		account.Address = ""
+		stripped.Accounts["pre("+account.Key+")"] = account
+	}
+	state, err := ImportDump(smt.NewSimpleMap(), stripped)
+	if err != nil {
+		t.Fatalf("returned error when importing dump without preimages: %v", err)
+	}
+	if want := hexToBytes(dump.Root); !bytes.Equal(state.Root(), want) {
+		t.Errorf("got state root %x, want %x", state.Root(), want)
+	}
+}
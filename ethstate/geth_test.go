@@ -0,0 +1,85 @@
+package ethstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	smt "MPT_MOI/smt-master"
+)
+
+// TestGethCaptures checks the state tries against captures recorded from a geth
+// node, in the directories of testdata/geth. See testdata/geth/README.md for
+// how to record them. Each capture holds the output of geth dump, whose state
+// and storage roots are checked by ImportDump, and optionally the responses of
+// eth_getProof at the same block, which are verified against the state root
+// and compared with the proofs of the imported state. The test is skipped if
+// there are no captures.
+func TestGethCaptures(t *testing.T) {
+	dumps, err := filepath.Glob("testdata/geth/*/dump.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dumps) == 0 {
+		t.Skip("no geth captures in testdata/geth")
+	}
+
+	for _, path := range dumps {
+		dir := filepath.Dir(path)
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			dump, err := ReadDump(f)
+			if err != nil {
+				t.Fatalf("returned error when reading dump: %v", err)
+			}
+			if dump.Root == "" {
+				t.Fatal("dump does not record the state root")
+			}
+			state, err := ImportDump(smt.NewSimpleMap(), dump)
+			if err != nil {
+				t.Fatalf("returned error when importing dump: %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "proofs.json"))
+			if errors.Is(err, os.ErrNotExist) {
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			var captures []json.RawMessage
+			if err = json.Unmarshal(data, &captures); err != nil {
+				t.Fatal(err)
+			}
+			for _, capture := range captures {
+				var want AccountResult
+				if err := json.Unmarshal(capture, &want); err != nil {
+					t.Fatalf("returned error when decoding proof: %v", err)
+				}
+				if err := VerifyAccountProof(state.Root(), &want); err != nil {
+					t.Errorf("captured proof of account %x failed to verify: %v", want.Address, err)
+				}
+
+				slots := make([][]byte, len(want.StorageProof))
+				for i, storage := range want.StorageProof {
+					slots[i] = storage.Key
+				}
+				got, err := state.GetProof(want.Address, slots)
+				if err != nil {
+					t.Fatalf("returned error when proving account %x: %v", want.Address, err)
+				}
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(&want)
+				if !bytes.Equal(gotJSON, wantJSON) {
+					t.Errorf("proof of account %x differs from the captured proof:\ngot  %s\nwant %s", want.Address, gotJSON, wantJSON)
+				}
+			}
+		})
+	}
+}
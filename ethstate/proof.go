@@ -0,0 +1,240 @@
+package ethstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"MPT_MOI/keccak"
+	"MPT_MOI/mpt"
+)
+
+// ErrInvalidProof is returned when an account or storage proof does not
+// verify.
+var ErrInvalidProof = errors.New("invalid proof")
+
+// StorageResult is the proof of a storage slot, as returned by eth_getProof.
+type StorageResult struct {
+	Key   []byte
+	Value *big.Int
+	Proof mpt.Proof
+}
+
+// AccountResult is the proof of an account and some of its storage slots, as
+// returned by eth_getProof.
+type AccountResult struct {
+	Address      []byte
+	AccountProof mpt.Proof
+	Balance      *big.Int
+	CodeHash     []byte
+	Nonce        uint64
+	StorageHash  []byte
+	StorageProof []StorageResult
+}
+
+// GetProof generates the proofs of an account and of the given storage slots
+// of the account against the current state root. Proofs of accounts that do
+// not exist show their absence, with the fields of an empty account.
+func (s *State) GetProof(address []byte, slots [][]byte) (*AccountResult, error) {
+	account, err := s.GetAccount(address)
+	if err != nil {
+		return nil, err
+	}
+	accountProof, err := s.accounts.Prove(address)
+	if err != nil {
+		return nil, err
+	}
+	exists := account != nil
+	if !exists {
+		account = NewAccount()
+	}
+	result := &AccountResult{
+		Address:      address,
+		AccountProof: accountProof,
+		Balance:      account.Balance,
+		CodeHash:     account.CodeHash,
+		Nonce:        account.Nonce,
+		StorageHash:  account.StorageRoot,
+		StorageProof: make([]StorageResult, len(slots)),
+	}
+
+	storage := s.storageTrie(account)
+	for i, slot := range slots {
+		if slot, err = padSlot(slot); err != nil {
+			return nil, err
+		}
+		result.StorageProof[i] = StorageResult{Key: slot, Value: new(big.Int), Proof: mpt.Proof{}}
+		if !exists {
+			continue
+		}
+		data, err := storage.Get(slot)
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > 0 {
+			value, err := decodeStorageValue(data)
+			if err != nil {
+				return nil, err
+			}
+			result.StorageProof[i].Value.SetBytes(value)
+		}
+		if result.StorageProof[i].Proof, err = storage.Prove(slot); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// VerifyAccountProof verifies the proofs of an account and of its storage
+// slots against a state root. It returns an error wrapping ErrInvalidProof if
+// any of them does not verify.
+func VerifyAccountProof(root []byte, result *AccountResult) error {
+	account := &Account{
+		Nonce:       result.Nonce,
+		Balance:     result.Balance,
+		StorageRoot: result.StorageHash,
+		CodeHash:    result.CodeHash,
+	}
+	data, err := account.Encode()
+	if err != nil {
+		return err
+	}
+	if !mpt.VerifySecureProof(result.AccountProof, root, result.Address, data, keccak.NewLegacyKeccak256()) {
+		// An empty account may also be proven by its absence.
+		if !account.isEmpty() || !mpt.VerifySecureProof(result.AccountProof, root, result.Address, nil, keccak.NewLegacyKeccak256()) {
+			return fmt.Errorf("account %x: %w", result.Address, ErrInvalidProof)
+		}
+	}
+
+	for _, storage := range result.StorageProof {
+		key, err := padSlot(storage.Key)
+		if err != nil {
+			return err
+		}
+		value := encodeStorageValue(storage.Value.Bytes())
+		if len(storage.Proof) == 0 && value == nil && bytes.Equal(result.StorageHash, EmptyRoot) {
+			// Slots of accounts without storage need no proof.
+			continue
+		}
+		if !mpt.VerifySecureProof(storage.Proof, result.StorageHash, key, value, keccak.NewLegacyKeccak256()) {
+			return fmt.Errorf("storage slot %x: %w", key, ErrInvalidProof)
+		}
+	}
+	return nil
+}
+
+func (a *Account) isEmpty() bool {
+	return a.Nonce == 0 && a.Balance.Sign() == 0 &&
+		bytes.Equal(a.StorageRoot, EmptyRoot) && bytes.Equal(a.CodeHash, EmptyCodeHash)
+}
+
+type jsonStorageResult struct {
+	Key   string   `json:"key"`
+	Value string   `json:"value"`
+	Proof []string `json:"proof"`
+}
+
+type jsonAccountResult struct {
+	Address      string              `json:"address"`
+	AccountProof []string            `json:"accountProof"`
+	Balance      string              `json:"balance"`
+	CodeHash     string              `json:"codeHash"`
+	Nonce        string              `json:"nonce"`
+	StorageHash  string              `json:"storageHash"`
+	StorageProof []jsonStorageResult `json:"storageProof"`
+}
+
+// MarshalJSON encodes the result in the JSON format of eth_getProof.
+func (r *AccountResult) MarshalJSON() ([]byte, error) {
+	j := jsonAccountResult{
+		Address:      encodeHex(r.Address),
+		AccountProof: encodeProof(r.AccountProof),
+		Balance:      encodeQuantity(r.Balance),
+		CodeHash:     encodeHex(r.CodeHash),
+		Nonce:        encodeQuantity(new(big.Int).SetUint64(r.Nonce)),
+		StorageHash:  encodeHex(r.StorageHash),
+		StorageProof: make([]jsonStorageResult, len(r.StorageProof)),
+	}
+	for i, storage := range r.StorageProof {
+		j.StorageProof[i] = jsonStorageResult{
+			Key:   encodeHex(storage.Key),
+			Value: encodeQuantity(storage.Value),
+			Proof: encodeProof(storage.Proof),
+		}
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON decodes a result in the JSON format of eth_getProof.
+func (r *AccountResult) UnmarshalJSON(data []byte) error {
+	var j jsonAccountResult
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	var result AccountResult
+	var err error
+	if result.Address, err = decodeHex(j.Address); err != nil {
+		return fmt.Errorf("address: %w", err)
+	}
+	if result.AccountProof, err = decodeProof(j.AccountProof); err != nil {
+		return fmt.Errorf("account proof: %w", err)
+	}
+	if result.Balance, err = parseQuantity(j.Balance); err != nil {
+		return fmt.Errorf("balance: %w", err)
+	}
+	if result.CodeHash, err = decodeHex(j.CodeHash); err != nil {
+		return fmt.Errorf("code hash: %w", err)
+	}
+	nonce, err := parseQuantity(j.Nonce)
+	if err != nil || !nonce.IsUint64() {
+		return fmt.Errorf("invalid nonce %q", j.Nonce)
+	}
+	result.Nonce = nonce.Uint64()
+	if result.StorageHash, err = decodeHex(j.StorageHash); err != nil {
+		return fmt.Errorf("storage hash: %w", err)
+	}
+	result.StorageProof = make([]StorageResult, len(j.StorageProof))
+	for i, storage := range j.StorageProof {
+		if result.StorageProof[i].Key, err = decodeHex(storage.Key); err != nil {
+			return fmt.Errorf("storage key: %w", err)
+		}
+		if result.StorageProof[i].Value, err = parseQuantity(storage.Value); err != nil {
+			return fmt.Errorf("storage value: %w", err)
+		}
+		if result.StorageProof[i].Proof, err = decodeProof(storage.Proof); err != nil {
+			return fmt.Errorf("storage proof: %w", err)
+		}
+	}
+	*r = result
+	return nil
+}
+
+func encodeHex(b []byte) string {
+	return fmt.Sprintf("0x%x", b)
+}
+
+func encodeQuantity(i *big.Int) string {
+	return "0x" + i.Text(16)
+}
+
+func encodeProof(proof mpt.Proof) []string {
+	nodes := make([]string, len(proof))
+	for i, data := range proof {
+		nodes[i] = encodeHex(data)
+	}
+	return nodes
+}
+
+func decodeProof(nodes []string) (mpt.Proof, error) {
+	proof := make(mpt.Proof, len(nodes))
+	for i, node := range nodes {
+		data, err := decodeHex(node)
+		if err != nil {
+			return nil, err
+		}
+		proof[i] = data
+	}
+	return proof, nil
+}
@@ -0,0 +1,88 @@
+package ethstate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	smt "MPT_MOI/smt-master"
+)
+
+func TestGetProof(t *testing.T) {
+	dump := readDumpFixture(t)
+	state, err := ImportDump(smt.NewSimpleMap(), dump)
+	if err != nil {
+		t.Fatalf("returned error when importing dump: %v", err)
+	}
+	data, err := os.ReadFile("testdata/proofs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fixtures []json.RawMessage
+	if err = json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range fixtures {
+		var want AccountResult
+		if err := json.Unmarshal(fixture, &want); err != nil {
+			t.Fatalf("returned error when decoding proof: %v", err)
+		}
+		if err := VerifyAccountProof(state.Root(), &want); err != nil {
+			t.Errorf("recorded proof of account %x failed to verify: %v", want.Address, err)
+		}
+
+		slots := make([][]byte, len(want.StorageProof))
+		for i, storage := range want.StorageProof {
+			slots[i] = storage.Key
+		}
+		got, err := state.GetProof(want.Address, slots)
+		if err != nil {
+			t.Fatalf("returned error when proving account %x: %v", want.Address, err)
+		}
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(&want)
+		if !bytes.Equal(gotJSON, wantJSON) {
+			t.Errorf("proof of account %x differs from the recorded proof:\ngot  %s\nwant %s", want.Address, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestVerifyAccountProofInvalid(t *testing.T) {
+	state, _ := ImportDump(smt.NewSimpleMap(), readDumpFixture(t))
+	var address []byte
+	for name, account := range readDumpFixture(t).Accounts {
+		if len(account.Storage) > 0 {
+			address = hexToBytes(name)
+			break
+		}
+	}
+	slot := []byte{1}
+
+	result, _ := state.GetProof(address, [][]byte{slot})
+	result.Nonce++
+	if err := VerifyAccountProof(state.Root(), result); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("got error %v for an altered nonce, want ErrInvalidProof", err)
+	}
+
+	result, _ = state.GetProof(address, [][]byte{slot})
+	result.StorageProof[0].Value.SetInt64(12345)
+	if err := VerifyAccountProof(state.Root(), result); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("got error %v for an altered storage value, want ErrInvalidProof", err)
+	}
+
+	result, _ = state.GetProof(address, [][]byte{slot})
+	result.StorageProof[0].Proof = nil
+	if err := VerifyAccountProof(state.Root(), result); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("got error %v for a missing storage proof, want ErrInvalidProof", err)
+	}
+
+	// An absent account may not be claimed to have a balance.
+	result, _ = state.GetProof(make([]byte, AddressSize), nil)
+	result.Balance.SetInt64(1)
+	if err := VerifyAccountProof(state.Root(), result); !errors.Is(err, ErrInvalidProof) {
+		t.Errorf("got error %v for a balance of an absent account, want ErrInvalidProof", err)
+	}
+}
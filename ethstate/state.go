@@ -0,0 +1,172 @@
+package ethstate
+
+import (
+	"errors"
+
+	"MPT_MOI/keccak"
+	"MPT_MOI/mpt"
+	smt "MPT_MOI/smt-master"
+)
+
+const (
+	// AddressSize is the size of an account address in bytes.
+	AddressSize = 20
+	// SlotSize is the size of a storage slot key in bytes.
+	SlotSize = 32
+	// KeySize is the size of the hashed key of an account in bytes.
+	KeySize = 32
+)
+
+var (
+	// ErrBadAddress is returned for addresses that are not AddressSize bytes.
+	ErrBadAddress = errors.New("invalid address size")
+	// ErrBadSlot is returned for storage slots longer than SlotSize bytes.
+	ErrBadSlot = errors.New("invalid storage slot size")
+	// ErrBadKey is returned for hashed account keys that are not KeySize
+	// bytes.
+	ErrBadKey = errors.New("invalid account key size")
+)
+
+// State is the Ethereum world state: the accounts trie and the storage tries
+// of the accounts.
+type State struct {
+	nodes    smt.MapStore
+	accounts *mpt.SecureTrie
+}
+
+// NewState creates a new empty state on a MapStore.
+func NewState(nodes smt.MapStore) *State {
+	return &State{
+		nodes:    nodes,
+		accounts: mpt.NewSecureTrie(nodes, keccak.NewLegacyKeccak256()),
+	}
+}
+
+// ImportState imports the state with a given root from a MapStore.
+func ImportState(nodes smt.MapStore, root []byte) *State {
+	return &State{
+		nodes:    nodes,
+		accounts: mpt.ImportSecureTrie(nodes, keccak.NewLegacyKeccak256(), root),
+	}
+}
+
+// Root gets the state root.
+func (s *State) Root() []byte {
+	return s.accounts.Root()
+}
+
+// GetAccount gets an account from the state. It returns nil if the account
+// does not exist.
+func (s *State) GetAccount(address []byte) (*Account, error) {
+	if len(address) != AddressSize {
+		return nil, ErrBadAddress
+	}
+	data, err := s.accounts.Get(address)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return DecodeAccount(data)
+}
+
+// SetAccount sets an account in the state. The storage of the account is the
+// storage trie with the root in the account, which must already be in the
+// store.
+func (s *State) SetAccount(address []byte, account *Account) error {
+	if len(address) != AddressSize {
+		return ErrBadAddress
+	}
+	data, err := account.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = s.accounts.Update(address, data)
+	return err
+}
+
+// SetAccountByKey sets the account with a given hashed key, the Keccak-256
+// digest of its address, in the state. It is used when the address of the
+// account is not known.
+func (s *State) SetAccountByKey(key []byte, account *Account) error {
+	if len(key) != KeySize {
+		return ErrBadKey
+	}
+	data, err := account.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = s.accounts.UpdateDigest(key, data)
+	return err
+}
+
+// DeleteAccount removes an account from the state.
+func (s *State) DeleteAccount(address []byte) error {
+	if len(address) != AddressSize {
+		return ErrBadAddress
+	}
+	_, err := s.accounts.Delete(address)
+	return err
+}
+
+// GetStorage gets the value of a storage slot of an account, without leading
+// zero bytes. Slots shorter than SlotSize bytes are left-padded with zeros.
+func (s *State) GetStorage(address []byte, slot []byte) ([]byte, error) {
+	slot, err := padSlot(slot)
+	if err != nil {
+		return nil, err
+	}
+	account, err := s.GetAccount(address)
+	if err != nil || account == nil {
+		return nil, err
+	}
+	data, err := s.storageTrie(account).Get(slot)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	return decodeStorageValue(data)
+}
+
+// SetStorage sets the value of a storage slot of an account, creating the
+// account if it does not exist. Setting a zero value removes the slot.
+func (s *State) SetStorage(address []byte, slot []byte, value []byte) error {
+	slot, err := padSlot(slot)
+	if err != nil {
+		return err
+	}
+	account, err := s.GetAccount(address)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		account = NewAccount()
+	}
+	storage := s.storageTrie(account)
+	if data := encodeStorageValue(value); data == nil {
+		_, err = storage.Delete(slot)
+	} else {
+		_, err = storage.Update(slot, data)
+	}
+	if err != nil {
+		return err
+	}
+	account.StorageRoot = storage.Root()
+	return s.SetAccount(address, account)
+}
+
+func (s *State) storageTrie(account *Account) *mpt.SecureTrie {
+	return mpt.ImportSecureTrie(s.nodes, keccak.NewLegacyKeccak256(), account.StorageRoot)
+}
+
+func padSlot(slot []byte) ([]byte, error) {
+	if len(slot) > SlotSize {
+		return nil, ErrBadSlot
+	}
+	if len(slot) == SlotSize {
+		return slot, nil
+	}
+	padded := make([]byte, SlotSize)
+	copy(padded[SlotSize-len(slot):], slot)
+	return padded, nil
+}
@@ -0,0 +1,76 @@
+package ethstate
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	smt "MPT_MOI/smt-master"
+)
+
+func TestStateAccountsAndStorage(t *testing.T) {
+	nodes := smt.NewSimpleMap()
+	state := NewState(nodes)
+	if !bytes.Equal(state.Root(), EmptyRoot) {
+		t.Errorf("new state has root %x, want the empty root", state.Root())
+	}
+
+	address := bytes.Repeat([]byte{0xaa}, AddressSize)
+	if account, err := state.GetAccount(address); account != nil || err != nil {
+		t.Errorf("got %v, %v for an absent account", account, err)
+	}
+	if _, err := state.GetAccount(address[1:]); !errors.Is(err, ErrBadAddress) {
+		t.Errorf("got error %v for a short address, want ErrBadAddress", err)
+	}
+
+	account := NewAccount()
+	account.Balance = big.NewInt(1000)
+	if err := state.SetAccount(address, account); err != nil {
+		t.Fatalf("returned error when setting account: %v", err)
+	}
+	withoutStorage := state.Root()
+
+	if err := state.SetStorage(address, []byte{1}, []byte{0, 0, 0x2a}); err != nil {
+		t.Fatalf("returned error when setting storage: %v", err)
+	}
+	value, err := state.GetStorage(address, append(make([]byte, SlotSize-1), 1))
+	if err != nil || !bytes.Equal(value, []byte{0x2a}) {
+		t.Errorf("got storage value %x, %v, want 2a", value, err)
+	}
+	account, _ = state.GetAccount(address)
+	if bytes.Equal(account.StorageRoot, EmptyRoot) || account.Balance.Int64() != 1000 {
+		t.Errorf("unexpected account after setting storage: %+v", account)
+	}
+	if _, err := state.GetStorage(address, make([]byte, SlotSize+1)); !errors.Is(err, ErrBadSlot) {
+		t.Errorf("got error %v for a long slot, want ErrBadSlot", err)
+	}
+
+	// Setting a zero value removes the slot.
+	if err := state.SetStorage(address, []byte{1}, []byte{0}); err != nil {
+		t.Fatalf("returned error when clearing storage: %v", err)
+	}
+	if value, _ := state.GetStorage(address, []byte{1}); value != nil {
+		t.Errorf("got value %x for a cleared slot", value)
+	}
+	if !bytes.Equal(state.Root(), withoutStorage) {
+		t.Error("clearing the only slot did not restore the state root")
+	}
+
+	// Storage of a new account creates the account.
+	other := bytes.Repeat([]byte{0xbb}, AddressSize)
+	state.SetStorage(other, []byte{2}, []byte{3})
+	root := state.Root()
+	if account, _ := state.GetAccount(other); account == nil || account.Nonce != 0 {
+		t.Errorf("got account %+v after setting its storage", account)
+	}
+
+	imported := ImportState(nodes, root)
+	if value, _ := imported.GetStorage(other, []byte{2}); !bytes.Equal(value, []byte{3}) {
+		t.Errorf("imported state has storage value %x, want 03", value)
+	}
+	imported.DeleteAccount(other)
+	if !bytes.Equal(imported.Root(), withoutStorage) {
+		t.Error("deleting the new account did not restore the state root")
+	}
+}
@@ -0,0 +1,155 @@
+// Package keccak implements the Keccak-256 hash function with the original
+// Keccak padding, as used by Ethereum, and the standardized SHA3-256 of FIPS
+// 202, which differs from it only in its padding byte.
+package keccak
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+)
+
+const (
+	// Size is the size of a Keccak-256 digest in bytes.
+	Size = 32
+	// BlockSize is the rate of the Keccak-256 sponge in bytes.
+	BlockSize = 200 - 2*Size
+
+	// keccakPadding is the domain separation byte of the original Keccak.
+	keccakPadding = 0x01
+	// sha3Padding is the domain separation byte of SHA-3.
+	sha3Padding = 0x06
+)
+
+var roundConstants = [24]uint64{
+	0x0000000000000001, 0x0000000000008082, 0x800000000000808a, 0x8000000080008000,
+	0x000000000000808b, 0x0000000080000001, 0x8000000080008081, 0x8000000000008009,
+	0x000000000000008a, 0x0000000000000088, 0x0000000080008009, 0x000000008000000a,
+	0x000000008000808b, 0x800000000000008b, 0x8000000000008089, 0x8000000000008003,
+	0x8000000000008002, 0x8000000000000080, 0x000000000000800a, 0x800000008000000a,
+	0x8000000080008081, 0x8000000000008080, 0x0000000080000001, 0x8000000080008008,
+}
+
+// rotations are the rotation offsets of the rho step, indexed by lane.
+var rotations = [25]int{
+	0, 1, 62, 28, 27,
+	36, 44, 6, 55, 20,
+	3, 10, 43, 25, 39,
+	41, 45, 15, 21, 8,
+	18, 2, 61, 56, 14,
+}
+
+type state struct {
+	a       [25]uint64
+	buf     [BlockSize]byte
+	n       int
+	padding byte
+}
+
+// NewLegacyKeccak256 returns a new hash.Hash computing Keccak-256.
+func NewLegacyKeccak256() hash.Hash {
+	return &state{padding: keccakPadding}
+}
+
+// New256 returns a new hash.Hash computing SHA3-256.
+func New256() hash.Hash {
+	return &state{padding: sha3Padding}
+}
+
+// Sum256 returns the Keccak-256 digest of data.
+func Sum256(data []byte) [Size]byte {
+	d := state{padding: keccakPadding}
+	d.Write(data)
+	var sum [Size]byte
+	d.checkSum(sum[:0])
+	return sum
+}
+
+func (d *state) Size() int      { return Size }
+func (d *state) BlockSize() int { return BlockSize }
+
+func (d *state) Reset() {
+	d.a = [25]uint64{}
+	d.n = 0
+}
+
+func (d *state) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		if d.n == 0 && len(p) >= BlockSize {
+			d.absorb(p[:BlockSize])
+			p = p[BlockSize:]
+			continue
+		}
+		c := copy(d.buf[d.n:], p)
+		d.n += c
+		p = p[c:]
+		if d.n == BlockSize {
+			d.absorb(d.buf[:])
+			d.n = 0
+		}
+	}
+	return written, nil
+}
+
+// Sum appends the digest to b without changing the state of the hash.
+func (d *state) Sum(b []byte) []byte {
+	dup := *d
+	return dup.checkSum(b)
+}
+
+func (d *state) checkSum(b []byte) []byte {
+	for i := d.n; i < BlockSize; i++ {
+		d.buf[i] = 0
+	}
+	d.buf[d.n] ^= d.padding
+	d.buf[BlockSize-1] ^= 0x80
+	d.absorb(d.buf[:])
+
+	var out [Size]byte
+	for i := 0; i < Size/8; i++ {
+		binary.LittleEndian.PutUint64(out[i*8:], d.a[i])
+	}
+	return append(b, out[:]...)
+}
+
+// absorb XORs a block into the state and permutes it.
+func (d *state) absorb(block []byte) {
+	for i := 0; i < BlockSize/8; i++ {
+		d.a[i] ^= binary.LittleEndian.Uint64(block[i*8:])
+	}
+	keccakF1600(&d.a)
+}
+
+// keccakF1600 applies the Keccak-f[1600] permutation to the state, whose lanes
+// are indexed by x + 5*y.
+func keccakF1600(a *[25]uint64) {
+	var c [5]uint64
+	var b [25]uint64
+	for round := 0; round < 24; round++ {
+		// Theta.
+		for x := 0; x < 5; x++ {
+			c[x] = a[x] ^ a[x+5] ^ a[x+10] ^ a[x+15] ^ a[x+20]
+		}
+		for x := 0; x < 5; x++ {
+			t := c[(x+4)%5] ^ bits.RotateLeft64(c[(x+1)%5], 1)
+			for y := 0; y < 25; y += 5 {
+				a[x+y] ^= t
+			}
+		}
+		// Rho and pi.
+		for x := 0; x < 5; x++ {
+			for y := 0; y < 5; y++ {
+				b[y+5*((2*x+3*y)%5)] = bits.RotateLeft64(a[x+5*y], rotations[x+5*y])
+			}
+		}
+		// Chi.
+		for y := 0; y < 25; y += 5 {
+			for x := 0; x < 5; x++ {
+				a[x+y] = b[x+y] ^ (^b[(x+1)%5+y] & b[(x+2)%5+y])
+			}
+		}
+		// Iota.
+		a[0] ^= roundConstants[round]
+	}
+}
@@ -0,0 +1,88 @@
+package keccak
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Known answers of Keccak-256 with the original padding.
+var katTests = []struct {
+	in   string
+	want string
+}{
+	{"", "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+	{"abc", "4e03657aea45a94fc7d47ba826c8d667c0d1e6e33a64a036ec44f58fa12d6c45"},
+	{"The quick brown fox jumps over the lazy dog", "4d741b6f1eb29cb2a9b9911c82f56fa8d73b04959d3d9d222895df6c0b28aa15"},
+	{"The quick brown fox jumps over the lazy dog.", "578951e24efd62a3d63a86f7cd19aaa53c898fe287d2552133220370240b572d"},
+}
+
+func TestKnownAnswers(t *testing.T) {
+	for _, test := range katTests {
+		h := NewLegacyKeccak256()
+		h.Write([]byte(test.in))
+		if got := hex.EncodeToString(h.Sum(nil)); got != test.want {
+			t.Errorf("Keccak256(%q) = %s, want %s", test.in, got, test.want)
+		}
+		sum := Sum256([]byte(test.in))
+		if got := hex.EncodeToString(sum[:]); got != test.want {
+			t.Errorf("Sum256(%q) = %s, want %s", test.in, got, test.want)
+		}
+	}
+}
+
+// Known answers of SHA3-256 from FIPS 202.
+var sha3Tests = []struct {
+	in   string
+	want string
+}{
+	{"", "a7ffc6f8bf1ed76651c14756a061d662f580ff4de43b49fa82d80a4b80f8434a"},
+	{"abc", "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"},
+}
+
+func TestSHA3KnownAnswers(t *testing.T) {
+	for _, test := range sha3Tests {
+		h := New256()
+		h.Write([]byte(test.in))
+		if got := hex.EncodeToString(h.Sum(nil)); got != test.want {
+			t.Errorf("SHA3-256(%q) = %s, want %s", test.in, got, test.want)
+		}
+		h.Reset()
+		h.Write([]byte(test.in))
+		if got := hex.EncodeToString(h.Sum(nil)); got != test.want {
+			t.Errorf("SHA3-256(%q) after Reset = %s, want %s", test.in, got, test.want)
+		}
+	}
+}
+
+// Test that writing in pieces across block boundaries gives the same digest
+// as a single write, and that Sum and Reset behave as hash.Hash requires.
+func TestIncremental(t *testing.T) {
+	data := []byte(strings.Repeat("0123456789", 100))
+	want := Sum256(data)
+
+	for _, step := range []int{1, 7, BlockSize - 1, BlockSize, BlockSize + 1, 500} {
+		h := NewLegacyKeccak256()
+		for i := 0; i < len(data); i += step {
+			end := i + step
+			if end > len(data) {
+				end = len(data)
+			}
+			h.Write(data[i:end])
+		}
+		if got := h.Sum(nil); string(got) != string(want[:]) {
+			t.Errorf("step %d: got %x, want %x", step, got, want)
+		}
+		// Sum must not change the state.
+		if got := h.Sum([]byte{0xff}); string(got[1:]) != string(want[:]) || got[0] != 0xff {
+			t.Errorf("step %d: second Sum returned %x", step, got)
+		}
+	}
+
+	h := NewLegacyKeccak256()
+	h.Write([]byte("garbage"))
+	h.Reset()
+	if got := hex.EncodeToString(h.Sum(nil)); got != katTests[0].want {
+		t.Errorf("digest after Reset = %s, want the empty digest", got)
+	}
+}
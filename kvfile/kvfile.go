@@ -0,0 +1,436 @@
+// Package kvfile reads and writes key/value data files, and loads them into
+// and dumps them from trees.
+//
+// Three formats are supported:
+//
+//   - CSV, with a header row of "key,value" and a key and a value per row;
+//   - JSON Lines, with a JSON object per line with "key" and "value" members;
+//   - a binary format, with a header of the magic "SMTKV", a version byte of 1
+//     and a byte of 0, followed by a key and a value per record, each prefixed
+//     with its length as an unsigned varint.
+//
+// Keys and values are encoded as text in CSV and JSON Lines, as hex, UTF-8 or
+// base64. Files exported from a tree hold paths instead of keys: they have a
+// header row of "path,value" or "path" members instead of "key", and binary
+// files have a header ending with a byte of 1. Paths are always hex in text
+// formats, whatever the encoding of values. Records read from such files are
+// marked as holding paths.
+package kvfile
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxBinaryFieldSize bounds the size of the keys and values of binary files,
+// so that a corrupt length cannot cause a large allocation.
+const maxBinaryFieldSize = 1 << 26
+
+// binaryMagic starts the header of binary files, followed by binaryVersion and
+// a byte telling whether the records hold paths.
+const binaryMagic = "SMTKV"
+
+const binaryVersion = 1
+
+// ErrBadRecord is returned when a record of a file cannot be decoded.
+var ErrBadRecord = errors.New("bad record")
+
+// ErrBadHeader is returned when a file does not start with a valid header.
+var ErrBadHeader = errors.New("bad header")
+
+// Format is the format of a data file.
+type Format int
+
+const (
+	// CSV is comma-separated values.
+	CSV Format = iota
+	// JSONLines is JSON Lines.
+	JSONLines
+	// Binary is length-prefixed binary records.
+	Binary
+)
+
+var formatNames = []string{"csv", "jsonl", "binary"}
+
+// ParseFormat returns the format with the given name: csv, jsonl or binary.
+func ParseFormat(name string) (Format, error) {
+	for i, formatName := range formatNames {
+		if name == formatName {
+			return Format(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown format %q (want %s)", name, strings.Join(formatNames, ", "))
+}
+
+func (f Format) String() string {
+	if f < 0 || int(f) >= len(formatNames) {
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+	return formatNames[f]
+}
+
+// Encoding is the encoding of keys and values in text formats.
+type Encoding int
+
+const (
+	// Hex is hexadecimal, optionally prefixed with 0x on input.
+	Hex Encoding = iota
+	// UTF8 is text.
+	UTF8
+	// Base64 is standard base64 with padding.
+	Base64
+)
+
+var encodingNames = []string{"hex", "utf8", "base64"}
+
+// ParseEncoding returns the encoding with the given name: hex, utf8 or base64.
+func ParseEncoding(name string) (Encoding, error) {
+	for i, encodingName := range encodingNames {
+		if name == encodingName {
+			return Encoding(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown encoding %q (want %s)", name, strings.Join(encodingNames, ", "))
+}
+
+func (e Encoding) String() string {
+	if e < 0 || int(e) >= len(encodingNames) {
+		return fmt.Sprintf("Encoding(%d)", int(e))
+	}
+	return encodingNames[e]
+}
+
+func (e Encoding) encode(data []byte) string {
+	switch e {
+	case UTF8:
+		return string(data)
+	case Base64:
+		return base64.StdEncoding.EncodeToString(data)
+	default:
+		return hex.EncodeToString(data)
+	}
+}
+
+func (e Encoding) decode(s string) ([]byte, error) {
+	switch e {
+	case UTF8:
+		return []byte(s), nil
+	case Base64:
+		return base64.StdEncoding.DecodeString(s)
+	default:
+		return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	}
+}
+
+// Record is a key, or a path, and its value.
+type Record struct {
+	Key   []byte
+	Value []byte
+	// Path tells whether Key holds a path rather than a key.
+	Path bool
+}
+
+// jsonRecord is a record of a JSON Lines file.
+type jsonRecord struct {
+	Key   *string `json:"key,omitempty"`
+	Path  *string `json:"path,omitempty"`
+	Value string  `json:"value"`
+}
+
+// Reader reads the records of a data file.
+type Reader struct {
+	format   Format
+	encoding Encoding
+	n        int
+	header   bool
+	// paths tells whether the header of a CSV or binary file names paths.
+	paths bool
+
+	csv   *csv.Reader
+	lines *bufio.Scanner
+	bin   *bufio.Reader
+}
+
+// NewReader returns a reader of the records of a file in the given format,
+// with keys and values in the given encoding for text formats.
+func NewReader(r io.Reader, format Format, encoding Encoding) *Reader {
+	rd := &Reader{format: format, encoding: encoding}
+	switch format {
+	case CSV:
+		rd.csv = csv.NewReader(r)
+		rd.csv.FieldsPerRecord = 2
+	case JSONLines:
+		rd.lines = bufio.NewScanner(r)
+		rd.lines.Buffer(nil, 2*maxBinaryFieldSize)
+	default:
+		rd.bin = bufio.NewReader(r)
+	}
+	return rd
+}
+
+// Read returns the next record, or io.EOF at the end of the file. Errors in
+// the contents of the file wrap ErrBadRecord, or ErrBadHeader for the header
+// of CSV and binary files.
+func (rd *Reader) Read() (Record, error) {
+	if !rd.header && rd.format != JSONLines {
+		rd.header = true
+		if err := rd.readHeader(); err != nil {
+			return Record{}, err
+		}
+	}
+	var rec Record
+	var err error
+	switch rd.format {
+	case CSV:
+		rec, err = rd.readCSV()
+	case JSONLines:
+		rec, err = rd.readJSON()
+	default:
+		rec, err = rd.readBinary()
+	}
+	if err != nil && err != io.EOF {
+		return Record{}, fmt.Errorf("record %d: %w", rd.n+1, err)
+	}
+	rd.n++
+	return rec, err
+}
+
+// readHeader reads the header of a CSV or binary file, which tells whether its
+// records hold keys or paths. Empty files have no header, and return io.EOF.
+func (rd *Reader) readHeader() error {
+	if rd.format == CSV {
+		row, err := rd.csv.Read()
+		if err == io.EOF {
+			return err
+		} else if err != nil {
+			return fmt.Errorf("%w: %v", ErrBadHeader, err)
+		}
+		if (row[0] != "key" && row[0] != "path") || row[1] != "value" {
+			return fmt.Errorf("%w: want a row of key,value or path,value", ErrBadHeader)
+		}
+		rd.paths = row[0] == "path"
+		return nil
+	}
+
+	if _, err := rd.bin.Peek(1); err == io.EOF {
+		return err
+	}
+	header := make([]byte, len(binaryMagic)+2)
+	if _, err := io.ReadFull(rd.bin, header); err != nil || string(header[:len(binaryMagic)]) != binaryMagic {
+		return fmt.Errorf("%w: not a binary data file", ErrBadHeader)
+	}
+	if version := header[len(binaryMagic)]; version != binaryVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrBadHeader, version)
+	}
+	switch header[len(binaryMagic)+1] {
+	case 0:
+	case 1:
+		rd.paths = true
+	default:
+		return fmt.Errorf("%w: unknown record kind %d", ErrBadHeader, header[len(binaryMagic)+1])
+	}
+	return nil
+}
+
+func (rd *Reader) readCSV() (Record, error) {
+	row, err := rd.csv.Read()
+	if err == io.EOF {
+		return Record{}, err
+	} else if err != nil {
+		return Record{}, fmt.Errorf("%w: %v", ErrBadRecord, err)
+	}
+	return rd.decode(row[0], row[1], rd.paths)
+}
+
+func (rd *Reader) readJSON() (Record, error) {
+	for rd.lines.Scan() {
+		line := strings.TrimSpace(rd.lines.Text())
+		if line == "" {
+			continue
+		}
+		var jr jsonRecord
+		if err := json.Unmarshal([]byte(line), &jr); err != nil {
+			return Record{}, fmt.Errorf("%w: %v", ErrBadRecord, err)
+		}
+		switch {
+		case jr.Key != nil:
+			return rd.decode(*jr.Key, jr.Value, false)
+		case jr.Path != nil:
+			return rd.decode(*jr.Path, jr.Value, true)
+		default:
+			return Record{}, fmt.Errorf("%w: missing key", ErrBadRecord)
+		}
+	}
+	if err := rd.lines.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+func (rd *Reader) readBinary() (Record, error) {
+	if _, err := rd.bin.Peek(1); err == io.EOF {
+		return Record{}, io.EOF
+	}
+	key, err := rd.readBinaryField()
+	if err != nil {
+		return Record{}, err
+	}
+	value, err := rd.readBinaryField()
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Key: key, Value: value, Path: rd.paths}, nil
+}
+
+func (rd *Reader) readBinaryField() ([]byte, error) {
+	size, err := binary.ReadUvarint(rd.bin)
+	if err != nil {
+		return nil, fmt.Errorf("%w: length: %v", ErrBadRecord, unexpectedEOF(err))
+	}
+	if size > maxBinaryFieldSize {
+		return nil, fmt.Errorf("%w: field of %d bytes", ErrBadRecord, size)
+	}
+	field := make([]byte, size)
+	if _, err := io.ReadFull(rd.bin, field); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadRecord, unexpectedEOF(err))
+	}
+	return field, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (rd *Reader) decode(key, value string, path bool) (Record, error) {
+	rec := Record{Path: path}
+	keyEncoding := rd.encoding
+	if path {
+		keyEncoding = Hex
+	}
+	var err error
+	if rec.Key, err = keyEncoding.decode(key); err != nil {
+		return Record{}, fmt.Errorf("%w: key: %v", ErrBadRecord, err)
+	}
+	if rec.Value, err = rd.encoding.decode(value); err != nil {
+		return Record{}, fmt.Errorf("%w: value: %v", ErrBadRecord, err)
+	}
+	return rec, nil
+}
+
+// ErrMixedRecords is returned when writing records of keys and of paths to the
+// same file.
+var ErrMixedRecords = errors.New("records of keys and of paths in the same file")
+
+// Writer writes the records of a data file. Records are buffered, so Flush
+// must be called after the last one. The header of CSV and binary files is
+// written with the first record, and tells whether the records hold keys or
+// paths, so all the records of a file must hold the same.
+type Writer struct {
+	format   Format
+	encoding Encoding
+	header   bool
+	paths    bool
+
+	w   *bufio.Writer
+	csv *csv.Writer
+}
+
+// NewWriter returns a writer of records in the given format, with keys and
+// values in the given encoding for text formats. Paths are always hex.
+func NewWriter(w io.Writer, format Format, encoding Encoding) *Writer {
+	wr := &Writer{format: format, encoding: encoding, w: bufio.NewWriter(w)}
+	if format == CSV {
+		wr.csv = csv.NewWriter(wr.w)
+	}
+	return wr
+}
+
+// Write writes a record.
+func (wr *Writer) Write(rec Record) error {
+	if !wr.header {
+		wr.header = true
+		wr.paths = rec.Path
+		if err := wr.writeHeader(); err != nil {
+			return err
+		}
+	} else if rec.Path != wr.paths {
+		return ErrMixedRecords
+	}
+
+	key := wr.encoding.encode(rec.Key)
+	if rec.Path {
+		key = Hex.encode(rec.Key)
+	}
+	switch wr.format {
+	case CSV:
+		return wr.csv.Write([]string{key, wr.encoding.encode(rec.Value)})
+	case JSONLines:
+		jr := jsonRecord{Key: &key, Value: wr.encoding.encode(rec.Value)}
+		if rec.Path {
+			jr.Key, jr.Path = nil, &key
+		}
+		line, err := json.Marshal(jr)
+		if err != nil {
+			return err
+		}
+		_, err = wr.w.Write(append(line, '\n'))
+		return err
+	default:
+		_, err := wr.w.Write(appendBinaryRecord(nil, rec.Key, rec.Value))
+		return err
+	}
+}
+
+func (wr *Writer) writeHeader() error {
+	switch wr.format {
+	case CSV:
+		name := "key"
+		if wr.paths {
+			name = "path"
+		}
+		return wr.csv.Write([]string{name, "value"})
+	case JSONLines:
+		return nil
+	default:
+		header := append([]byte(binaryMagic), binaryVersion, 0)
+		if wr.paths {
+			header[len(header)-1] = 1
+		}
+		_, err := wr.w.Write(header)
+		return err
+	}
+}
+
+func appendBinaryRecord(data, key, value []byte) []byte {
+	data = appendUvarint(data, uint64(len(key)))
+	data = append(data, key...)
+	data = appendUvarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+func appendUvarint(data []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(data, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+// Flush writes the buffered records.
+func (wr *Writer) Flush() error {
+	if wr.csv != nil {
+		wr.csv.Flush()
+		if err := wr.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return wr.w.Flush()
+}
@@ -0,0 +1,175 @@
+package kvfile
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testRecords = []Record{
+	{Key: []byte("foo"), Value: []byte("bar")},
+	{Key: []byte("comma,key"), Value: []byte("quoted \"value\"\nwith a newline")},
+	{Key: []byte{0, 1, 2}, Value: []byte{}},
+	// A record that looks like a header.
+	{Key: []byte("path"), Value: []byte("value")},
+}
+
+func readAll(rd *Reader) ([]Record, error) {
+	var records []Record
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []Format{CSV, JSONLines, Binary} {
+		for _, encoding := range []Encoding{Hex, UTF8, Base64} {
+			for _, paths := range []bool{false, true} {
+				var buf bytes.Buffer
+				wr := NewWriter(&buf, format, encoding)
+				for _, rec := range testRecords {
+					rec.Path = paths
+					if err := wr.Write(rec); err != nil {
+						t.Fatalf("%v/%v: write returned error: %v", format, encoding, err)
+					}
+				}
+				if err := wr.Flush(); err != nil {
+					t.Fatalf("%v/%v: flush returned error: %v", format, encoding, err)
+				}
+
+				records, err := readAll(NewReader(&buf, format, encoding))
+				if err != nil {
+					t.Fatalf("%v/%v: read returned error: %v", format, encoding, err)
+				}
+				if len(records) != len(testRecords) {
+					t.Fatalf("%v/%v: read %d records, want %d", format, encoding, len(records), len(testRecords))
+				}
+				for i, rec := range records {
+					if !bytes.Equal(rec.Key, testRecords[i].Key) || !bytes.Equal(rec.Value, testRecords[i].Value) || rec.Path != paths {
+						t.Errorf("%v/%v: got record %q: %q, want %q: %q", format, encoding, rec.Key, rec.Value, testRecords[i].Key, testRecords[i].Value)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Test that paths are hex in text formats, whatever the encoding of values.
+func TestWritePaths(t *testing.T) {
+	tests := map[Format]string{
+		CSV:       "path,value\n00ff,YmFy\n",
+		JSONLines: "{\"path\":\"00ff\",\"value\":\"YmFy\"}\n",
+		Binary:    "SMTKV\x01\x01\x02\x00\xff\x03bar",
+	}
+	for format, want := range tests {
+		var buf bytes.Buffer
+		wr := NewWriter(&buf, format, Base64)
+		wr.Write(Record{Key: []byte{0, 0xff}, Value: []byte("bar"), Path: true})
+		if err := wr.Write(Record{Key: []byte("foo"), Value: []byte("bar")}); err != ErrMixedRecords {
+			t.Errorf("%v: got error %v for a key after a path, want %v", format, err, ErrMixedRecords)
+		}
+		wr.Flush()
+		if buf.String() != want {
+			t.Errorf("%v: got %q, want %q", format, buf.String(), want)
+		}
+	}
+}
+
+func TestReadText(t *testing.T) {
+	tests := []struct {
+		format Format
+		data   string
+		want   []Record
+	}{
+		{CSV, "key,value\nfoo,bar\nbaz,qux\n", []Record{{[]byte("foo"), []byte("bar"), false}, {[]byte("baz"), []byte("qux"), false}}},
+		{CSV, "key,value\nkey,value\n", []Record{{[]byte("key"), []byte("value"), false}}},
+		{CSV, "path,value\n6b6579,value\n", []Record{{[]byte("key"), []byte("value"), true}}},
+		{CSV, "", nil},
+		{JSONLines, "{\"key\":\"foo\",\"value\":\"bar\"}\n\n{\"path\":\"0x62617a\",\"value\":\"\"}", []Record{{[]byte("foo"), []byte("bar"), false}, {[]byte("baz"), []byte{}, true}}},
+		{Binary, "SMTKV\x01\x00\x03foo\x03bar", []Record{{[]byte("foo"), []byte("bar"), false}}},
+		{Binary, "SMTKV\x01\x00\x04path\x05value", []Record{{[]byte("path"), []byte("value"), false}}},
+		{Binary, "SMTKV\x01\x01\x03foo\x00", []Record{{[]byte("foo"), []byte{}, true}}},
+		{Binary, "", nil},
+	}
+	for _, test := range tests {
+		records, err := readAll(NewReader(strings.NewReader(test.data), test.format, UTF8))
+		if err != nil {
+			t.Errorf("%v %q: returned error: %v", test.format, test.data, err)
+		}
+		if !reflect.DeepEqual(records, test.want) {
+			t.Errorf("%v %q: got records %+v, want %+v", test.format, test.data, records, test.want)
+		}
+	}
+}
+
+func TestBadRecords(t *testing.T) {
+	tests := []struct {
+		format   Format
+		encoding Encoding
+		data     string
+	}{
+		{CSV, Hex, "key,value\n00,01\nzz,01\n"},
+		{CSV, UTF8, "key,value\nfoo,bar,baz\n"},
+		{CSV, UTF8, "path,value\nfoo,bar\n"},
+		{JSONLines, UTF8, "{\"value\":\"bar\"}\n"},
+		{JSONLines, UTF8, "not json\n"},
+		{JSONLines, Base64, "{\"key\":\"!\",\"value\":\"\"}\n"},
+		{Binary, Hex, "SMTKV\x01\x00\x03foo"},
+		{Binary, Hex, "SMTKV\x01\x00\x03foo\x03ba"},
+		{Binary, Hex, "SMTKV\x01\x00\xff\xff\xff\xff\x0f"},
+	}
+	for _, test := range tests {
+		_, err := readAll(NewReader(strings.NewReader(test.data), test.format, test.encoding))
+		if !errors.Is(err, ErrBadRecord) {
+			t.Errorf("%v %q: got error %v, want %v", test.format, test.data, err, ErrBadRecord)
+		}
+	}
+}
+
+func TestBadHeaders(t *testing.T) {
+	tests := []struct {
+		format Format
+		data   string
+	}{
+		{CSV, "foo,bar\n"},
+		{CSV, "key,val\nfoo,bar\n"},
+		{Binary, "\x03foo\x03bar"},
+		{Binary, "SMTKV"},
+		{Binary, "SMTKV\x02\x00"},
+		{Binary, "SMTKV\x01\x02"},
+	}
+	for _, test := range tests {
+		_, err := readAll(NewReader(strings.NewReader(test.data), test.format, UTF8))
+		if !errors.Is(err, ErrBadHeader) {
+			t.Errorf("%v %q: got error %v, want %v", test.format, test.data, err, ErrBadHeader)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, format := range []Format{CSV, JSONLines, Binary} {
+		if parsed, err := ParseFormat(format.String()); err != nil || parsed != format {
+			t.Errorf("got format %v for %q, want %v: %v", parsed, format.String(), format, err)
+		}
+	}
+	for _, encoding := range []Encoding{Hex, UTF8, Base64} {
+		if parsed, err := ParseEncoding(encoding.String()); err != nil || parsed != encoding {
+			t.Errorf("got encoding %v for %q, want %v: %v", parsed, encoding.String(), encoding, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("did not return an error for an unknown format")
+	}
+	if _, err := ParseEncoding("ascii"); err == nil {
+		t.Error("did not return an error for an unknown encoding")
+	}
+}
@@ -0,0 +1,119 @@
+package kvfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultBatchSize is the number of records imported per batch into trees
+// supporting batch updates, when no batch size is given.
+const DefaultBatchSize = 1000
+
+// Updater is a tree that records can be imported into, such as a
+// SparseMerkleTree, a ClassicSparseMerkleTree or a PatriciaTrie.
+type Updater interface {
+	Root() []byte
+	Update(key []byte, value []byte) ([]byte, error)
+}
+
+// BatchUpdater is an Updater that can update several keys at once, such as a
+// SparseMerkleTree.
+type BatchUpdater interface {
+	Updater
+	UpdateBatch(keys [][]byte, values [][]byte) ([]byte, error)
+}
+
+// PathKeyed is a tree that tells whether it uses its keys as paths, such as a
+// SparseMerkleTree.
+type PathKeyed interface {
+	KeysArePaths() bool
+}
+
+// ErrPathRecords is returned when importing records holding paths, such as
+// those of exported files, into a tree that does not use its keys as paths.
+// Their paths would be hashed again as keys.
+var ErrPathRecords = errors.New("records hold paths, which can only be imported into trees using keys as paths")
+
+// LeafIterator is a tree whose leaves can be exported, such as a
+// SparseMerkleTree.
+type LeafIterator interface {
+	IterateLeaves(fn func(path, value []byte) error) error
+}
+
+// Import updates a tree with every record read from rd, and returns the new
+// root of the tree and the number of records imported. Records with empty
+// values delete their keys. Trees implementing BatchUpdater are updated in
+// batches of batchSize records, or DefaultBatchSize if batchSize is not
+// positive; other trees are updated record by record. Records holding paths
+// are only imported into PathKeyed trees using their keys as paths, and
+// otherwise return ErrPathRecords.
+//
+// If an error occurs, the records before it may have been imported.
+func Import(tree Updater, rd *Reader, batchSize int) ([]byte, int, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	batcher, batched := tree.(BatchUpdater)
+	pathKeyed, ok := tree.(PathKeyed)
+	keysArePaths := ok && pathKeyed.KeysArePaths()
+	root := tree.Root()
+
+	var keys, values [][]byte
+	flush := func() error {
+		if len(keys) == 0 {
+			return nil
+		}
+		var err error
+		root, err = batcher.UpdateBatch(keys, values)
+		keys, values = keys[:0], values[:0]
+		return err
+	}
+
+	n := 0
+	for {
+		rec, err := rd.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, n, err
+		}
+		if rec.Path && !keysArePaths {
+			return nil, n, fmt.Errorf("record %d: %w", rd.n, ErrPathRecords)
+		}
+		if !batched {
+			if root, err = tree.Update(rec.Key, rec.Value); err != nil {
+				return nil, n, err
+			}
+			n++
+			continue
+		}
+		keys, values = append(keys, rec.Key), append(values, rec.Value)
+		if len(keys) == batchSize {
+			if err := flush(); err != nil {
+				return nil, n, err
+			}
+			n += batchSize
+		}
+	}
+	pending := len(keys)
+	if err := flush(); err != nil {
+		return nil, n, err
+	}
+	return root, n + pending, nil
+}
+
+// Export writes a record with the path and the value of every leaf of a tree
+// to wr, in the order of the leaves, flushes wr, and returns the number of
+// records written.
+func Export(tree LeafIterator, wr *Writer) (int, error) {
+	n := 0
+	err := tree.IterateLeaves(func(path, value []byte) error {
+		n++
+		return wr.Write(Record{Key: path, Value: value, Path: true})
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, wr.Flush()
+}
@@ -0,0 +1,95 @@
+package kvfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"MPT_MOI/smt-master"
+)
+
+// sequentialTree hides the batch updates of a tree.
+type sequentialTree struct {
+	Updater
+}
+
+func TestImport(t *testing.T) {
+	var data strings.Builder
+	data.WriteString("key,value\n")
+	expected := smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New())
+	for i := 0; i < 25; i++ {
+		fmt.Fprintf(&data, "key%d,value%d\n", i, i)
+		expected.Update([]byte(fmt.Sprintf("key%d", i)), []byte(fmt.Sprintf("value%d", i)))
+	}
+	// Empty values delete keys.
+	data.WriteString("key3,\n")
+	expected.Delete([]byte("key3"))
+
+	for _, batchSize := range []int{0, 1, 7, 26} {
+		tree := smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New())
+		root, n, err := Import(tree, NewReader(strings.NewReader(data.String()), CSV, UTF8), batchSize)
+		if err != nil {
+			t.Fatalf("batch size %d: returned error: %v", batchSize, err)
+		}
+		if n != 26 {
+			t.Errorf("batch size %d: imported %d records, want 26", batchSize, n)
+		}
+		if !bytes.Equal(root, expected.Root()) || !bytes.Equal(tree.Root(), expected.Root()) {
+			t.Errorf("batch size %d: got root %x, want %x", batchSize, root, expected.Root())
+		}
+	}
+
+	tree := smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New())
+	root, n, err := Import(sequentialTree{tree}, NewReader(strings.NewReader(data.String()), CSV, UTF8), 0)
+	if err != nil || n != 26 || !bytes.Equal(root, expected.Root()) {
+		t.Errorf("got root %x and %d records without batches, want %x and 26: %v", root, n, expected.Root(), err)
+	}
+
+	// Records before a bad record are imported.
+	tree = smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New())
+	_, n, err = Import(sequentialTree{tree}, NewReader(strings.NewReader("key,value\nfoo,bar\nbaz\n"), CSV, UTF8), 0)
+	if err == nil || n != 1 {
+		t.Errorf("got %d records and error %v for a bad second record, want 1 and an error", n, err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	tree := smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New(), smt.RawKeys())
+	for i := 0; i < 10; i++ {
+		key := sha256.Sum256([]byte{byte(i)})
+		tree.Update(key[:], []byte{byte(i), byte(i)})
+	}
+
+	for _, format := range []Format{CSV, JSONLines, Binary} {
+		var buf bytes.Buffer
+		n, err := Export(tree, NewWriter(&buf, format, Hex))
+		if err != nil || n != 10 {
+			t.Fatalf("%v: exported %d records, want 10: %v", format, n, err)
+		}
+		exported := buf.Bytes()
+
+		// Paths would be hashed again by a tree hashing its keys.
+		hashed := smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New())
+		_, n, err = Import(hashed, NewReader(bytes.NewReader(exported), format, Hex), 0)
+		if !errors.Is(err, ErrPathRecords) || n != 0 {
+			t.Errorf("%v: got %d records and error %v importing paths into a hashed tree, want 0 and %v", format, n, err, ErrPathRecords)
+		}
+		if _, n, err = Import(sequentialTree{hashed}, NewReader(bytes.NewReader(exported), format, Hex), 0); !errors.Is(err, ErrPathRecords) {
+			t.Errorf("%v: got error %v importing paths into a tree without paths, want %v", format, err, ErrPathRecords)
+		}
+
+		// Paths are keys with RawKeys, so the export imports back to the
+		// same tree.
+		imported := smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New(), smt.RawKeys())
+		root, n, err := Import(imported, NewReader(&buf, format, Hex), 0)
+		if err != nil || n != 10 {
+			t.Fatalf("%v: imported %d records, want 10: %v", format, n, err)
+		}
+		if !bytes.Equal(root, tree.Root()) {
+			t.Errorf("%v: got root %x after a round trip, want %x", format, root, tree.Root())
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package lightclient reads a remote tree served by smthttp without trusting
+// the server: every value is returned only once its compact proof verifies
+// against a root trusted by the client.
+package lightclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"sync"
+
+	"MPT_MOI/smt-master"
+	"MPT_MOI/smthttp"
+)
+
+// Prover is a server of compact proofs, such as an smthttp.Client.
+type Prover interface {
+	ProveCompact(ctx context.Context, key []byte) (*smthttp.ProveCompactResponse, error)
+}
+
+// VerificationError is returned when a response of the server is inconsistent
+// with the trusted root.
+type VerificationError struct {
+	// Key is the requested key.
+	Key []byte
+	// TrustedRoot is the root trusted by the client.
+	TrustedRoot []byte
+	// ServerRoot is the root claimed by the server.
+	ServerRoot []byte
+	// Reason describes the inconsistency.
+	Reason string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("unverified response for key %x: %s", e.Key, e.Reason)
+}
+
+// Client reads the values of keys from a remote tree, verifying them against a
+// trusted root. It is safe for concurrent use.
+type Client struct {
+	remote  Prover
+	options []smt.Option
+
+	mu     sync.Mutex
+	hasher hash.Hash
+	root   []byte
+}
+
+// New returns a client reading from remote, which trusts root. The hash
+// function and the options must be the ones of the remote tree.
+func New(remote Prover, root []byte, hasher hash.Hash, options ...smt.Option) *Client {
+	return &Client{remote: remote, options: options, hasher: hasher, root: root}
+}
+
+// Root returns the trusted root.
+func (c *Client) Root() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.root
+}
+
+// SetRoot trusts a new root, such as one published by the owner of the tree
+// after an update.
+func (c *Client) SetRoot(root []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.root = root
+}
+
+// Get returns the value of a key, which is empty if the key is absent. It
+// requests the value with a compact proof, and returns a *VerificationError if
+// the server answers for another root or key, or if the proof does not verify
+// the value against the trusted root.
+func (c *Client) Get(ctx context.Context, key []byte) ([]byte, error) {
+	resp, err := c.remote.ProveCompact(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	verificationError := func(reason string) error {
+		return &VerificationError{Key: key, TrustedRoot: c.root, ServerRoot: resp.Root, Reason: reason}
+	}
+	if !bytes.Equal(resp.Root, c.root) {
+		return nil, verificationError(fmt.Sprintf("server root %x differs from the trusted root %x", []byte(resp.Root), c.root))
+	}
+	if !bytes.Equal(resp.Key, key) {
+		return nil, verificationError(fmt.Sprintf("response is for key %x", []byte(resp.Key)))
+	}
+	if resp.Proof == nil {
+		return nil, verificationError("response has no proof")
+	}
+	if !smt.VerifyCompactProof(resp.Proof.SparseCompactMerkleProof(), c.root, key, resp.Value, c.hasher, c.options...) {
+		return nil, verificationError("proof does not verify the value")
+	}
+	return resp.Value, nil
+}
+
+// Has returns whether a key is present, verified as with Get.
+func (c *Client) Has(ctx context.Context, key []byte) (bool, error) {
+	value, err := c.Get(ctx, key)
+	return len(value) != 0, err
+}
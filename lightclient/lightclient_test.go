@@ -0,0 +1,103 @@
+package lightclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"MPT_MOI/smt-master"
+	"MPT_MOI/smthttp"
+)
+
+// tamperingProver modifies the responses of a server.
+type tamperingProver struct {
+	Prover
+	tamper func(resp *smthttp.ProveCompactResponse)
+}
+
+func (p tamperingProver) ProveCompact(ctx context.Context, key []byte) (*smthttp.ProveCompactResponse, error) {
+	resp, err := p.Prover.ProveCompact(ctx, key)
+	if err == nil {
+		p.tamper(resp)
+	}
+	return resp, err
+}
+
+func TestClient(t *testing.T) {
+	tree := smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New())
+	tree.Update([]byte("foo"), []byte("bar"))
+	tree.Update([]byte("baz"), []byte("qux"))
+	ts := httptest.NewServer(smthttp.NewServer(tree))
+	defer ts.Close()
+	remote := smthttp.NewClient(ts.URL, nil)
+	ctx := context.Background()
+
+	c := New(remote, tree.Root(), sha256.New())
+	if value, err := c.Get(ctx, []byte("foo")); err != nil || string(value) != "bar" {
+		t.Errorf("got value %q, want bar: %v", value, err)
+	}
+	if has, err := c.Has(ctx, []byte("absent")); err != nil || has {
+		t.Errorf("got presence %v for an absent key: %v", has, err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(resp *smthttp.ProveCompactResponse)
+	}{
+		{"value", func(resp *smthttp.ProveCompactResponse) { resp.Value = []byte("evil") }},
+		{"absent value", func(resp *smthttp.ProveCompactResponse) { resp.Value = nil }},
+		{"key", func(resp *smthttp.ProveCompactResponse) { resp.Key = []byte("baz") }},
+		{"root", func(resp *smthttp.ProveCompactResponse) { resp.Root = make([]byte, 32) }},
+		{"side node", func(resp *smthttp.ProveCompactResponse) { resp.Proof.SideNodes[0][0] ^= 1 }},
+		{"side nodes", func(resp *smthttp.ProveCompactResponse) { resp.Proof.NumSideNodes = 1000 }},
+		{"no proof", func(resp *smthttp.ProveCompactResponse) { resp.Proof = nil }},
+	}
+	for _, test := range tests {
+		tampered := New(tamperingProver{remote, test.tamper}, tree.Root(), sha256.New())
+		value, err := tampered.Get(ctx, []byte("foo"))
+		var verificationError *VerificationError
+		if !errors.As(err, &verificationError) {
+			t.Errorf("%s: got value %q and error %v, want a verification error", test.name, value, err)
+			continue
+		}
+		if !bytes.Equal(verificationError.Key, []byte("foo")) || !bytes.Equal(verificationError.TrustedRoot, tree.Root()) {
+			t.Errorf("%s: got error %+v", test.name, verificationError)
+		}
+	}
+
+	// The server moves to a root the client does not trust yet.
+	tree.Update([]byte("foo"), []byte("new"))
+	if _, err := c.Get(ctx, []byte("foo")); !errors.As(err, new(*VerificationError)) {
+		t.Errorf("got error %v for an untrusted root, want a verification error", err)
+	}
+	c.SetRoot(tree.Root())
+	if value, err := c.Get(ctx, []byte("foo")); err != nil || string(value) != "new" {
+		t.Errorf("got value %q after trusting the new root, want new: %v", value, err)
+	}
+
+	// Errors of the server are returned as such.
+	if _, err := New(smthttp.NewClient(ts.URL+"/missing", nil), tree.Root(), sha256.New()).Get(ctx, []byte("foo")); !errors.As(err, new(*smthttp.Error)) {
+		t.Errorf("got error %v for a failed request, want a server error", err)
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	options := []smt.Option{smt.RawKeys(), smt.Depth(16)}
+	tree := smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New(), options...)
+	tree.Update([]byte{1, 2}, []byte("a"))
+	ts := httptest.NewServer(smthttp.NewServer(tree))
+	defer ts.Close()
+
+	c := New(smthttp.NewClient(ts.URL, nil), tree.Root(), sha256.New(), options...)
+	if value, err := c.Get(context.Background(), []byte{1, 2}); err != nil || string(value) != "a" {
+		t.Errorf("got value %q, want a: %v", value, err)
+	}
+	// Without the options of the tree, proofs do not verify.
+	c = New(smthttp.NewClient(ts.URL, nil), tree.Root(), sha256.New())
+	if _, err := c.Get(context.Background(), []byte{1, 2}); !errors.As(err, new(*VerificationError)) {
+		t.Errorf("got error %v without the options of the tree, want a verification error", err)
+	}
+}
@@ -0,0 +1,36 @@
+package mpt
+
+import (
+	"crypto/sha256"
+	"strconv"
+	"testing"
+
+	smt "MPT_MOI/smt-master"
+)
+
+func BenchmarkPatriciaTrie_Update(b *testing.B) {
+	trie := NewPatriciaTrie(smt.NewSimpleMap(), sha256.New())
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s := strconv.Itoa(i)
+		_, _ = trie.Update([]byte(s), []byte(s))
+	}
+}
+
+func BenchmarkPatriciaTrie_Delete(b *testing.B) {
+	trie := NewPatriciaTrie(smt.NewSimpleMap(), sha256.New())
+
+	for i := 0; i < 100000; i++ {
+		s := strconv.Itoa(i)
+		_, _ = trie.Update([]byte(s), []byte(s))
+	}
+
+	b.ResetTimer()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s := strconv.Itoa(i)
+		_, _ = trie.Delete([]byte(s))
+	}
+}
@@ -0,0 +1,87 @@
+package mpt
+
+// Keys are handled in three encodings:
+//
+// KEYBYTES is the plain key as given by the caller.
+//
+// HEX has one nibble of the key per byte, followed by an optional terminator
+// nibble of value 16 marking a key that ends at a value. This is the encoding
+// of keys of nodes held in memory, as it makes descending the trie simple.
+//
+// COMPACT is the hex-prefix encoding of a HEX key, which packs two nibbles per
+// byte and records whether the key had a terminator and whether its length was
+// odd in the high nibble of the first byte. This is the encoding of keys of
+// nodes held in the store.
+
+const terminator = 16
+
+func keybytesToHex(str []byte) []byte {
+	l := len(str)*2 + 1
+	nibbles := make([]byte, l)
+	for i, b := range str {
+		nibbles[i*2] = b / 16
+		nibbles[i*2+1] = b % 16
+	}
+	nibbles[l-1] = terminator
+	return nibbles
+}
+
+func hexToCompact(hex []byte) []byte {
+	flags := byte(0)
+	if hasTerm(hex) {
+		flags = 1 << 1
+		hex = hex[:len(hex)-1]
+	}
+	buf := make([]byte, len(hex)/2+1)
+	if len(hex)&1 == 1 {
+		flags |= 1
+		buf[0] = hex[0]
+		hex = hex[1:]
+	}
+	buf[0] |= flags << 4
+	decodeNibbles(hex, buf[1:])
+	return buf
+}
+
+// compactToHex decodes a COMPACT key, returning false if the flags are invalid.
+func compactToHex(compact []byte) ([]byte, bool) {
+	if len(compact) == 0 {
+		return nil, false
+	}
+	flags := compact[0] >> 4
+	if flags > 3 || (flags&1 == 0 && compact[0]&0x0f != 0) {
+		return nil, false
+	}
+	base := keybytesToHex(compact)
+	// Drop the terminator unless the key has one.
+	if flags&2 == 0 {
+		base = base[:len(base)-1]
+	}
+	// Drop the flags nibble, and the padding nibble of even length keys.
+	chop := 2 - flags&1
+	return base[chop:], true
+}
+
+func decodeNibbles(nibbles []byte, bytes []byte) {
+	for bi, ni := 0, 0; ni < len(nibbles); bi, ni = bi+1, ni+2 {
+		bytes[bi] = nibbles[ni]<<4 | nibbles[ni+1]
+	}
+}
+
+// prefixLen returns the length of the common prefix of a and b.
+func prefixLen(a, b []byte) int {
+	i, length := 0, len(a)
+	if len(b) < length {
+		length = len(b)
+	}
+	for ; i < length; i++ {
+		if a[i] != b[i] {
+			break
+		}
+	}
+	return i
+}
+
+func hasTerm(s []byte) bool {
+	return len(s) > 0 && s[len(s)-1] == terminator
+}
@@ -0,0 +1,44 @@
+package mpt
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHexCompact(t *testing.T) {
+	tests := []struct{ hex, compact []byte }{
+		// Empty keys, with and without terminator.
+		{hex: []byte{}, compact: []byte{0x00}},
+		{hex: []byte{16}, compact: []byte{0x20}},
+		// Odd length, no terminator.
+		{hex: []byte{1, 2, 3, 4, 5}, compact: []byte{0x11, 0x23, 0x45}},
+		// Even length, no terminator.
+		{hex: []byte{0, 1, 2, 3, 4, 5}, compact: []byte{0x00, 0x01, 0x23, 0x45}},
+		// Odd length, terminator.
+		{hex: []byte{15, 1, 12, 11, 8, 16}, compact: []byte{0x3f, 0x1c, 0xb8}},
+		// Even length, terminator.
+		{hex: []byte{0, 15, 1, 12, 11, 8, 16}, compact: []byte{0x20, 0x0f, 0x1c, 0xb8}},
+	}
+	for _, test := range tests {
+		if c := hexToCompact(test.hex); !bytes.Equal(c, test.compact) {
+			t.Errorf("hexToCompact(%x) -> %x, want %x", test.hex, c, test.compact)
+		}
+		h, ok := compactToHex(test.compact)
+		if !ok || !bytes.Equal(h, test.hex) {
+			t.Errorf("compactToHex(%x) -> %x, want %x", test.compact, h, test.hex)
+		}
+	}
+
+	for _, invalid := range [][]byte{{}, {0x40}, {0x01}, {0x25, 0x12}} {
+		if _, ok := compactToHex(invalid); ok {
+			t.Errorf("compactToHex(%x) accepted invalid flags", invalid)
+		}
+	}
+}
+
+func TestKeybytesToHex(t *testing.T) {
+	hex := keybytesToHex([]byte{0x12, 0x34, 0x5f})
+	if !bytes.Equal(hex, []byte{1, 2, 3, 4, 5, 15, 16}) {
+		t.Errorf("unexpected hex key: %x", hex)
+	}
+}
@@ -0,0 +1,170 @@
+package mpt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"MPT_MOI/rlp"
+)
+
+type node interface{}
+
+type (
+	// fullNode is a branch node, with a child for each nibble and a value for
+	// the key ending at the node.
+	fullNode struct {
+		Children [17]node
+	}
+	// shortNode is a leaf node if its key has a terminator, and an extension
+	// node otherwise.
+	shortNode struct {
+		Key []byte
+		Val node
+	}
+	// hashNode is a reference to a node in the store by its digest.
+	hashNode []byte
+	// valueNode is the value of a key.
+	valueNode []byte
+)
+
+// ErrBadNode is returned when a node cannot be decoded.
+var ErrBadNode = errors.New("bad trie node")
+
+// emptyNode is the encoding of the empty trie.
+var emptyNode = rlp.EncodeBytes(nil)
+
+func (n *fullNode) copy() *fullNode {
+	c := *n
+	return &c
+}
+
+// encodeNode RLP-encodes a collapsed node, whose keys are COMPACT and whose
+// children are hashNodes or embedded collapsed nodes. The empty trie is
+// encoded as the empty string.
+func encodeNode(n node) []byte {
+	switch n := n.(type) {
+	case nil:
+		return emptyNode
+	case *shortNode:
+		return rlp.EncodeList(rlp.EncodeBytes(n.Key), encodeRef(n.Val))
+	case *fullNode:
+		items := make([][]byte, len(n.Children))
+		for i, child := range n.Children {
+			items[i] = encodeRef(child)
+		}
+		return rlp.EncodeList(items...)
+	default:
+		panic(fmt.Sprintf("can't encode node of type %T", n))
+	}
+}
+
+// encodeRef encodes a child of a node: digests and values as strings, and
+// embedded nodes as they are.
+func encodeRef(n node) []byte {
+	switch n := n.(type) {
+	case nil:
+		return rlp.EncodeBytes(nil)
+	case hashNode:
+		return rlp.EncodeBytes(n)
+	case valueNode:
+		return rlp.EncodeBytes(n)
+	default:
+		return encodeNode(n)
+	}
+}
+
+// decodeNode decodes a stored node into a node with HEX keys. References to
+// other nodes must be digests of hashLen bytes. The encoding of the empty trie
+// decodes to nil.
+func decodeNode(data []byte, hashLen int) (node, error) {
+	if bytes.Equal(data, emptyNode) {
+		return nil, nil
+	}
+	content, rest, err := rlp.SplitList(data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadNode, err)
+	}
+	if len(rest) != 0 {
+		return nil, ErrBadNode
+	}
+	count, err := rlp.CountValues(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadNode, err)
+	}
+	switch count {
+	case 2:
+		return decodeShort(content, hashLen)
+	case 17:
+		return decodeFull(content, hashLen)
+	default:
+		return nil, fmt.Errorf("%w: invalid number of list elements: %d", ErrBadNode, count)
+	}
+}
+
+func decodeShort(content []byte, hashLen int) (node, error) {
+	compact, rest, err := rlp.SplitString(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadNode, err)
+	}
+	key, ok := compactToHex(compact)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid key flags", ErrBadNode)
+	}
+	if hasTerm(key) {
+		value, _, err := rlp.SplitString(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBadNode, err)
+		}
+		return &shortNode{Key: key, Val: valueNode(value)}, nil
+	}
+	val, _, err := decodeRef(rest, hashLen)
+	if err != nil {
+		return nil, err
+	}
+	if val == nil {
+		return nil, fmt.Errorf("%w: empty extension node", ErrBadNode)
+	}
+	return &shortNode{Key: key, Val: val}, nil
+}
+
+func decodeFull(content []byte, hashLen int) (node, error) {
+	n := &fullNode{}
+	var err error
+	for i := 0; i < 16; i++ {
+		if n.Children[i], content, err = decodeRef(content, hashLen); err != nil {
+			return nil, err
+		}
+	}
+	value, _, err := rlp.SplitString(content)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadNode, err)
+	}
+	if len(value) > 0 {
+		n.Children[16] = valueNode(value)
+	}
+	return n, nil
+}
+
+func decodeRef(data []byte, hashLen int) (node, []byte, error) {
+	kind, content, rest, err := rlp.Split(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrBadNode, err)
+	}
+	switch {
+	case kind == rlp.List:
+		// Embedded nodes must be shorter than a digest.
+		size := len(data) - len(rest)
+		if size >= hashLen {
+			return nil, nil, fmt.Errorf("%w: oversized embedded node (size %d, want < %d)", ErrBadNode, size, hashLen)
+		}
+		n, err := decodeNode(data[:size], hashLen)
+		return n, rest, err
+	case len(content) == 0:
+		return nil, rest, nil
+	case len(content) == hashLen:
+		return hashNode(content), rest, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: invalid digest size %d", ErrBadNode, len(content))
+	}
+}
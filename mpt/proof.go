@@ -0,0 +1,116 @@
+package mpt
+
+import (
+	"bytes"
+	"hash"
+
+	"MPT_MOI/rlp"
+)
+
+// Proof is a Merkle proof for a key in a PatriciaTrie. It is the list of the
+// stored nodes on the path of the key, starting at the root. Nodes embedded in
+// their parent are not listed separately.
+type Proof [][]byte
+
+// EncodeProof encodes a proof as the RLP list of its nodes.
+func EncodeProof(proof Proof) []byte {
+	return rlp.EncodeList(proof...)
+}
+
+// DecodeProof decodes a proof encoded by EncodeProof.
+func DecodeProof(data []byte) (Proof, error) {
+	content, rest, err := rlp.SplitList(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, rlp.ErrMoreThanOneValue
+	}
+	var proof Proof
+	for len(content) > 0 {
+		var item rlp.RawValue
+		if item, content, err = rlp.SplitRaw(content); err != nil {
+			return nil, err
+		}
+		proof = append(proof, item)
+	}
+	return proof, nil
+}
+
+// Prove generates a Merkle proof for a key against the current root. The proof
+// shows either the value of the key, or that the key is not in the trie.
+func (t *PatriciaTrie) Prove(key []byte) (Proof, error) {
+	return t.ProveForRoot(key, t.Root())
+}
+
+// ProveForRoot generates a Merkle proof for a key against a specific root.
+func (t *PatriciaTrie) ProveForRoot(key []byte, root []byte) (Proof, error) {
+	var proof Proof
+	if bytes.Equal(root, t.emptyRoot()) {
+		return Proof{encodeNode(nil)}, nil
+	}
+
+	var n node = hashNode(root)
+	path := keybytesToHex(key)
+	for {
+		if h, ok := n.(hashNode); ok {
+			data, err := t.nodes.Get(h)
+			if err != nil {
+				return nil, err
+			}
+			proof = append(proof, data)
+			if n, err = decodeNode(data, t.hasher.Size()); err != nil {
+				return nil, err
+			}
+		}
+		switch nn := n.(type) {
+		case *shortNode:
+			if len(path) < len(nn.Key) || !bytes.Equal(nn.Key, path[:len(nn.Key)]) {
+				return proof, nil
+			}
+			n, path = nn.Val, path[len(nn.Key):]
+		case *fullNode:
+			n, path = nn.Children[path[0]], path[1:]
+		default:
+			return proof, nil
+		}
+	}
+}
+
+// VerifyProof verifies a Merkle proof for a key and value against a root. A
+// proof of the default (empty) value shows that the key is not in the trie.
+func VerifyProof(proof Proof, root []byte, key []byte, value []byte, hasher hash.Hash) bool {
+	t := &PatriciaTrie{hasher: hasher}
+	nodes := make(map[string][]byte, len(proof))
+	for _, data := range proof {
+		nodes[string(t.digest(data))] = data
+	}
+
+	var n node = hashNode(root)
+	path := keybytesToHex(key)
+	for {
+		if h, ok := n.(hashNode); ok {
+			data, ok := nodes[string(h)]
+			if !ok {
+				return false
+			}
+			var err error
+			if n, err = decodeNode(data, t.hasher.Size()); err != nil {
+				return false
+			}
+		}
+		switch nn := n.(type) {
+		case nil:
+			return bytes.Equal(value, defaultValue)
+		case valueNode:
+			return bytes.Equal(value, nn)
+		case *shortNode:
+			if len(path) < len(nn.Key) || !bytes.Equal(nn.Key, path[:len(nn.Key)]) {
+				return bytes.Equal(value, defaultValue)
+			}
+			n, path = nn.Val, path[len(nn.Key):]
+		case *fullNode:
+			n, path = nn.Children[path[0]], path[1:]
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"MPT_MOI/rlp"
+	smt "MPT_MOI/smt-master"
+)
+
+// Test base case Merkle proof operations.
+func TestPatriciaTrieProofs(t *testing.T) {
+	trie := NewPatriciaTrie(smt.NewSimpleMap(), sha256.New())
+
+	proof, err := trie.Prove([]byte("testKey"))
+	if err != nil {
+		t.Errorf("returned error when proving key in empty trie: %v", err)
+	}
+	if !VerifyProof(proof, trie.Root(), []byte("testKey"), defaultValue, sha256.New()) {
+		t.Error("valid proof on empty trie failed to verify")
+	}
+
+	kv := map[string]string{
+		"do":    "verb",
+		"dog":   "puppy",
+		"doge":  "coin",
+		"horse": "stallion",
+		"h":     "a value that is long enough not to be embedded in its parent",
+	}
+	for k, v := range kv {
+		trie.Update([]byte(k), []byte(v))
+	}
+	root := trie.Root()
+
+	for k, v := range kv {
+		proof, err = trie.Prove([]byte(k))
+		if err != nil {
+			t.Errorf("returned error when proving key: %v", err)
+		}
+		if !VerifyProof(proof, root, []byte(k), []byte(v), sha256.New()) {
+			t.Errorf("valid proof for key %q failed to verify", k)
+		}
+		if VerifyProof(proof, root, []byte(k), []byte("badValue"), sha256.New()) {
+			t.Error("invalid proof verification returned true")
+		}
+		if VerifyProof(proof, root, []byte(k), defaultValue, sha256.New()) {
+			t.Error("non-membership proof verification of a present key returned true")
+		}
+	}
+
+	for _, k := range []string{"d", "dogs", "cat", "horses", ""} {
+		proof, err = trie.Prove([]byte(k))
+		if err != nil {
+			t.Errorf("returned error when proving absent key: %v", err)
+		}
+		if !VerifyProof(proof, root, []byte(k), defaultValue, sha256.New()) {
+			t.Errorf("valid non-membership proof for key %q failed to verify", k)
+		}
+		if VerifyProof(proof, root, []byte(k), []byte("verb"), sha256.New()) {
+			t.Error("invalid proof verification returned true")
+		}
+	}
+
+	// Tamper with the proof.
+	proof, _ = trie.Prove([]byte("doge"))
+	tampered := make(Proof, len(proof))
+	for i := range proof {
+		tampered[i] = append([]byte{}, proof[i]...)
+	}
+	last := tampered[len(tampered)-1]
+	last[len(last)-1] ^= 0xff
+	if VerifyProof(tampered, root, []byte("doge"), []byte("coin"), sha256.New()) {
+		t.Error("tampered proof verification returned true")
+	}
+	if len(proof) > 1 && VerifyProof(proof[:len(proof)-1], root, []byte("doge"), []byte("coin"), sha256.New()) {
+		t.Error("truncated proof verification returned true")
+	}
+	if VerifyProof(proof, bytes.Repeat([]byte{1}, 32), []byte("doge"), []byte("coin"), sha256.New()) {
+		t.Error("proof verification against the wrong root returned true")
+	}
+}
+
+func TestPatriciaTrieProofEncoding(t *testing.T) {
+	trie := NewPatriciaTrie(smt.NewSimpleMap(), sha256.New())
+
+	proof, _ := trie.Prove([]byte("testKey"))
+	decoded, err := DecodeProof(EncodeProof(proof))
+	if err != nil {
+		t.Fatalf("returned error when decoding proof: %v", err)
+	}
+	if !VerifyProof(decoded, trie.Root(), []byte("testKey"), defaultValue, sha256.New()) {
+		t.Error("decoded proof on empty trie failed to verify")
+	}
+
+	trie.Update([]byte("do"), []byte("verb"))
+	trie.Update([]byte("dog"), []byte("puppy"))
+	trie.Update([]byte("horse"), []byte("a value that is long enough not to be embedded in its parent"))
+	proof, _ = trie.Prove([]byte("dog"))
+	decoded, err = DecodeProof(EncodeProof(proof))
+	if err != nil {
+		t.Fatalf("returned error when decoding proof: %v", err)
+	}
+	if len(decoded) != len(proof) {
+		t.Fatalf("decoded proof has %d nodes, want %d", len(decoded), len(proof))
+	}
+	for i := range proof {
+		if !bytes.Equal(decoded[i], proof[i]) {
+			t.Errorf("decoded proof node %d differs", i)
+		}
+	}
+	if !VerifyProof(decoded, trie.Root(), []byte("dog"), []byte("puppy"), sha256.New()) {
+		t.Error("decoded proof failed to verify")
+	}
+
+	encoded := EncodeProof(proof)
+	if _, err = DecodeProof(encoded[:len(encoded)-1]); err == nil {
+		t.Error("did not return an error when decoding a truncated proof")
+	}
+	if _, err = DecodeProof(append(encoded, 0x80)); err == nil {
+		t.Error("did not return an error when decoding a proof with trailing data")
+	}
+}
+
+// Test that malformed nodes are rejected rather than misinterpreted.
+func TestDecodeNodeInvalid(t *testing.T) {
+	hash := bytes.Repeat([]byte{1}, 32)
+	tests := map[string][]byte{
+		"string":           rlp.EncodeBytes([]byte("dog")),
+		"three items":      rlp.EncodeList(rlp.EncodeBytes(nil), rlp.EncodeBytes(nil), rlp.EncodeBytes(nil)),
+		"bad key flags":    rlp.EncodeList(rlp.EncodeBytes([]byte{0x40}), rlp.EncodeBytes(hash)),
+		"short digest":     rlp.EncodeList(rlp.EncodeBytes([]byte{0x00, 0x12}), rlp.EncodeBytes(hash[:20])),
+		"empty extension":  rlp.EncodeList(rlp.EncodeBytes([]byte{0x00, 0x12}), rlp.EncodeBytes(nil)),
+		"trailing data":    append(rlp.EncodeList(rlp.EncodeBytes([]byte{0x20}), rlp.EncodeBytes(hash)), 0x80),
+		"non-canonical":    rlp.EncodeList(rlp.EncodeBytes([]byte{0x20}), []byte{0x81, 0x01}),
+		"oversized inline": rlp.EncodeList(rlp.EncodeBytes([]byte{0x00, 0x12}), rlp.EncodeList(rlp.EncodeBytes([]byte{0x20}), rlp.EncodeBytes(hash))),
+	}
+	for name, data := range tests {
+		if _, err := decodeNode(data, len(hash)); !errors.Is(err, ErrBadNode) {
+			t.Errorf("%s: got error %v, want ErrBadNode", name, err)
+		}
+	}
+}
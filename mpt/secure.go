@@ -0,0 +1,91 @@
+package mpt
+
+import (
+	"hash"
+
+	smt "MPT_MOI/smt-master"
+)
+
+// SecureTrie is a PatriciaTrie keyed by the digests of the keys, as the
+// Ethereum state and storage tries are. Hashing the keys keeps the trie
+// balanced whatever keys are inserted.
+type SecureTrie struct {
+	trie *PatriciaTrie
+}
+
+// NewSecureTrie creates a new empty secure trie on a MapStore. The hasher is
+// used both for the keys and for the nodes of the trie.
+func NewSecureTrie(nodes smt.MapStore, hasher hash.Hash) *SecureTrie {
+	return &SecureTrie{trie: NewPatriciaTrie(nodes, hasher)}
+}
+
+// ImportSecureTrie imports a secure trie from a non-empty MapStore.
+func ImportSecureTrie(nodes smt.MapStore, hasher hash.Hash, root []byte) *SecureTrie {
+	return &SecureTrie{trie: ImportPatriciaTrie(nodes, hasher, root)}
+}
+
+// Root gets the root of the trie.
+func (t *SecureTrie) Root() []byte {
+	return t.trie.Root()
+}
+
+// SetRoot sets the root of the trie.
+func (t *SecureTrie) SetRoot(root []byte) {
+	t.trie.SetRoot(root)
+}
+
+// Get gets the value of a key from the trie.
+func (t *SecureTrie) Get(key []byte) ([]byte, error) {
+	return t.trie.Get(t.trie.digest(key))
+}
+
+// GetForRoot gets the value of a key from the trie at a specific root.
+func (t *SecureTrie) GetForRoot(key []byte, root []byte) ([]byte, error) {
+	return t.trie.GetForRoot(t.trie.digest(key), root)
+}
+
+// Has returns true if the value at the given key is non-default, false
+// otherwise.
+func (t *SecureTrie) Has(key []byte) (bool, error) {
+	return t.trie.Has(t.trie.digest(key))
+}
+
+// Update sets a new value for a key in the trie, and sets and returns the new
+// root of the trie.
+func (t *SecureTrie) Update(key []byte, value []byte) ([]byte, error) {
+	return t.trie.Update(t.trie.digest(key), value)
+}
+
+// UpdateDigest sets a new value for the key with a given digest, and sets and
+// returns the new root of the trie. It is used when only the digest of a key
+// is known, as for the accounts of a state dump without preimages.
+func (t *SecureTrie) UpdateDigest(digest []byte, value []byte) ([]byte, error) {
+	return t.trie.Update(digest, value)
+}
+
+// Delete deletes a value from the trie. It returns the new root of the trie.
+func (t *SecureTrie) Delete(key []byte) ([]byte, error) {
+	return t.trie.Delete(t.trie.digest(key))
+}
+
+// Prove generates a Merkle proof for a key against the current root.
+func (t *SecureTrie) Prove(key []byte) (Proof, error) {
+	return t.trie.Prove(t.trie.digest(key))
+}
+
+// ProveForRoot generates a Merkle proof for a key against a specific root.
+func (t *SecureTrie) ProveForRoot(key []byte, root []byte) (Proof, error) {
+	return t.trie.ProveForRoot(t.trie.digest(key), root)
+}
+
+// VerifySecureProof verifies a Merkle proof generated by a SecureTrie.
+func VerifySecureProof(proof Proof, root []byte, key []byte, value []byte, hasher hash.Hash) bool {
+	t := &PatriciaTrie{hasher: hasher}
+	return VerifyProof(proof, root, t.digest(key), value, hasher)
+}
+
+// EmptyRoot returns the root of a trie without any keys for a hasher.
+func EmptyRoot(hasher hash.Hash) []byte {
+	t := &PatriciaTrie{hasher: hasher}
+	return t.emptyRoot()
+}
@@ -0,0 +1,68 @@
+package mpt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"MPT_MOI/keccak"
+	smt "MPT_MOI/smt-master"
+)
+
+func TestSecureTrie(t *testing.T) {
+	nodes := smt.NewSimpleMap()
+	trie := NewSecureTrie(nodes, keccak.NewLegacyKeccak256())
+	if !bytes.Equal(trie.Root(), EmptyRoot(keccak.NewLegacyKeccak256())) {
+		t.Error("new secure trie does not have the empty root")
+	}
+
+	kv := map[string]string{"doe": "reindeer", "dog": "puppy", "dogglesworth": "cat"}
+	for k, v := range kv {
+		if _, err := trie.Update([]byte(k), []byte(v)); err != nil {
+			t.Errorf("returned error when updating key %q: %v", k, err)
+		}
+	}
+	root := trie.Root()
+	if want := "d4cd937e4a4368d7931a9cf51686b7e10abb3dce38a39000fd7902a092b64585"; hex.EncodeToString(root) != want {
+		t.Errorf("got root %x, want %s", root, want)
+	}
+
+	for k, v := range kv {
+		value, err := trie.Get([]byte(k))
+		if err != nil || !bytes.Equal(value, []byte(v)) {
+			t.Errorf("got %q, %v for key %q, want %q", value, err, k, v)
+		}
+		proof, err := trie.Prove([]byte(k))
+		if err != nil {
+			t.Errorf("returned error when proving key %q: %v", k, err)
+		}
+		if !VerifySecureProof(proof, root, []byte(k), []byte(v), keccak.NewLegacyKeccak256()) {
+			t.Errorf("valid proof for key %q failed to verify", k)
+		}
+		if VerifyProof(proof, root, []byte(k), []byte(v), keccak.NewLegacyKeccak256()) {
+			t.Error("proof verified against the unhashed key")
+		}
+	}
+
+	// The secure trie is the plain trie over the digests of the keys.
+	plain := NewPatriciaTrie(smt.NewSimpleMap(), keccak.NewLegacyKeccak256())
+	for k, v := range kv {
+		plain.Update(plain.digest([]byte(k)), []byte(v))
+	}
+	if !bytes.Equal(plain.Root(), root) {
+		t.Error("secure trie root differs from the plain trie over hashed keys")
+	}
+
+	trie.Delete([]byte("dog"))
+	if has, _ := trie.Has([]byte("dog")); has {
+		t.Error("deleted key is still in the trie")
+	}
+	value, err := trie.GetForRoot([]byte("dog"), root)
+	if err != nil || !bytes.Equal(value, []byte("puppy")) {
+		t.Errorf("got %q, %v for key at the earlier root", value, err)
+	}
+	imported := ImportSecureTrie(nodes, keccak.NewLegacyKeccak256(), root)
+	if has, _ := imported.Has([]byte("dog")); !has {
+		t.Error("imported trie does not have the key")
+	}
+}
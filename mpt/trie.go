@@ -0,0 +1,343 @@
+// Package mpt implements a hexary Merkle Patricia trie in the style of
+// Ethereum, on top of the same MapStore interface as the Sparse Merkle tree.
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+
+	smt "MPT_MOI/smt-master"
+)
+
+var defaultValue = []byte{}
+
+// PatriciaTrie is a Merkle Patricia trie.
+//
+// Nodes are content-addressed and the same node may be referenced from
+// several places in the trie, so nodes are never removed from the store.
+// Roots of earlier versions of the trie therefore remain readable.
+type PatriciaTrie struct {
+	hasher hash.Hash
+	nodes  smt.MapStore
+	root   []byte
+}
+
+// NewPatriciaTrie creates a new empty Merkle Patricia trie on a MapStore.
+func NewPatriciaTrie(nodes smt.MapStore, hasher hash.Hash) *PatriciaTrie {
+	t := &PatriciaTrie{
+		hasher: hasher,
+		nodes:  nodes,
+	}
+	t.SetRoot(t.emptyRoot())
+	return t
+}
+
+// ImportPatriciaTrie imports a Merkle Patricia trie from a non-empty MapStore.
+func ImportPatriciaTrie(nodes smt.MapStore, hasher hash.Hash, root []byte) *PatriciaTrie {
+	return &PatriciaTrie{
+		hasher: hasher,
+		nodes:  nodes,
+		root:   root,
+	}
+}
+
+// Root gets the root of the trie.
+func (t *PatriciaTrie) Root() []byte {
+	return t.root
+}
+
+// SetRoot sets the root of the trie.
+func (t *PatriciaTrie) SetRoot(root []byte) {
+	t.root = root
+}
+
+func (t *PatriciaTrie) digest(data []byte) []byte {
+	t.hasher.Write(data)
+	sum := t.hasher.Sum(nil)
+	t.hasher.Reset()
+	return sum
+}
+
+// emptyRoot is the root of the trie without any keys: the digest of the
+// encoding of the empty node.
+func (t *PatriciaTrie) emptyRoot() []byte {
+	return t.digest(encodeNode(nil))
+}
+
+// rootNode returns the node to start descending the trie at root from.
+func (t *PatriciaTrie) rootNode(root []byte) node {
+	if bytes.Equal(root, t.emptyRoot()) {
+		return nil
+	}
+	return hashNode(root)
+}
+
+// resolve loads a node from the store if it is a hashNode.
+func (t *PatriciaTrie) resolve(n node) (node, error) {
+	h, ok := n.(hashNode)
+	if !ok {
+		return n, nil
+	}
+	data, err := t.nodes.Get(h)
+	if err != nil {
+		return nil, err
+	}
+	decoded, err := decodeNode(data, t.hasher.Size())
+	if err != nil {
+		return nil, fmt.Errorf("node %x: %w", []byte(h), err)
+	}
+	return decoded, nil
+}
+
+// Get gets the value of a key from the trie.
+func (t *PatriciaTrie) Get(key []byte) ([]byte, error) {
+	return t.GetForRoot(key, t.Root())
+}
+
+// GetForRoot gets the value of a key from the trie at a specific root.
+func (t *PatriciaTrie) GetForRoot(key []byte, root []byte) ([]byte, error) {
+	n := t.rootNode(root)
+	path := keybytesToHex(key)
+	for {
+		var err error
+		if n, err = t.resolve(n); err != nil {
+			return nil, err
+		}
+		switch nn := n.(type) {
+		case nil:
+			return defaultValue, nil
+		case valueNode:
+			return nn, nil
+		case *shortNode:
+			if len(path) < len(nn.Key) || !bytes.Equal(nn.Key, path[:len(nn.Key)]) {
+				return defaultValue, nil
+			}
+			n, path = nn.Val, path[len(nn.Key):]
+		case *fullNode:
+			n, path = nn.Children[path[0]], path[1:]
+		}
+	}
+}
+
+// Has returns true if the value at the given key is non-default, false
+// otherwise.
+func (t *PatriciaTrie) Has(key []byte) (bool, error) {
+	val, err := t.Get(key)
+	return !bytes.Equal(defaultValue, val), err
+}
+
+// Update sets a new value for a key in the trie, and sets and returns the new
+// root of the trie. Setting the default (empty) value deletes the key.
+func (t *PatriciaTrie) Update(key []byte, value []byte) ([]byte, error) {
+	newRoot, err := t.UpdateForRoot(key, value, t.Root())
+	if err != nil {
+		return nil, err
+	}
+	t.SetRoot(newRoot)
+	return newRoot, nil
+}
+
+// Delete deletes a value from the trie. It returns the new root of the trie.
+func (t *PatriciaTrie) Delete(key []byte) ([]byte, error) {
+	return t.Update(key, defaultValue)
+}
+
+// UpdateForRoot sets a new value for a key in the trie at a specific root, and
+// returns the new root.
+func (t *PatriciaTrie) UpdateForRoot(key []byte, value []byte, root []byte) ([]byte, error) {
+	path := keybytesToHex(key)
+	var newRoot node
+	var err error
+	if bytes.Equal(value, defaultValue) {
+		_, newRoot, err = t.delete(t.rootNode(root), path)
+	} else {
+		newRoot, err = t.insert(t.rootNode(root), path, valueNode(value))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if newRoot == nil {
+		return t.emptyRoot(), nil
+	}
+	committed, err := t.commit(newRoot, true)
+	if err != nil {
+		return nil, err
+	}
+	return committed.(hashNode), nil
+}
+
+// DeleteForRoot deletes a value from the trie at a specific root. It returns
+// the new root of the trie.
+func (t *PatriciaTrie) DeleteForRoot(key, root []byte) ([]byte, error) {
+	return t.UpdateForRoot(key, defaultValue, root)
+}
+
+func (t *PatriciaTrie) insert(n node, path []byte, value node) (node, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	switch n := n.(type) {
+	case nil:
+		return &shortNode{Key: path, Val: value}, nil
+	case *shortNode:
+		matchLen := prefixLen(path, n.Key)
+		if matchLen == len(n.Key) {
+			// The key of the node is a prefix of the path; insert below it.
+			child, err := t.insert(n.Val, path[matchLen:], value)
+			if err != nil {
+				return nil, err
+			}
+			return &shortNode{Key: n.Key, Val: child}, nil
+		}
+		// Otherwise branch out at the first nibble that differs.
+		branch := &fullNode{}
+		var err error
+		if branch.Children[n.Key[matchLen]], err = t.insert(nil, n.Key[matchLen+1:], n.Val); err != nil {
+			return nil, err
+		}
+		if branch.Children[path[matchLen]], err = t.insert(nil, path[matchLen+1:], value); err != nil {
+			return nil, err
+		}
+		if matchLen == 0 {
+			return branch, nil
+		}
+		return &shortNode{Key: path[:matchLen], Val: branch}, nil
+	case *fullNode:
+		child, err := t.insert(n.Children[path[0]], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		nn := n.copy()
+		nn.Children[path[0]] = child
+		return nn, nil
+	case hashNode:
+		resolved, err := t.resolve(n)
+		if err != nil {
+			return nil, err
+		}
+		return t.insert(resolved, path, value)
+	default:
+		panic(fmt.Sprintf("invalid node: %T", n))
+	}
+}
+
+// delete removes path from the subtrie n, returning whether the subtrie
+// changed and its new root node.
+func (t *PatriciaTrie) delete(n node, path []byte) (bool, node, error) {
+	switch n := n.(type) {
+	case nil:
+		return false, nil, nil
+	case valueNode:
+		return true, nil, nil
+	case *shortNode:
+		matchLen := prefixLen(path, n.Key)
+		if matchLen < len(n.Key) {
+			// The key is not in the trie.
+			return false, n, nil
+		}
+		if matchLen == len(path) {
+			// This is the leaf of the key.
+			return true, nil, nil
+		}
+		changed, child, err := t.delete(n.Val, path[len(n.Key):])
+		if !changed || err != nil {
+			return false, n, err
+		}
+		if child, ok := child.(*shortNode); ok {
+			// Merge the child into this node, so that no extension node
+			// points at another short node.
+			key := make([]byte, 0, len(n.Key)+len(child.Key))
+			key = append(append(key, n.Key...), child.Key...)
+			return true, &shortNode{Key: key, Val: child.Val}, nil
+		}
+		return true, &shortNode{Key: n.Key, Val: child}, nil
+	case *fullNode:
+		changed, child, err := t.delete(n.Children[path[0]], path[1:])
+		if !changed || err != nil {
+			return false, n, err
+		}
+		nn := n.copy()
+		nn.Children[path[0]] = child
+
+		// A branch node with a single child left is replaced by a short node.
+		pos := -1
+		for i, c := range nn.Children {
+			if c != nil {
+				if pos != -1 {
+					return true, nn, nil
+				}
+				pos = i
+			}
+		}
+		if pos != terminator {
+			remaining, err := t.resolve(nn.Children[pos])
+			if err != nil {
+				return false, nil, err
+			}
+			if remaining, ok := remaining.(*shortNode); ok {
+				key := append([]byte{byte(pos)}, remaining.Key...)
+				return true, &shortNode{Key: key, Val: remaining.Val}, nil
+			}
+		}
+		return true, &shortNode{Key: []byte{byte(pos)}, Val: nn.Children[pos]}, nil
+	case hashNode:
+		resolved, err := t.resolve(n)
+		if err != nil {
+			return false, nil, err
+		}
+		changed, nn, err := t.delete(resolved, path)
+		if !changed || err != nil {
+			return false, n, err
+		}
+		return true, nn, nil
+	default:
+		panic(fmt.Sprintf("invalid node: %T", n))
+	}
+}
+
+// commit writes the nodes of the subtrie n that are not yet in the store, and
+// returns the reference to n to be embedded in its parent. Nodes whose
+// encoding is shorter than a digest are embedded in their parent rather than
+// stored, unless force is set.
+func (t *PatriciaTrie) commit(n node, force bool) (node, error) {
+	var collapsed node
+	switch n := n.(type) {
+	case hashNode:
+		return n, nil
+	case *shortNode:
+		c := &shortNode{Key: hexToCompact(n.Key), Val: n.Val}
+		if _, ok := n.Val.(valueNode); !ok {
+			child, err := t.commit(n.Val, false)
+			if err != nil {
+				return nil, err
+			}
+			c.Val = child
+		}
+		collapsed = c
+	case *fullNode:
+		c := n.copy()
+		for i, child := range n.Children[:16] {
+			if child != nil {
+				committed, err := t.commit(child, false)
+				if err != nil {
+					return nil, err
+				}
+				c.Children[i] = committed
+			}
+		}
+		collapsed = c
+	default:
+		panic(fmt.Sprintf("invalid node: %T", n))
+	}
+
+	data := encodeNode(collapsed)
+	if len(data) < t.hasher.Size() && !force {
+		return collapsed, nil
+	}
+	h := t.digest(data)
+	if err := t.nodes.Set(h, data); err != nil {
+		return nil, err
+	}
+	return hashNode(h), nil
+}
@@ -0,0 +1,196 @@
+package mpt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+
+	"MPT_MOI/keccak"
+	smt "MPT_MOI/smt-master"
+)
+
+// Test base case trie update operations with a few keys.
+func TestPatriciaTrieUpdateBasic(t *testing.T) {
+	trie := NewPatriciaTrie(smt.NewSimpleMap(), sha256.New())
+	emptyRoot := trie.Root()
+
+	value, err := trie.Get([]byte("testKey"))
+	if err != nil {
+		t.Errorf("returned error when getting empty key: %v", err)
+	}
+	if !bytes.Equal(defaultValue, value) {
+		t.Error("did not get default value when getting empty key")
+	}
+
+	updates := []struct{ key, value string }{
+		{"do", "verb"},
+		{"dog", "puppy"},
+		{"doge", "coin"},
+		{"horse", "stallion"},
+		{"", "empty key"},
+		{"dog", "hound"},
+	}
+	for _, u := range updates {
+		if _, err = trie.Update([]byte(u.key), []byte(u.value)); err != nil {
+			t.Errorf("returned error when updating key %q: %v", u.key, err)
+		}
+	}
+	expected := map[string]string{"do": "verb", "dog": "hound", "doge": "coin", "horse": "stallion", "": "empty key"}
+	for k, v := range expected {
+		value, err = trie.Get([]byte(k))
+		if err != nil {
+			t.Errorf("returned error when getting key %q: %v", k, err)
+		}
+		if !bytes.Equal([]byte(v), value) {
+			t.Errorf("did not get correct value for key %q", k)
+		}
+	}
+	has, err := trie.Has([]byte("d"))
+	if err != nil {
+		t.Errorf("returned error when checking presence of key: %v", err)
+	}
+	if has {
+		t.Error("got 'true' when checking presence of a prefix of a key")
+	}
+
+	for k := range expected {
+		if _, err = trie.Delete([]byte(k)); err != nil {
+			t.Errorf("returned error when deleting key %q: %v", k, err)
+		}
+	}
+	if !bytes.Equal(trie.Root(), emptyRoot) {
+		t.Error("trie root is not empty after deleting all keys")
+	}
+}
+
+// Test that the root only depends on the contents of the trie.
+func TestPatriciaTrieHistoryIndependence(t *testing.T) {
+	keys := make([][]byte, 100)
+	for i := range keys {
+		keys[i] = make([]byte, 1+rand.Intn(8))
+		rand.Read(keys[i])
+	}
+
+	var roots [][]byte
+	for i := 0; i < 3; i++ {
+		trie := NewPatriciaTrie(smt.NewSimpleMap(), sha256.New())
+		for _, j := range rand.Perm(len(keys)) {
+			trie.Update(keys[j], append([]byte("value"), keys[j]...))
+		}
+		// Insert and remove an unrelated key.
+		trie.Update([]byte("unrelated"), []byte("value"))
+		trie.Delete([]byte("unrelated"))
+		roots = append(roots, trie.Root())
+	}
+	if !bytes.Equal(roots[0], roots[1]) || !bytes.Equal(roots[1], roots[2]) {
+		t.Error("trie roots differ for different insertion orders")
+	}
+}
+
+// Test that earlier roots of the trie remain readable.
+func TestPatriciaTrieForRoot(t *testing.T) {
+	trie := NewPatriciaTrie(smt.NewSimpleMap(), sha256.New())
+	root1, _ := trie.Update([]byte("testKey"), []byte("testValue1"))
+	trie.Update([]byte("testKey"), []byte("testValue2"))
+
+	value, err := trie.GetForRoot([]byte("testKey"), root1)
+	if err != nil {
+		t.Errorf("returned error when getting key at old root: %v", err)
+	}
+	if !bytes.Equal(value, []byte("testValue1")) {
+		t.Error("did not get correct value at old root")
+	}
+
+	imported := ImportPatriciaTrie(trie.nodes, sha256.New(), trie.Root())
+	value, err = imported.Get([]byte("testKey"))
+	if err != nil {
+		t.Errorf("returned error when getting key from imported trie: %v", err)
+	}
+	if !bytes.Equal(value, []byte("testValue2")) {
+		t.Error("did not get correct value from imported trie")
+	}
+}
+
+// Test all trie operations in bulk against a map.
+func TestPatriciaTrieBulk(t *testing.T) {
+	trie := NewPatriciaTrie(smt.NewSimpleMap(), sha256.New())
+	kv := make(map[string]string)
+
+	for i := 0; i < 1000; i++ {
+		key := make([]byte, rand.Intn(6))
+		rand.Read(key)
+		// Use a small alphabet so that keys share prefixes.
+		for j := range key {
+			key[j] %= 4
+		}
+		if rand.Intn(3) == 0 {
+			delete(kv, string(key))
+			if _, err := trie.Delete(key); err != nil {
+				t.Fatalf("returned error when deleting key: %v", err)
+			}
+		} else {
+			value := make([]byte, 1+rand.Intn(40))
+			rand.Read(value)
+			kv[string(key)] = string(value)
+			if _, err := trie.Update(key, value); err != nil {
+				t.Fatalf("returned error when updating key: %v", err)
+			}
+		}
+	}
+
+	for k, v := range kv {
+		value, err := trie.Get([]byte(k))
+		if err != nil {
+			t.Errorf("returned error when getting key: %v", err)
+		}
+		if !bytes.Equal([]byte(v), value) {
+			t.Error("got incorrect value when bulk testing operations")
+		}
+	}
+
+	rebuilt := NewPatriciaTrie(smt.NewSimpleMap(), sha256.New())
+	for k, v := range kv {
+		rebuilt.Update([]byte(k), []byte(v))
+	}
+	if !bytes.Equal(rebuilt.Root(), trie.Root()) {
+		t.Error("trie root differs from a trie built from the remaining keys")
+	}
+}
+
+// Test that the trie reproduces the roots of the Ethereum trie tests with
+// Keccak-256.
+func TestPatriciaTrieEthereumVectors(t *testing.T) {
+	trie := NewPatriciaTrie(smt.NewSimpleMap(), keccak.NewLegacyKeccak256())
+	if want := "56e81f171bcc55a6ff8345e692c0f86e5b48e01b996cadc001622fb5e363b421"; hex.EncodeToString(trie.Root()) != want {
+		t.Errorf("got empty root %x, want %s", trie.Root(), want)
+	}
+
+	trie.Update([]byte("doe"), []byte("reindeer"))
+	trie.Update([]byte("dog"), []byte("puppy"))
+	trie.Update([]byte("dogglesworth"), []byte("cat"))
+	if want := "8aad789dff2f538bca5d8ea56e8abe10f4c7ba3a5dea95fea4cd6e7c3a1168d3"; hex.EncodeToString(trie.Root()) != want {
+		t.Errorf("got root %x, want %s", trie.Root(), want)
+	}
+
+	trie = NewPatriciaTrie(smt.NewSimpleMap(), keccak.NewLegacyKeccak256())
+	updates := []struct{ key, value string }{
+		{"do", "verb"},
+		{"ether", "wookiedoo"},
+		{"horse", "stallion"},
+		{"shaman", "horse"},
+		{"doge", "coin"},
+		{"ether", ""},
+		{"dog", "puppy"},
+		{"shaman", ""},
+	}
+	for _, u := range updates {
+		if _, err := trie.Update([]byte(u.key), []byte(u.value)); err != nil {
+			t.Errorf("returned error when updating key %q: %v", u.key, err)
+		}
+	}
+	if want := "5991bb8c6514148a29db676a14ac506cd2cd5775ace63c30a4fe457715e9ac84"; hex.EncodeToString(trie.Root()) != want {
+		t.Errorf("got root %x, want %s", trie.Root(), want)
+	}
+}
@@ -0,0 +1,312 @@
+// Package rlp implements the Recursive Length Prefix encoding used by
+// Ethereum to serialize nested arrays of byte strings.
+//
+// Decoding is strict: only the canonical encoding of a value is accepted.
+package rlp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Kind is the kind of an RLP item.
+type Kind int
+
+const (
+	// String is a byte string.
+	String Kind = iota
+	// List is a list of items.
+	List
+)
+
+// RawValue is an already encoded RLP item, which Encode emits as is.
+type RawValue []byte
+
+var (
+	// ErrExpectedString is returned when a list is found where a string is expected.
+	ErrExpectedString = errors.New("rlp: expected string")
+	// ErrExpectedList is returned when a string is found where a list is expected.
+	ErrExpectedList = errors.New("rlp: expected list")
+	// ErrCanonSize is returned when a size is not in its shortest form.
+	ErrCanonSize = errors.New("rlp: non-canonical size information")
+	// ErrCanonInt is returned when an integer has leading zero bytes.
+	ErrCanonInt = errors.New("rlp: non-canonical integer format")
+	// ErrValueTooLarge is returned when the size of an item exceeds its input.
+	ErrValueTooLarge = errors.New("rlp: value size exceeds available input length")
+	// ErrUintOverflow is returned when an integer does not fit in a uint64.
+	ErrUintOverflow = errors.New("rlp: uint overflow")
+	// ErrMoreThanOneValue is returned when input has data after its item.
+	ErrMoreThanOneValue = errors.New("rlp: input contains more than one value")
+	// ErrEmptyInput is returned when decoding empty input.
+	ErrEmptyInput = errors.New("rlp: empty input")
+)
+
+// EncodeBytes encodes a byte string.
+func EncodeBytes(b []byte) []byte {
+	if len(b) == 1 && b[0] < 0x80 {
+		return []byte{b[0]}
+	}
+	return append(encodeHeader(len(b), 0x80), b...)
+}
+
+// EncodeUint encodes an unsigned integer as its big-endian representation
+// without leading zero bytes.
+func EncodeUint(i uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, i)
+	return EncodeBytes(trimLeadingZeros(buf))
+}
+
+// EncodeBigInt encodes a non-negative big integer.
+func EncodeBigInt(i *big.Int) ([]byte, error) {
+	if i.Sign() < 0 {
+		return nil, errors.New("rlp: cannot encode negative big.Int")
+	}
+	return EncodeBytes(i.Bytes()), nil
+}
+
+// EncodeList encodes a list of already encoded items.
+func EncodeList(items ...[]byte) []byte {
+	size := 0
+	for _, item := range items {
+		size += len(item)
+	}
+	data := encodeHeader(size, 0xc0)
+	for _, item := range items {
+		data = append(data, item...)
+	}
+	return data
+}
+
+// Encode encodes a value, which can be a []byte, string, RawValue, unsigned or
+// non-negative integer, *big.Int, or a []interface{} or [][]byte list of such
+// values.
+func Encode(v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case RawValue:
+		return v, nil
+	case []byte:
+		return EncodeBytes(v), nil
+	case string:
+		return EncodeBytes([]byte(v)), nil
+	case uint:
+		return EncodeUint(uint64(v)), nil
+	case uint64:
+		return EncodeUint(v), nil
+	case uint32:
+		return EncodeUint(uint64(v)), nil
+	case int:
+		if v < 0 {
+			return nil, errors.New("rlp: cannot encode negative integer")
+		}
+		return EncodeUint(uint64(v)), nil
+	case *big.Int:
+		return EncodeBigInt(v)
+	case [][]byte:
+		items := make([][]byte, len(v))
+		for i, b := range v {
+			items[i] = EncodeBytes(b)
+		}
+		return EncodeList(items...), nil
+	case []interface{}:
+		items := make([][]byte, len(v))
+		for i, item := range v {
+			enc, err := Encode(item)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = enc
+		}
+		return EncodeList(items...), nil
+	default:
+		return nil, fmt.Errorf("rlp: cannot encode type %T", v)
+	}
+}
+
+func encodeHeader(size int, offset byte) []byte {
+	if size < 56 {
+		return []byte{offset + byte(size)}
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(size))
+	sizeBytes := trimLeadingZeros(buf)
+	return append([]byte{offset + 55 + byte(len(sizeBytes))}, sizeBytes...)
+}
+
+func trimLeadingZeros(b []byte) []byte {
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+// Split splits the first RLP item off b, returning its kind, its content and
+// the data following it.
+func Split(b []byte) (kind Kind, content []byte, rest []byte, err error) {
+	kind, offset, size, err := readKind(b)
+	if err != nil {
+		return 0, nil, b, err
+	}
+	return kind, b[offset : offset+size], b[offset+size:], nil
+}
+
+// SplitString splits the first RLP item off b, which must be a string.
+func SplitString(b []byte) (content []byte, rest []byte, err error) {
+	kind, content, rest, err := Split(b)
+	if err != nil {
+		return nil, b, err
+	}
+	if kind != String {
+		return nil, b, ErrExpectedString
+	}
+	return content, rest, nil
+}
+
+// SplitList splits the first RLP item off b, which must be a list.
+func SplitList(b []byte) (content []byte, rest []byte, err error) {
+	kind, content, rest, err := Split(b)
+	if err != nil {
+		return nil, b, err
+	}
+	if kind != List {
+		return nil, b, ErrExpectedList
+	}
+	return content, rest, nil
+}
+
+// SplitRaw splits the first RLP item off b, returning its whole encoding.
+func SplitRaw(b []byte) (item RawValue, rest []byte, err error) {
+	_, _, rest, err = Split(b)
+	if err != nil {
+		return nil, b, err
+	}
+	return RawValue(b[:len(b)-len(rest)]), rest, nil
+}
+
+// CountValues counts the items in the content of a list.
+func CountValues(b []byte) (int, error) {
+	count := 0
+	for len(b) > 0 {
+		_, _, rest, err := Split(b)
+		if err != nil {
+			return 0, err
+		}
+		b = rest
+		count++
+	}
+	return count, nil
+}
+
+func readKind(b []byte) (kind Kind, offset int, size int, err error) {
+	if len(b) == 0 {
+		return 0, 0, 0, ErrEmptyInput
+	}
+	prefix := b[0]
+	switch {
+	case prefix < 0x80:
+		return String, 0, 1, nil
+	case prefix < 0xb8:
+		size = int(prefix - 0x80)
+		if size == 1 && len(b) > 1 && b[1] < 0x80 {
+			// A single byte below 0x80 is its own encoding.
+			return 0, 0, 0, ErrCanonSize
+		}
+		kind, offset = String, 1
+	case prefix < 0xc0:
+		kind, offset = String, 1+int(prefix-0xb7)
+		if size, err = readSize(b[1:], prefix-0xb7); err != nil {
+			return 0, 0, 0, err
+		}
+	case prefix < 0xf8:
+		kind, offset, size = List, 1, int(prefix-0xc0)
+	default:
+		kind, offset = List, 1+int(prefix-0xf7)
+		if size, err = readSize(b[1:], prefix-0xf7); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	if size > len(b)-offset {
+		return 0, 0, 0, ErrValueTooLarge
+	}
+	return kind, offset, size, nil
+}
+
+// readSize reads the size of a long string or list.
+func readSize(b []byte, sizeLen byte) (int, error) {
+	if int(sizeLen) > len(b) {
+		return 0, ErrValueTooLarge
+	}
+	if b[0] == 0 {
+		return 0, ErrCanonSize
+	}
+	size := uint64(0)
+	for _, c := range b[:sizeLen] {
+		size = size<<8 | uint64(c)
+	}
+	// Sizes below 56 must use the short form.
+	if size < 56 {
+		return 0, ErrCanonSize
+	}
+	if size > uint64(len(b)) {
+		return 0, ErrValueTooLarge
+	}
+	return int(size), nil
+}
+
+// Decode decodes a single RLP item, which must span all of b. Strings are
+// returned as []byte and lists as []interface{}.
+func Decode(b []byte) (interface{}, error) {
+	v, rest, err := decodeValue(b)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrMoreThanOneValue
+	}
+	return v, nil
+}
+
+func decodeValue(b []byte) (interface{}, []byte, error) {
+	kind, content, rest, err := Split(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if kind == String {
+		return content, rest, nil
+	}
+	items := []interface{}{}
+	for len(content) > 0 {
+		var item interface{}
+		if item, content, err = decodeValue(content); err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rest, nil
+}
+
+// DecodeUint decodes the content of a string holding an unsigned integer.
+func DecodeUint(content []byte) (uint64, error) {
+	if len(content) > 8 {
+		return 0, ErrUintOverflow
+	}
+	if len(content) > 0 && content[0] == 0 {
+		return 0, ErrCanonInt
+	}
+	i := uint64(0)
+	for _, c := range content {
+		i = i<<8 | uint64(c)
+	}
+	return i, nil
+}
+
+// DecodeBigInt decodes the content of a string holding a non-negative big
+// integer.
+func DecodeBigInt(content []byte) (*big.Int, error) {
+	if len(content) > 0 && content[0] == 0 {
+		return nil, ErrCanonInt
+	}
+	return new(big.Int).SetBytes(content), nil
+}
@@ -0,0 +1,204 @@
+package rlp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func bigInt(s string) *big.Int {
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		panic("invalid big integer " + s)
+	}
+	return i
+}
+
+func cycleStrings(n int) []interface{} {
+	items := make([]interface{}, 0, n)
+	for i := 0; len(items) < n; i++ {
+		items = append(items, []string{"asdf", "qwer", "zxcv"}[i%3])
+	}
+	return items
+}
+
+func repeatList(item []interface{}, n int) []interface{} {
+	items := make([]interface{}, n)
+	for i := range items {
+		items[i] = item
+	}
+	return items
+}
+
+// Valid test vectors from the rlptest.json suite of ethereum/tests.
+var validTests = []struct {
+	name string
+	in   interface{}
+	out  string
+}{
+	{"emptystring", "", "80"},
+	{"bytestring00", "\x00", "00"},
+	{"bytestring01", "\x01", "01"},
+	{"bytestring7F", "\x7f", "7f"},
+	{"shortstring", "dog", "83646f67"},
+	{"shortstring2", "Lorem ipsum dolor sit amet, consectetur adipisicing eli", "b74c6f72656d20697073756d20646f6c6f722073697420616d65742c20636f6e7365637465747572206164697069736963696e6720656c69"},
+	{"longstring", "Lorem ipsum dolor sit amet, consectetur adipisicing elit", "b8384c6f72656d20697073756d20646f6c6f722073697420616d65742c20636f6e7365637465747572206164697069736963696e6720656c6974"},
+	{"zero", 0, "80"},
+	{"smallint", 1, "01"},
+	{"smallint2", 16, "10"},
+	{"smallint3", 79, "4f"},
+	{"smallint4", 127, "7f"},
+	{"mediumint1", 128, "8180"},
+	{"mediumint2", 1000, "8203e8"},
+	{"mediumint3", 100000, "830186a0"},
+	{"mediumint4", bigInt("83729609699884896815286331701780722"), "8f102030405060708090a0b0c0d0e0f2"},
+	{"mediumint5", bigInt("105315505618206987246253880190783558935785933862974822347068935681"), "9c0100020003000400050006000700080009000a000b000c000d000e01"},
+	{"emptylist", []interface{}{}, "c0"},
+	{"stringlist", []interface{}{"dog", "god", "cat"}, "cc83646f6783676f6483636174"},
+	{"multilist", []interface{}{"zw", []interface{}{4}, 1}, "c6827a77c10401"},
+	{"shortListMax1", cycleStrings(11), "f784617364668471776572847a78637684617364668471776572847a78637684617364668471776572847a78637684617364668471776572"},
+	{"longList1", repeatList(cycleStrings(3), 4), "f840cf84617364668471776572847a786376cf84617364668471776572847a786376cf84617364668471776572847a786376cf84617364668471776572847a786376"},
+	{"longList2", repeatList(cycleStrings(3), 32), "f90200" + strings.Repeat("cf84617364668471776572847a786376", 32)},
+	{"listsoflists", []interface{}{[]interface{}{[]interface{}{}, []interface{}{}}, []interface{}{}}, "c4c2c0c0c0"},
+	{"listsoflists2", []interface{}{[]interface{}{}, []interface{}{[]interface{}{}}, []interface{}{[]interface{}{}, []interface{}{[]interface{}{}}}}, "c7c0c1c0c3c0c1c0"},
+	{"dictTest1", []interface{}{
+		[]interface{}{"key1", "val1"},
+		[]interface{}{"key2", "val2"},
+		[]interface{}{"key3", "val3"},
+		[]interface{}{"key4", "val4"},
+	}, "ecca846b6579318476616c31ca846b6579328476616c32ca846b6579338476616c33ca846b6579348476616c34"},
+	{"bigint", bigInt("115792089237316195423570985008687907853269984665640564039457584007913129639936"), "a1010000000000000000000000000000000000000000000000000000000000000000"},
+}
+
+// Invalid encodings from the invalidRLPTest.json suite of ethereum/tests.
+var invalidTests = []struct {
+	name string
+	in   string
+	err  error
+}{
+	{"emptyEncoding", "", ErrEmptyInput},
+	{"bytesShouldBeSingleByte00", "8100", ErrCanonSize},
+	{"bytesShouldBeSingleByte01", "8101", ErrCanonSize},
+	{"bytesShouldBeSingleByte7F", "817f", ErrCanonSize},
+	{"leadingZerosInLongLengthArray2", "b800", ErrCanonSize},
+	{"leadingZerosInLongLengthList2", "f800", ErrCanonSize},
+	{"incorrectLengthInArray", "b9002100dc2b275d0f74e8a53e6f4ec61b27f24278820be3f82ea2110e582081b0565df0", ErrCanonSize},
+	{"nonOptimalLongLengthArray1", "b81000112233445566778899aabbccddeeff", ErrCanonSize},
+	{"nonOptimalLongLengthArray2", "b801ff", ErrCanonSize},
+	{"nonOptimalLongLengthList2", "f803112233", ErrCanonSize},
+	{"wrongSizeList", "f80180", ErrCanonSize},
+	{"wrongSizeList2", "f80100", ErrCanonSize},
+	{"int32Overflow", "bf0f000000000000021111", ErrValueTooLarge},
+	{"int32Overflow2", "ff0f000000000000021111", ErrValueTooLarge},
+	{"lessThanShortLengthArray1", "81", ErrValueTooLarge},
+	{"lessThanShortLengthArray2", "a0000102030405060708090a0b0c0d0e0f10111213141516171819", ErrValueTooLarge},
+	{"lessThanShortLengthList1", "c5010203", ErrValueTooLarge},
+	{"lessThanLongLengthArray1", "ba010000aabbccddeeff", ErrValueTooLarge},
+	{"lessThanLongLengthList1", "f90180", ErrValueTooLarge},
+	{"moreThanOneValue", "8080", ErrMoreThanOneValue},
+	{"nestedNonCanonical", "c28100", ErrCanonSize},
+}
+
+// normalize turns a test input into the values returned by Decode.
+func normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return []byte(v)
+	case int:
+		b, _ := Encode(v)
+		content, _, _ := SplitString(b)
+		return content
+	case *big.Int:
+		return v.Bytes()
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i := range v {
+			items[i] = normalize(v[i])
+		}
+		return items
+	}
+	panic("unexpected test input")
+}
+
+func TestEncode(t *testing.T) {
+	for _, test := range validTests {
+		enc, err := Encode(test.in)
+		if err != nil {
+			t.Errorf("%s: returned error when encoding: %v", test.name, err)
+			continue
+		}
+		if hex.EncodeToString(enc) != test.out {
+			t.Errorf("%s: got %x, want %s", test.name, enc, test.out)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, test := range validTests {
+		in, _ := hex.DecodeString(test.out)
+		v, err := Decode(in)
+		if err != nil {
+			t.Errorf("%s: returned error when decoding: %v", test.name, err)
+			continue
+		}
+		want := normalize(test.in)
+		if !reflect.DeepEqual(v, want) {
+			t.Errorf("%s: got %v, want %v", test.name, v, want)
+		}
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, test := range invalidTests {
+		in, _ := hex.DecodeString(test.in)
+		_, err := Decode(in)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestDecodeUint(t *testing.T) {
+	for _, i := range []uint64{0, 1, 127, 128, 1000, 1<<64 - 1} {
+		content, _, err := SplitString(EncodeUint(i))
+		if err != nil {
+			t.Errorf("returned error when splitting encoded integer: %v", err)
+		}
+		decoded, err := DecodeUint(content)
+		if err != nil || decoded != i {
+			t.Errorf("decoding %d returned %d, %v", i, decoded, err)
+		}
+	}
+	if _, err := DecodeUint([]byte{0, 1}); !errors.Is(err, ErrCanonInt) {
+		t.Errorf("did not return ErrCanonInt for an integer with leading zeros: %v", err)
+	}
+	if _, err := DecodeUint(bytes.Repeat([]byte{1}, 9)); !errors.Is(err, ErrUintOverflow) {
+		t.Errorf("did not return ErrUintOverflow for a 9 byte integer: %v", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	enc, _ := Encode([]interface{}{"dog", []interface{}{"cat"}, ""})
+	content, rest, err := SplitList(enc)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("returned error when splitting list: %v", err)
+	}
+	count, err := CountValues(content)
+	if err != nil || count != 3 {
+		t.Errorf("expected 3 values, got %d, %v", count, err)
+	}
+	if _, _, err = SplitString(enc); !errors.Is(err, ErrExpectedString) {
+		t.Errorf("did not return ErrExpectedString when splitting a list as a string: %v", err)
+	}
+	raw, rest, err := SplitRaw(content)
+	if err != nil || !bytes.Equal(raw, []byte{0x83, 'd', 'o', 'g'}) {
+		t.Errorf("unexpected raw item %x, %v", raw, err)
+	}
+	if _, _, err = SplitList(rest[len(rest)-1:]); !errors.Is(err, ErrExpectedList) {
+		t.Errorf("did not return ErrExpectedList when splitting a string as a list: %v", err)
+	}
+}
@@ -110,16 +110,18 @@ func bulkCheckAll(t *testing.T, smt *SparseMerkleTree, kv *map[string]string) {
 
 		// Check that the key is at the correct height in the tree.
 		largestCommonPrefix := 0
+		path, _ := smt.th.path([]byte(k))
 		for k2, v2 := range *kv {
 			if v2 == "" {
 				continue
 			}
-			commonPrefix := countCommonPrefix(smt.th.path([]byte(k)), smt.th.path([]byte(k2)))
+			path2, _ := smt.th.path([]byte(k2))
+			commonPrefix := countCommonPrefix(path, path2)
 			if commonPrefix != smt.depth() && commonPrefix > largestCommonPrefix {
 				largestCommonPrefix = commonPrefix
 			}
 		}
-		sideNodes, _, _, _, err := smt.sideNodesForRoot(smt.th.path([]byte(k)), smt.Root(), false)
+		sideNodes, _, _, _, err := smt.sideNodesForRoot(path, smt.Root(), false)
 		if err != nil {
 			t.Errorf("error: %v", err)
 		}
@@ -0,0 +1,230 @@
+package smt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CheckProblemKind is the kind of a problem found by Check.
+type CheckProblemKind int
+
+const (
+	// MissingNode is a node reachable from the root that is not in the node
+	// store.
+	MissingNode CheckProblemKind = iota
+	// HashMismatch is a node whose data does not hash to its key.
+	HashMismatch
+	// MalformedNode is a node whose data is neither a leaf nor an inner node
+	// of the tree, or an inner node below the depth of the tree.
+	MalformedNode
+	// MisplacedLeaf is a leaf whose path does not lead to its position.
+	MisplacedLeaf
+	// MissingValue is a leaf whose value is not in the values store.
+	MissingValue
+	// ValueMismatch is a leaf whose value in the values store does not hash
+	// to the value hash of the leaf.
+	ValueMismatch
+	// DanglingValue is a value in the values store without a leaf.
+	DanglingValue
+	// UnreachableNode is a node in the node store that is not reachable from
+	// the root.
+	UnreachableNode
+)
+
+var checkProblemKindNames = []string{
+	"missing node",
+	"hash mismatch",
+	"malformed node",
+	"misplaced leaf",
+	"missing value",
+	"value mismatch",
+	"dangling value",
+	"unreachable node",
+}
+
+func (k CheckProblemKind) String() string {
+	if k < 0 || int(k) >= len(checkProblemKindNames) {
+		return fmt.Sprintf("CheckProblemKind(%d)", int(k))
+	}
+	return checkProblemKindNames[k]
+}
+
+// CheckProblem is a problem found by Check.
+type CheckProblem struct {
+	Kind CheckProblemKind
+	// Key is the key of the node for node problems, and the path of the value
+	// for value problems.
+	Key []byte
+	// Depth is the depth of the node for the problems of reachable nodes.
+	Depth int
+	// Detail describes the problem.
+	Detail string
+}
+
+func (p CheckProblem) String() string {
+	if p.Detail == "" {
+		return fmt.Sprintf("%v %x", p.Kind, p.Key)
+	}
+	return fmt.Sprintf("%v %x: %s", p.Kind, p.Key, p.Detail)
+}
+
+// CheckReport is the result of Check.
+type CheckReport struct {
+	// Root is the checked root.
+	Root []byte
+	// Nodes and Leaves are the numbers of nodes and leaves reachable from the
+	// root, leaves included in nodes and placeholders excluded.
+	Nodes  int
+	Leaves int
+	// ScannedNodes and ScannedValues tell whether the node and values stores
+	// were scanned for unreachable nodes and dangling values, which is only
+	// done for IterableMapStores.
+	ScannedNodes  bool
+	ScannedValues bool
+	// Problems lists the problems found, in the order of the walk of the
+	// tree, followed by the dangling values and unreachable nodes in key
+	// order.
+	Problems []CheckProblem
+}
+
+// OK returns whether no problem was found.
+func (r *CheckReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Check checks the integrity of the tree at its current root. See
+// CheckForRoot.
+func (smt *SparseMerkleTree) Check() (*CheckReport, error) {
+	return smt.CheckForRoot(smt.Root())
+}
+
+// CheckForRoot checks the integrity of the tree at a root. It walks every node
+// reachable from the root, checks that its data hashes to its key and that
+// leaves are at the position of their paths, and checks that the value of
+// every leaf is in the values store and hashes to the value hash of the leaf.
+// If the stores are IterableMapStores, it also reports the values without a
+// leaf and the nodes not reachable from the root; as trees delete the nodes
+// of earlier roots, only the current root of a tree should have none.
+//
+// Problems in the stores are listed in the report, and errors of the stores
+// other than missing keys are returned.
+func (smt *SparseMerkleTree) CheckForRoot(root []byte) (*CheckReport, error) {
+	report := &CheckReport{Root: root}
+	reachable := make(map[string]struct{})
+	leafPaths := make(map[string]struct{})
+	problem := func(kind CheckProblemKind, key []byte, depth int, format string, args ...interface{}) {
+		report.Problems = append(report.Problems, CheckProblem{Kind: kind, Key: key, Depth: depth, Detail: fmt.Sprintf(format, args...)})
+	}
+
+	type position struct {
+		hash  []byte
+		depth int
+		// prefix holds the bits of the path leading to the node.
+		prefix []byte
+	}
+	stack := []position{{hash: root, prefix: make([]byte, smt.th.pathSize())}}
+	for len(stack) > 0 {
+		pos := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if bytes.Equal(pos.hash, smt.th.placeholder()) {
+			continue
+		}
+		reachable[string(pos.hash)] = struct{}{}
+
+		data, err := smt.nodes.Get(pos.hash)
+		if err != nil {
+			var invalidKeyError *InvalidKeyError
+			if !errors.As(err, &invalidKeyError) {
+				return nil, err
+			}
+			problem(MissingNode, pos.hash, pos.depth, "")
+			continue
+		}
+		report.Nodes++
+		if digest := smt.th.digest(data); !bytes.Equal(digest, pos.hash) {
+			problem(HashMismatch, pos.hash, pos.depth, "data hashes to %x", digest)
+			continue
+		}
+
+		if smt.th.isLeaf(data) {
+			if !smt.th.leafSizeValid(data) {
+				problem(MalformedNode, pos.hash, pos.depth, "leaf data of %d bytes", len(data))
+				continue
+			}
+			report.Leaves++
+			path, valueData := smt.th.parseLeaf(data)
+			leafPaths[string(path)] = struct{}{}
+			if countCommonPrefix(path, pos.prefix) < pos.depth {
+				problem(MisplacedLeaf, pos.hash, pos.depth, "path %x", path)
+			}
+			if smt.th.inlineValues {
+				continue
+			}
+			value, err := smt.values.Get(path)
+			if err != nil {
+				var invalidKeyError *InvalidKeyError
+				if !errors.As(err, &invalidKeyError) {
+					return nil, err
+				}
+				problem(MissingValue, path, pos.depth, "")
+				continue
+			}
+			if digest := smt.th.digest(value); !bytes.Equal(digest, valueData) {
+				problem(ValueMismatch, path, pos.depth, "value hashes to %x, leaf has %x", digest, valueData)
+			}
+			continue
+		}
+
+		if len(data) != len(smt.th.nodePrefix)+2*smt.th.hasher.Size() || !bytes.HasPrefix(data, smt.th.nodePrefix) {
+			problem(MalformedNode, pos.hash, pos.depth, "node data of %d bytes", len(data))
+			continue
+		}
+		if pos.depth >= smt.th.depth {
+			problem(MalformedNode, pos.hash, pos.depth, "inner node at the depth of leaves")
+			continue
+		}
+		leftNode, rightNode := smt.th.parseNode(data)
+		rightPrefix := append([]byte(nil), pos.prefix...)
+		setBitAtFromMSB(rightPrefix, pos.depth)
+		// Push the right child first, so that the left subtree is walked first.
+		stack = append(stack,
+			position{hash: rightNode, depth: pos.depth + 1, prefix: rightPrefix},
+			position{hash: leftNode, depth: pos.depth + 1, prefix: pos.prefix})
+	}
+
+	var unlisted []CheckProblem
+	if values, ok := smt.values.(IterableMapStore); ok && !smt.th.inlineValues {
+		report.ScannedValues = true
+		err := values.Iterate(func(path, value []byte) error {
+			if _, ok := leafPaths[string(path)]; !ok {
+				unlisted = append(unlisted, CheckProblem{Kind: DanglingValue, Key: append([]byte(nil), path...), Depth: -1})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if nodes, ok := smt.nodes.(IterableMapStore); ok {
+		report.ScannedNodes = true
+		err := nodes.Iterate(func(key, data []byte) error {
+			if _, ok := reachable[string(key)]; !ok && !bytes.Equal(key, metadataKey) {
+				unlisted = append(unlisted, CheckProblem{Kind: UnreachableNode, Key: append([]byte(nil), key...), Depth: -1})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(unlisted, func(i, j int) bool {
+		if unlisted[i].Kind != unlisted[j].Kind {
+			return unlisted[i].Kind < unlisted[j].Kind
+		}
+		return bytes.Compare(unlisted[i].Key, unlisted[j].Key) < 0
+	})
+	report.Problems = append(report.Problems, unlisted...)
+	return report, nil
+}
@@ -0,0 +1,105 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"sort"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	nodes, values := NewSimpleMap(), NewSimpleMap()
+	smt := NewSparseMerkleTree(nodes, values, sha256.New(), PersistRoot())
+	for i := 0; i < 20; i++ {
+		smt.Update([]byte{byte(i)}, []byte{byte(i), 1})
+	}
+	report, err := smt.Check()
+	if err != nil {
+		t.Fatalf("returned error: %v", err)
+	}
+	if !report.OK() || report.Leaves != 20 || report.Nodes <= 20 || !report.ScannedNodes || !report.ScannedValues {
+		t.Fatalf("got report %+v for a sound tree", report)
+	}
+
+	_, _, leafHash, leafData, _ := smt.SideNodesForRoot([]byte{3}, smt.Root())
+	_, _, otherHash, _, _ := smt.SideNodesForRoot([]byte{4}, smt.Root())
+	valuePath, _ := smt.th.path([]byte{6})
+	missingPath, _ := smt.th.path([]byte{7})
+
+	nodes.Set(leafHash, append(leafData[:len(leafData):len(leafData)], 0))
+	nodes.Delete(otherHash)
+	values.Set(valuePath, []byte("corrupt"))
+	values.Delete(missingPath)
+	values.Set([]byte("dangling"), []byte("value"))
+	nodes.Set([]byte("unreachable"), []byte("node"))
+
+	report, err = smt.Check()
+	if err != nil {
+		t.Fatalf("returned error: %v", err)
+	}
+	// The values of the unreadable leaves are dangling.
+	leafPath, _ := smt.th.path([]byte{3})
+	otherPath, _ := smt.th.path([]byte{4})
+	want := []CheckProblem{
+		{Kind: HashMismatch, Key: leafHash},
+		{Kind: ValueMismatch, Key: valuePath},
+		{Kind: MissingValue, Key: missingPath},
+		{Kind: MissingNode, Key: otherHash},
+	}
+	dangling := [][]byte{leafPath, otherPath, []byte("dangling")}
+	sort.Slice(dangling, func(i, j int) bool { return bytes.Compare(dangling[i], dangling[j]) < 0 })
+	for _, path := range dangling {
+		want = append(want, CheckProblem{Kind: DanglingValue, Key: path})
+	}
+	want = append(want, CheckProblem{Kind: UnreachableNode, Key: []byte("unreachable")})
+	if len(report.Problems) != len(want) {
+		t.Fatalf("got %d problems, want %d: %v", len(report.Problems), len(want), report.Problems)
+	}
+	// Problems of the walk are in the order of the walk, which depends on
+	// the paths.
+	walk := report.Problems[:4]
+	sort.Slice(walk, func(i, j int) bool { return walk[i].Kind < walk[j].Kind })
+	sort.Slice(want[:4], func(i, j int) bool { return want[i].Kind < want[j].Kind })
+	for i, problem := range report.Problems {
+		if problem.Kind != want[i].Kind || !bytes.Equal(problem.Key, want[i].Key) {
+			t.Errorf("got problem %v, want %v", problem, want[i])
+		}
+	}
+}
+
+func TestCheckLayout(t *testing.T) {
+	// Nodes swapped under their parent lead to misplaced leaves.
+	nodes := NewSimpleMap()
+	smt := NewSparseMerkleTree(nodes, nil, sha256.New(), InlineValues(), Depth(8), RawKeys())
+	smt.Update([]byte{0x00}, []byte("a"))
+	smt.Update([]byte{0x80}, []byte("b"))
+	if report, err := smt.Check(); err != nil || !report.OK() || report.ScannedValues {
+		t.Fatalf("got report %+v for a sound tree: %v", report, err)
+	}
+
+	data, _ := nodes.Get(smt.Root())
+	left, right := smt.th.parseNode(data)
+	swapped, swappedData := smt.th.digestNode(right, left)
+	nodes.Set(swapped, swappedData)
+	report, err := smt.CheckForRoot(swapped)
+	if err != nil {
+		t.Fatalf("returned error: %v", err)
+	}
+	misplaced := 0
+	for _, problem := range report.Problems {
+		if problem.Kind == MisplacedLeaf {
+			misplaced++
+		}
+	}
+	if misplaced != 2 {
+		t.Errorf("got problems %v, want 2 misplaced leaves", report.Problems)
+	}
+
+	// Malformed inner nodes are reported.
+	bad, badData := smt.th.digestNode(left, right[1:])
+	nodes.Set(bad, badData)
+	report, err = smt.CheckForRoot(bad)
+	if err != nil || len(report.Problems) == 0 || report.Problems[0].Kind != MalformedNode {
+		t.Errorf("got problems %v for a malformed root: %v", report.Problems, err)
+	}
+}
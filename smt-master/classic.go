@@ -0,0 +1,293 @@
+package smt
+
+import (
+	"bytes"
+	"errors"
+	"hash"
+)
+
+// ErrBadNode is returned when the data of a node in the store is malformed.
+var ErrBadNode = errors.New("bad node")
+
+// ClassicSparseMerkleTree is a Sparse Merkle tree in the classic design, as
+// assumed by many circuits and contracts: every leaf is at the bottom of the
+// tree, the hash of an empty leaf is all zeros and the hash of an empty subtree
+// of height h is the digest of two empty subtrees of height h-1. The hash of a
+// leaf is the digest of its value, and the hash of an inner node is the digest
+// of the concatenation of the hashes of its children, without prefixes.
+//
+// Only the Depth and RawKeys options apply to classic trees; creating a classic
+// tree or verifying its proofs with any other option panics. Nodes and values
+// are stored by their hashes in a single MapStore. Nodes are never deleted, as
+// identical subtrees are shared within and between roots, so every root the
+// tree had remains readable.
+type ClassicSparseMerkleTree struct {
+	th    treeHasher
+	nodes MapStore
+	root  []byte
+
+	hasherID HasherID
+
+	// defaultHashes are the hashes of empty subtrees, indexed by height.
+	defaultHashes [][]byte
+}
+
+// NewClassicSparseMerkleTree creates a new classic Sparse Merkle tree on an
+// empty MapStore.
+func NewClassicSparseMerkleTree(nodes MapStore, hasher hash.Hash, options ...Option) *ClassicSparseMerkleTree {
+	th := classicTreeHasher(hasher, options)
+	cmt := ClassicSparseMerkleTree{
+		th:            *th,
+		nodes:         nodes,
+		hasherID:      th.hasherID(),
+		defaultHashes: classicDefaultHashes(th),
+	}
+	cmt.SetRoot(cmt.defaultHashes[cmt.depth()])
+	return &cmt
+}
+
+// ImportClassicSparseMerkleTree imports a classic Sparse Merkle tree from a
+// non-empty MapStore. The options must be the ones the tree was created with.
+func ImportClassicSparseMerkleTree(nodes MapStore, hasher hash.Hash, root []byte, options ...Option) *ClassicSparseMerkleTree {
+	cmt := NewClassicSparseMerkleTree(nodes, hasher, options...)
+	cmt.SetRoot(root)
+	return cmt
+}
+
+// classicTreeHasher returns the tree hasher of a classic tree created with a
+// hasher and options. It panics if the options include any but Depth and
+// RawKeys, as classic trees have neither prefixes nor inline values, and do not
+// persist their root.
+func classicTreeHasher(hasher hash.Hash, options []Option) *treeHasher {
+	smt := SparseMerkleTree{th: *newTreeHasher(hasher)}
+	smt.applyOptions(options)
+	th := &smt.th
+	if smt.persistRoot || th.inlineValues || !bytes.Equal(th.leafPrefix, defaultLeafPrefix) || !bytes.Equal(th.nodePrefix, defaultNodePrefix) {
+		panic(errors.New("only the Depth and RawKeys options apply to classic trees"))
+	}
+	return th
+}
+
+// classicDefaultHashes returns the hashes of empty subtrees of each height,
+// from the empty leaf to the empty tree.
+func classicDefaultHashes(th *treeHasher) [][]byte {
+	defaultHashes := make([][]byte, th.pathSize()*8+1)
+	defaultHashes[0] = make([]byte, th.hasher.Size())
+	for h := 1; h < len(defaultHashes); h++ {
+		defaultHashes[h] = th.digest(classicNodeData(defaultHashes[h-1], defaultHashes[h-1]))
+	}
+	return defaultHashes
+}
+
+func classicNodeData(left []byte, right []byte) []byte {
+	data := make([]byte, 0, len(left)+len(right))
+	data = append(data, left...)
+	return append(data, right...)
+}
+
+// Root gets the root of the tree.
+func (cmt *ClassicSparseMerkleTree) Root() []byte {
+	return cmt.root
+}
+
+// SetRoot sets the root of the tree.
+func (cmt *ClassicSparseMerkleTree) SetRoot(root []byte) {
+	cmt.root = root
+}
+
+// HasherID returns the registry identifier of the hash function of the tree,
+// or HasherUnknown if it is not in the registry.
+func (cmt *ClassicSparseMerkleTree) HasherID() HasherID {
+	return cmt.hasherID
+}
+
+// DefaultHash returns the hash of an empty subtree of the given height, from 0
+// for an empty leaf to the depth of the tree for the empty tree.
+func (cmt *ClassicSparseMerkleTree) DefaultHash(height int) []byte {
+	return cmt.defaultHashes[height]
+}
+
+func (cmt *ClassicSparseMerkleTree) depth() int {
+	return cmt.th.pathSize() * 8
+}
+
+// Get gets the value of a key from the tree.
+func (cmt *ClassicSparseMerkleTree) Get(key []byte) ([]byte, error) {
+	return cmt.GetForRoot(key, cmt.Root())
+}
+
+// GetForRoot gets the value of a key from the tree at a specific root.
+func (cmt *ClassicSparseMerkleTree) GetForRoot(key []byte, root []byte) ([]byte, error) {
+	path, err := cmt.th.path(key)
+	if err != nil {
+		return nil, err
+	}
+	_, leafHash, err := cmt.sideNodesForRoot(path, root)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(leafHash, cmt.defaultHashes[0]) {
+		return defaultValue, nil
+	}
+	return cmt.nodes.Get(leafHash)
+}
+
+// Has returns true if the value at the given key is non-default, false
+// otherwise.
+func (cmt *ClassicSparseMerkleTree) Has(key []byte) (bool, error) {
+	val, err := cmt.Get(key)
+	return !bytes.Equal(defaultValue, val), err
+}
+
+// Update sets a new value for a key in the tree, and sets and returns the new
+// root of the tree.
+func (cmt *ClassicSparseMerkleTree) Update(key []byte, value []byte) ([]byte, error) {
+	newRoot, err := cmt.UpdateForRoot(key, value, cmt.Root())
+	if err != nil {
+		return nil, err
+	}
+	cmt.SetRoot(newRoot)
+	return newRoot, nil
+}
+
+// Delete deletes a value from tree. It returns the new root of the tree.
+func (cmt *ClassicSparseMerkleTree) Delete(key []byte) ([]byte, error) {
+	return cmt.Update(key, defaultValue)
+}
+
+// UpdateForRoot sets a new value for a key in the tree at a specific root, and
+// returns the new root.
+func (cmt *ClassicSparseMerkleTree) UpdateForRoot(key []byte, value []byte, root []byte) ([]byte, error) {
+	path, err := cmt.th.path(key)
+	if err != nil {
+		return nil, err
+	}
+	sideNodes, _, err := cmt.sideNodesForRoot(path, root)
+	if err != nil {
+		return nil, err
+	}
+
+	currentHash := cmt.defaultHashes[0]
+	if !bytes.Equal(value, defaultValue) {
+		currentHash = cmt.th.digest(value)
+		if err := cmt.nodes.Set(currentHash, value); err != nil {
+			return nil, err
+		}
+	}
+	for h, sideNode := range sideNodes {
+		if bytes.Equal(currentHash, cmt.defaultHashes[h]) && bytes.Equal(sideNode, cmt.defaultHashes[h]) {
+			// Empty subtrees are not stored.
+			currentHash = cmt.defaultHashes[h+1]
+			continue
+		}
+		var currentData []byte
+		if getBitAtFromMSB(path, cmt.depth()-1-h) == right {
+			currentData = classicNodeData(sideNode, currentHash)
+		} else {
+			currentData = classicNodeData(currentHash, sideNode)
+		}
+		currentHash = cmt.th.digest(currentData)
+		if err := cmt.nodes.Set(currentHash, currentData); err != nil {
+			return nil, err
+		}
+	}
+	return currentHash, nil
+}
+
+// sideNodesForRoot returns the side nodes of a path from a given root, from the
+// sibling of the leaf up, and the hash of the leaf.
+func (cmt *ClassicSparseMerkleTree) sideNodesForRoot(path []byte, root []byte) ([][]byte, []byte, error) {
+	sideNodes := make([][]byte, cmt.depth())
+	currentHash := root
+	for i := 0; i < cmt.depth(); i++ {
+		height := cmt.depth() - i
+		var leftNode, rightNode []byte
+		if bytes.Equal(currentHash, cmt.defaultHashes[height]) {
+			leftNode, rightNode = cmt.defaultHashes[height-1], cmt.defaultHashes[height-1]
+		} else {
+			data, err := cmt.nodes.Get(currentHash)
+			if err != nil {
+				return nil, nil, err
+			}
+			if len(data) != 2*cmt.th.hasher.Size() {
+				return nil, nil, ErrBadNode
+			}
+			leftNode, rightNode = data[:cmt.th.hasher.Size()], data[cmt.th.hasher.Size():]
+		}
+		if getBitAtFromMSB(path, i) == right {
+			sideNodes[height-1], currentHash = leftNode, rightNode
+		} else {
+			sideNodes[height-1], currentHash = rightNode, leftNode
+		}
+	}
+	return sideNodes, currentHash, nil
+}
+
+// Prove generates a Merkle proof for a key against the current root.
+func (cmt *ClassicSparseMerkleTree) Prove(key []byte) (ClassicMerkleProof, error) {
+	return cmt.ProveForRoot(key, cmt.Root())
+}
+
+// ProveForRoot generates a Merkle proof for a key against a specific root.
+func (cmt *ClassicSparseMerkleTree) ProveForRoot(key []byte, root []byte) (ClassicMerkleProof, error) {
+	path, err := cmt.th.path(key)
+	if err != nil {
+		return ClassicMerkleProof{}, err
+	}
+	sideNodes, _, err := cmt.sideNodesForRoot(path, root)
+	if err != nil {
+		return ClassicMerkleProof{}, err
+	}
+	return ClassicMerkleProof{SideNodes: sideNodes, HasherID: cmt.hasherID}, nil
+}
+
+// ClassicMerkleProof is a Merkle proof for an element in a
+// ClassicSparseMerkleTree, which proves membership and non-membership alike.
+type ClassicMerkleProof struct {
+	// SideNodes are the siblings of the nodes on the path of the key, from the
+	// sibling of the leaf up to the sibling of the child of the root. There is
+	// one side node per level of the tree, including the hashes of empty
+	// subtrees.
+	SideNodes [][]byte
+
+	// HasherID identifies the hash function of the tree the proof was
+	// generated from. Proofs with HasherUnknown are checked against any hash
+	// function; other proofs are rejected by a different hash function.
+	HasherID HasherID
+}
+
+func (proof *ClassicMerkleProof) sanityCheck(th *treeHasher) bool {
+	if !proof.HasherID.matches(th) || len(proof.SideNodes) != th.pathSize()*8 {
+		return false
+	}
+	for _, v := range proof.SideNodes {
+		if len(v) != th.hasher.Size() {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyClassicProof verifies a Merkle proof of a classic Sparse Merkle tree.
+// The value of a non-membership proof is the empty value. The options must be
+// the ones of the tree the proof was generated from.
+func VerifyClassicProof(proof ClassicMerkleProof, root []byte, key []byte, value []byte, hasher hash.Hash, options ...Option) bool {
+	th := classicTreeHasher(hasher, options)
+	path, err := th.path(key)
+	if err != nil || !proof.sanityCheck(th) {
+		return false
+	}
+
+	currentHash := make([]byte, th.hasher.Size())
+	if !bytes.Equal(value, defaultValue) {
+		currentHash = th.digest(value)
+	}
+	for h, sideNode := range proof.SideNodes {
+		if getBitAtFromMSB(path, len(proof.SideNodes)-1-h) == right {
+			currentHash = th.digest(classicNodeData(sideNode, currentHash))
+		} else {
+			currentHash = th.digest(classicNodeData(currentHash, sideNode))
+		}
+	}
+	return bytes.Equal(currentHash, root)
+}
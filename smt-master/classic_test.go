@@ -0,0 +1,137 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestClassicSparseMerkleTree(t *testing.T) {
+	kv := map[string]string{"testKey": "testValue", "testKey2": "testValue2", "foo": "bar"}
+	cmt := NewClassicSparseMerkleTree(NewSimpleMap(), sha256.New())
+
+	if want := referenceClassicRoot(sha256.New(), nil, 32, false); !bytes.Equal(cmt.Root(), want) {
+		t.Errorf("got root %x for empty tree, want %x", cmt.Root(), want)
+	}
+	for k, v := range kv {
+		if _, err := cmt.Update([]byte(k), []byte(v)); err != nil {
+			t.Fatalf("returned error when updating key %q: %v", k, err)
+		}
+	}
+	if want := referenceClassicRoot(sha256.New(), kv, 32, false); !bytes.Equal(cmt.Root(), want) {
+		t.Errorf("got root %x, want %x", cmt.Root(), want)
+	}
+	for k, v := range kv {
+		value, err := cmt.Get([]byte(k))
+		if err != nil || !bytes.Equal(value, []byte(v)) {
+			t.Errorf("got value %q for key %q, want %q: %v", value, k, v, err)
+		}
+	}
+	root := cmt.Root()
+
+	// Deleting a key restores the previous root, and the old root remains
+	// readable.
+	cmt.Update([]byte("extra"), []byte("value"))
+	if has, _ := cmt.Has([]byte("extra")); !has {
+		t.Error("updated key is absent")
+	}
+	if _, err := cmt.Delete([]byte("extra")); err != nil {
+		t.Fatalf("returned error when deleting key: %v", err)
+	}
+	if !bytes.Equal(cmt.Root(), root) {
+		t.Errorf("got root %x after deleting a key, want %x", cmt.Root(), root)
+	}
+	if value, err := cmt.GetForRoot([]byte("testKey"), root); err != nil || string(value) != "testValue" {
+		t.Errorf("got value %q at old root: %v", value, err)
+	}
+
+	for _, key := range []string{"testKey", "absentKey"} {
+		value, _ := cmt.Get([]byte(key))
+		proof, err := cmt.Prove([]byte(key))
+		if err != nil {
+			t.Fatalf("returned error when proving key %q: %v", key, err)
+		}
+		if len(proof.SideNodes) != 256 {
+			t.Errorf("got %d side nodes, want 256", len(proof.SideNodes))
+		}
+		if !VerifyClassicProof(proof, root, []byte(key), value, sha256.New()) {
+			t.Errorf("valid proof for key %q failed to verify", key)
+		}
+		if VerifyClassicProof(proof, root, []byte(key), []byte("wrong"), sha256.New()) {
+			t.Errorf("proof for key %q verified with a wrong value", key)
+		}
+
+		encoded, _ := proof.MarshalBinary()
+		var decoded ClassicMerkleProof
+		if err := decoded.UnmarshalBinary(encoded); err != nil {
+			t.Fatalf("returned error when decoding proof: %v", err)
+		}
+		if !VerifyClassicProof(decoded, root, []byte(key), value, sha256.New()) {
+			t.Errorf("decoded proof for key %q failed to verify", key)
+		}
+		var other SparseMerkleProof
+		if err := other.UnmarshalBinary(encoded); err == nil {
+			t.Error("classic proof decoded as a Sparse Merkle proof")
+		}
+	}
+
+	// Proofs must have one side node per level.
+	proof, _ := cmt.Prove([]byte("testKey"))
+	proof.SideNodes = proof.SideNodes[1:]
+	if VerifyClassicProof(proof, root, []byte("testKey"), []byte("testValue"), sha256.New()) {
+		t.Error("proof with missing side node verified")
+	}
+}
+
+func TestClassicSparseMerkleTreeDepth(t *testing.T) {
+	options := []Option{Depth(32), RawKeys()}
+	cmt := NewClassicSparseMerkleTree(NewSimpleMap(), sha256.New(), options...)
+
+	if want := referenceClassicRoot(sha256.New(), nil, 4, true); !bytes.Equal(cmt.DefaultHash(32), want) {
+		t.Errorf("got default hash %x for height 32, want %x", cmt.DefaultHash(32), want)
+	}
+	kv := make(map[string]string)
+	for _, i := range []byte{1, 2, 3} {
+		kv[string([]byte{0, 0, 0, i})] = string([]byte{'v', '0' + i})
+		cmt.Update([]byte{0, 0, 0, i}, []byte{'v', '0' + i})
+	}
+	if want := referenceClassicRoot(sha256.New(), kv, 4, true); !bytes.Equal(cmt.Root(), want) {
+		t.Errorf("got root %x, want %x", cmt.Root(), want)
+	}
+
+	proof, err := cmt.Prove([]byte{0, 0, 0, 2})
+	if err != nil {
+		t.Fatalf("returned error when proving key: %v", err)
+	}
+	if len(proof.SideNodes) != 32 || !bytes.Equal(proof.SideNodes[31], cmt.DefaultHash(31)) {
+		t.Errorf("got %d side nodes", len(proof.SideNodes))
+	}
+	if !VerifyClassicProof(proof, cmt.Root(), []byte{0, 0, 0, 2}, []byte("v2"), sha256.New(), options...) {
+		t.Error("valid proof failed to verify")
+	}
+	if VerifyClassicProof(proof, cmt.Root(), []byte{0, 0, 0, 2}, []byte("v2"), sha256.New()) {
+		t.Error("proof verified without the tree options")
+	}
+	if _, err := cmt.Get([]byte{1}); err == nil {
+		t.Error("no error for key of the wrong size")
+	}
+}
+
+func TestClassicSparseMerkleTreeInvalidOptions(t *testing.T) {
+	for i, options := range [][]Option{
+		{LeafPrefix([]byte{2})},
+		{NodePrefix([]byte{3})},
+		{InlineValues()},
+		{PersistRoot()},
+		{Depth(64)},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("creating a classic tree with options %d did not panic", i)
+				}
+			}()
+			NewClassicSparseMerkleTree(NewSimpleMap(), sha256.New(), options...)
+		}()
+	}
+}
@@ -15,9 +15,10 @@ type DeepSparseMerkleSubTree struct {
 }
 
 // NewDeepSparseMerkleSubTree creates a new deep Sparse Merkle subtree on an empty MapStore.
-func NewDeepSparseMerkleSubTree(nodes, values MapStore, hasher hash.Hash, root []byte) *DeepSparseMerkleSubTree {
+// The options must be the ones of the tree the branches are taken from.
+func NewDeepSparseMerkleSubTree(nodes, values MapStore, hasher hash.Hash, root []byte, options ...Option) *DeepSparseMerkleSubTree {
 	return &DeepSparseMerkleSubTree{
-		SparseMerkleTree: ImportSparseMerkleTree(nodes, values, hasher, root),
+		SparseMerkleTree: ImportSparseMerkleTree(nodes, values, hasher, root, options...),
 	}
 }
 
@@ -28,13 +29,17 @@ func NewDeepSparseMerkleSubTree(nodes, values MapStore, hasher hash.Hash, root [
 // If the leaf may be updated (e.g. during a state transition fraud proof),
 // an updatable proof should be used. See SparseMerkleTree.ProveUpdatable.
 func (dsmst *DeepSparseMerkleSubTree) AddBranch(proof SparseMerkleProof, key []byte, value []byte) error {
-	result, updates := verifyProofWithUpdates(proof, dsmst.Root(), key, value, dsmst.th.hasher)
+	result, updates := verifyProofWithUpdates(proof, dsmst.Root(), key, value, &dsmst.th)
 	if !result {
 		return ErrBadProof
 	}
 
 	if !bytes.Equal(value, defaultValue) { // Membership proof.
-		if err := dsmst.values.Set(dsmst.th.path(key), value); err != nil {
+		path, err := dsmst.th.path(key)
+		if err != nil {
+			return err
+		}
+		if err := dsmst.setValue(path, value); err != nil {
 			return err
 		}
 	}
@@ -64,6 +69,11 @@ func (dsmst *DeepSparseMerkleSubTree) AddBranch(proof SparseMerkleProof, key []b
 // Use if a key was _not_ previously added with AddBranch, otherwise use Get.
 // Errors if the key cannot be reached by descending.
 func (smt *SparseMerkleTree) GetDescend(key []byte) ([]byte, error) {
+	path, err := smt.th.path(key)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get tree's root
 	root := smt.Root()
 
@@ -72,7 +82,6 @@ func (smt *SparseMerkleTree) GetDescend(key []byte) ([]byte, error) {
 		return defaultValue, nil
 	}
 
-	path := smt.th.path(key)
 	currentHash := root
 	for i := 0; i < smt.depth(); i++ {
 		currentData, err := smt.nodes.Get(currentHash)
@@ -86,11 +95,7 @@ func (smt *SparseMerkleTree) GetDescend(key []byte) ([]byte, error) {
 				return defaultValue, nil
 			}
 			// Otherwise, yes. Return the value.
-			value, err := smt.values.Get(path)
-			if err != nil {
-				return nil, err
-			}
-			return value, nil
+			return smt.leafValue(path, currentData)
 		}
 
 		leftNode, rightNode := smt.th.parseNode(currentData)
@@ -106,14 +111,17 @@ func (smt *SparseMerkleTree) GetDescend(key []byte) ([]byte, error) {
 		}
 	}
 
-	// The following lines of code should only be reached if the path is 256
-	// nodes high, which should be very unlikely if the underlying hash function
-	// is collision-resistant.
-	value, err := smt.values.Get(path)
+	// The following lines of code should only be reached if the path is as
+	// high as the depth of the tree, which should be very unlikely for the
+	// default depth if the underlying hash function is collision-resistant.
+	if !smt.th.inlineValues {
+		return smt.values.Get(path)
+	}
+	currentData, err := smt.nodes.Get(currentHash)
 	if err != nil {
 		return nil, err
 	}
-	return value, nil
+	return smt.leafValue(path, currentData)
 }
 
 // HasDescend returns true if the value at the given key is non-default, false
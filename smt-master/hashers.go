@@ -0,0 +1,161 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+	"sync"
+
+	"MPT_MOI/blake2b"
+	"MPT_MOI/keccak"
+)
+
+// HasherID identifies a hash function in the hasher registry. The identifiers
+// of the built-in hash functions are stable, so they can be stored along with
+// roots and proofs.
+type HasherID uint8
+
+const (
+	// HasherUnknown is the identifier of hash functions not in the registry.
+	HasherUnknown HasherID = iota
+	// SHA256 is SHA-256.
+	SHA256
+	// SHA512_256 is SHA-512/256.
+	SHA512_256
+	// SHA3_256 is SHA3-256.
+	SHA3_256
+	// Blake2b256 is BLAKE2b-256.
+	Blake2b256
+	// Keccak256 is Keccak-256 with the original Keccak padding, as used by
+	// Ethereum.
+	Keccak256
+)
+
+// ErrUnknownHasher is returned when looking up a hash function that is not in
+// the registry.
+var ErrUnknownHasher = errors.New("unknown hash function")
+
+type registeredHasher struct {
+	name        string
+	newHasher   func() hash.Hash
+	fingerprint []byte
+}
+
+var hasherRegistry = struct {
+	sync.RWMutex
+	byID map[HasherID]*registeredHasher
+}{byID: make(map[HasherID]*registeredHasher)}
+
+func init() {
+	mustRegisterHasher(SHA256, "sha256", sha256.New)
+	mustRegisterHasher(SHA512_256, "sha512/256", sha512.New512_256)
+	mustRegisterHasher(SHA3_256, "sha3-256", keccak.New256)
+	mustRegisterHasher(Blake2b256, "blake2b-256", blake2b.New256)
+	mustRegisterHasher(Keccak256, "keccak-256", keccak.NewLegacyKeccak256)
+}
+
+func mustRegisterHasher(id HasherID, name string, newHasher func() hash.Hash) {
+	if err := RegisterHasher(id, name, newHasher); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterHasher adds a hash function to the registry under an identifier and
+// a name, neither of which may already be in use.
+func RegisterHasher(id HasherID, name string, newHasher func() hash.Hash) error {
+	if id == HasherUnknown {
+		return errors.New("cannot register a hash function as HasherUnknown")
+	}
+	hasherRegistry.Lock()
+	defer hasherRegistry.Unlock()
+	if registered, ok := hasherRegistry.byID[id]; ok {
+		return fmt.Errorf("hasher id %d is already registered to %s", id, registered.name)
+	}
+	for _, registered := range hasherRegistry.byID {
+		if registered.name == name {
+			return fmt.Errorf("hasher name %s is already registered", name)
+		}
+	}
+	hasherRegistry.byID[id] = &registeredHasher{
+		name:        name,
+		newHasher:   newHasher,
+		fingerprint: newTreeHasher(newHasher()).fingerprint(),
+	}
+	return nil
+}
+
+// RegisteredHashers returns the identifiers of the hash functions in the
+// registry, in ascending order.
+func RegisteredHashers() []HasherID {
+	hasherRegistry.RLock()
+	defer hasherRegistry.RUnlock()
+	ids := make([]HasherID, 0, len(hasherRegistry.byID))
+	for id := range hasherRegistry.byID {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func lookupHasher(id HasherID) *registeredHasher {
+	hasherRegistry.RLock()
+	defer hasherRegistry.RUnlock()
+	return hasherRegistry.byID[id]
+}
+
+// String returns the registered name of the hash function.
+func (id HasherID) String() string {
+	if registered := lookupHasher(id); registered != nil {
+		return registered.name
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(id))
+}
+
+// New returns a new instance of the hash function.
+func (id HasherID) New() (hash.Hash, error) {
+	registered := lookupHasher(id)
+	if registered == nil {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownHasher, uint8(id))
+	}
+	return registered.newHasher(), nil
+}
+
+// HasherByName looks up the identifier of a hash function by its name.
+func HasherByName(name string) (HasherID, error) {
+	hasherRegistry.RLock()
+	defer hasherRegistry.RUnlock()
+	for id, registered := range hasherRegistry.byID {
+		if registered.name == name {
+			return id, nil
+		}
+	}
+	return HasherUnknown, fmt.Errorf("%w: %s", ErrUnknownHasher, name)
+}
+
+// IdentifyHasher returns the identifier of the hash function computed by a
+// hasher, or HasherUnknown if it is not in the registry. The hasher must be
+// in its reset state.
+func IdentifyHasher(hasher hash.Hash) HasherID {
+	return newTreeHasher(hasher).hasherID()
+}
+
+func identifyFingerprint(fingerprint []byte) HasherID {
+	hasherRegistry.RLock()
+	defer hasherRegistry.RUnlock()
+	for id, registered := range hasherRegistry.byID {
+		if bytes.Equal(registered.fingerprint, fingerprint) {
+			return id
+		}
+	}
+	return HasherUnknown
+}
+
+// matches reports whether a proof generated with the hash function id can be
+// checked with a tree hasher.
+func (id HasherID) matches(th *treeHasher) bool {
+	return id == HasherUnknown || id == th.hasherID()
+}
@@ -0,0 +1,148 @@
+package smt
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"hash"
+	"testing"
+
+	"MPT_MOI/keccak"
+)
+
+func TestHasherRegistry(t *testing.T) {
+	// The identifiers of the built-in hash functions must never change.
+	builtin := []struct {
+		id   HasherID
+		num  uint8
+		name string
+	}{
+		{SHA256, 1, "sha256"},
+		{SHA512_256, 2, "sha512/256"},
+		{SHA3_256, 3, "sha3-256"},
+		{Blake2b256, 4, "blake2b-256"},
+		{Keccak256, 5, "keccak-256"},
+	}
+	for _, b := range builtin {
+		if uint8(b.id) != b.num {
+			t.Errorf("%s has id %d, want %d", b.name, b.id, b.num)
+		}
+		if b.id.String() != b.name {
+			t.Errorf("id %d has name %s, want %s", b.num, b.id, b.name)
+		}
+		if id, err := HasherByName(b.name); err != nil || id != b.id {
+			t.Errorf("HasherByName(%s) = %d, %v", b.name, id, err)
+		}
+		hasher, err := b.id.New()
+		if err != nil {
+			t.Fatalf("returned error when creating %s: %v", b.name, err)
+		}
+		if id := IdentifyHasher(hasher); id != b.id {
+			t.Errorf("IdentifyHasher identified %s as %s", b.name, id)
+		}
+	}
+	if ids := RegisteredHashers(); len(ids) < len(builtin) || ids[0] != SHA256 {
+		t.Errorf("unexpected registered hashers %v", ids)
+	}
+
+	if _, err := HasherByName("md5"); !errors.Is(err, ErrUnknownHasher) {
+		t.Errorf("got error %v for an unknown name, want ErrUnknownHasher", err)
+	}
+	if _, err := HasherID(200).New(); !errors.Is(err, ErrUnknownHasher) {
+		t.Errorf("got error %v for an unknown id, want ErrUnknownHasher", err)
+	}
+	if id := IdentifyHasher(sha512.New()); id != HasherUnknown {
+		t.Errorf("identified an unregistered hasher as %s", id)
+	}
+
+	if err := RegisterHasher(SHA256, "other", sha256.New); err == nil {
+		t.Error("registered a hasher under an id in use")
+	}
+	if err := RegisterHasher(200, "sha256", sha256.New); err == nil {
+		t.Error("registered a hasher under a name in use")
+	}
+	if err := RegisterHasher(HasherUnknown, "unknown", sha256.New); err == nil {
+		t.Error("registered a hasher as HasherUnknown")
+	}
+}
+
+func TestTreeHasherID(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha512.New512_256())
+	if smt.HasherID() != SHA512_256 {
+		t.Errorf("tree has hasher id %s, want sha512/256", smt.HasherID())
+	}
+	root, _ := smt.Update([]byte("testKey"), []byte("testValue"))
+
+	proof, _ := smt.Prove([]byte("testKey"))
+	if proof.HasherID != SHA512_256 {
+		t.Errorf("proof has hasher id %s, want sha512/256", proof.HasherID)
+	}
+	if !VerifyProof(proof, root, []byte("testKey"), []byte("testValue"), sha512.New512_256()) {
+		t.Error("valid proof failed to verify")
+	}
+
+	// These hash functions have the same digest size, so only the identifier
+	// tells them apart before the root is recomputed.
+	for _, hasher := range []hash.Hash{sha256.New(), keccak.NewLegacyKeccak256()} {
+		if passesSanityCheck(proof, hasher) {
+			t.Error("proof passed the sanity check of a different hash function")
+		}
+	}
+	compact, err := smt.ProveCompact([]byte("testKey"))
+	if err != nil || compact.HasherID != SHA512_256 {
+		t.Errorf("compact proof has hasher id %s, %v", compact.HasherID, err)
+	}
+	if VerifyCompactProof(compact, root, []byte("testKey"), []byte("testValue"), sha256.New()) {
+		t.Error("compact proof verified with a different hash function")
+	}
+	if _, err := DecompactProof(compact, sha256.New()); !errors.Is(err, ErrBadProof) {
+		t.Errorf("got error %v when decompacting with a different hash function", err)
+	}
+	decompacted, _ := DecompactProof(compact, sha512.New512_256())
+	if decompacted.HasherID != SHA512_256 {
+		t.Error("decompacted proof lost its hasher id")
+	}
+
+	// Proofs of unregistered hash functions can be checked by any hasher.
+	dummy := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha512.New())
+	dummyRoot, _ := dummy.Update([]byte("testKey"), []byte("testValue"))
+	proof, _ = dummy.Prove([]byte("testKey"))
+	if proof.HasherID != HasherUnknown {
+		t.Errorf("proof of an unregistered hasher has id %s", proof.HasherID)
+	}
+	if !VerifyProof(proof, dummyRoot, []byte("testKey"), []byte("testValue"), sha512.New()) {
+		t.Error("valid proof of an unregistered hasher failed to verify")
+	}
+}
+
+func passesSanityCheck(proof SparseMerkleProof, hasher hash.Hash) bool {
+	return proof.sanityCheck(newTreeHasher(hasher))
+}
+
+func TestOpenSparseMerkleTreeByHasherID(t *testing.T) {
+	nodes, values := NewSimpleMap(), NewSimpleMap()
+	smt := NewSparseMerkleTree(nodes, values, sha512.New512_256(), PersistRoot())
+	smt.Update([]byte("testKey"), []byte("testValue"))
+
+	md, err := ReadTreeMetadata(nodes)
+	if err != nil || md.HasherID != SHA512_256 {
+		t.Fatalf("metadata has hasher id %v, %v", md, err)
+	}
+	opened, err := OpenSparseMerkleTree(nodes, values, nil)
+	if err != nil {
+		t.Fatalf("returned error when opening tree by hasher id: %v", err)
+	}
+	if opened.HasherID() != SHA512_256 {
+		t.Errorf("opened tree has hasher id %s", opened.HasherID())
+	}
+	if value, _ := opened.Get([]byte("testKey")); string(value) != "testValue" {
+		t.Errorf("opened tree has value %q", value)
+	}
+
+	// Trees of unregistered hash functions cannot be opened by identifier.
+	nodes = NewSimpleMap()
+	NewSparseMerkleTree(nodes, NewSimpleMap(), sha512.New(), PersistRoot()).Update([]byte("testKey"), []byte("testValue"))
+	if _, err = OpenSparseMerkleTree(nodes, NewSimpleMap(), nil); !errors.Is(err, ErrUnknownHasher) {
+		t.Errorf("got error %v when opening by an unknown hasher id, want ErrUnknownHasher", err)
+	}
+}
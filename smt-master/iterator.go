@@ -45,12 +45,13 @@ func (n *NodeIteratorSMT) Iterate() [][]byte {
 		} else {
 			//fmt.Println("Not a leaf")
 			leftNode, rightNode := n.Trie.th.parseNode(currentData)
-			if !bytes.Equal(leftNode, n.Trie.th.placeholder()) && !bytes.Equal(leftNode, n.Trie.th.nullLeaf()) {
-				tempKey = append(tempKey, leftNode)
-			}
+			//The right node is pushed first so that the left subtree is visited first
 			if !bytes.Equal(rightNode, n.Trie.th.placeholder()) && !bytes.Equal(rightNode, n.Trie.th.nullLeaf()) {
 				tempKey = append(tempKey, rightNode)
 			}
+			if !bytes.Equal(leftNode, n.Trie.th.placeholder()) && !bytes.Equal(leftNode, n.Trie.th.nullLeaf()) {
+				tempKey = append(tempKey, leftNode)
+			}
 
 			//fmt.Println("Left Key: ", leftNode, "\nRight Key: ", rightNode)
 		}
@@ -59,6 +60,48 @@ func (n *NodeIteratorSMT) Iterate() [][]byte {
 	return key
 }
 
+// IterateLeaves calls fn with the path and the value of each leaf at the
+// current root of the tree, in ascending order of paths, and stops at the first
+// error returned by fn. With the RawKeys option the paths are the keys, so the
+// leaves are visited in key order.
+func (smt *SparseMerkleTree) IterateLeaves(fn func(path, value []byte) error) error {
+	if bytes.Equal(smt.Root(), smt.th.placeholder()) {
+		return nil
+	}
+
+	stack := [][]byte{smt.Root()}
+	for len(stack) > 0 {
+		var currentHash []byte
+		currentHash, stack = pop(stack)
+		currentData, err := smt.nodes.Get(currentHash)
+		if err != nil {
+			return err
+		}
+
+		if smt.th.isLeaf(currentData) {
+			path, _ := smt.th.parseLeaf(currentData)
+			value, err := smt.leafValue(path, currentData)
+			if err != nil {
+				return err
+			}
+			if err := fn(path, value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Push the right child first, so that the left subtree is visited first.
+		leftNode, rightNode := smt.th.parseNode(currentData)
+		if !bytes.Equal(rightNode, smt.th.placeholder()) {
+			stack = append(stack, rightNode)
+		}
+		if !bytes.Equal(leftNode, smt.th.placeholder()) {
+			stack = append(stack, leftNode)
+		}
+	}
+	return nil
+}
+
 //PrintKeys() prints all the values stored of each key
 func (n *NodeIteratorSMT) PrintKeys(key [][]byte) {
 	fmt.Println("Number of keys: ", len(key))
@@ -0,0 +1,76 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestIterateLeaves(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), RawKeys())
+	if err := smt.IterateLeaves(func(path, value []byte) error {
+		t.Error("visited a leaf of an empty tree")
+		return nil
+	}); err != nil {
+		t.Errorf("returned error when iterating an empty tree: %v", err)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	kv := make(map[string][]byte)
+	for i := 0; i < 100; i++ {
+		key := make([]byte, 32)
+		r.Read(key)
+		// Give some keys long common prefixes.
+		if i%4 == 0 {
+			copy(key, []byte{0xab, 0xcd, 0xef})
+		}
+		kv[string(key)] = []byte{byte(i)}
+		smt.Update(key, []byte{byte(i)})
+	}
+	for i := 0; i < 100; i += 10 {
+		for k := range kv {
+			smt.Delete([]byte(k))
+			delete(kv, k)
+			break
+		}
+	}
+
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var visited []string
+	err := smt.IterateLeaves(func(path, value []byte) error {
+		if !bytes.Equal(value, kv[string(path)]) {
+			t.Errorf("got value %x for key %x, want %x", value, path, kv[string(path)])
+		}
+		visited = append(visited, string(path))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("returned error when iterating: %v", err)
+	}
+	if len(visited) != len(keys) {
+		t.Fatalf("visited %d leaves, want %d", len(visited), len(keys))
+	}
+	for i := range keys {
+		if visited[i] != keys[i] {
+			t.Fatalf("leaf %d is %x, want %x: leaves are not in key order", i, visited[i], keys[i])
+		}
+	}
+
+	errStop := errors.New("stop")
+	count := 0
+	err = smt.IterateLeaves(func(path, value []byte) error {
+		count++
+		return errStop
+	})
+	if !errors.Is(err, errStop) || count != 1 {
+		t.Errorf("iteration did not stop at the first error: %v after %d leaves", err, count)
+	}
+}
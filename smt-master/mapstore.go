@@ -1,6 +1,7 @@
 package smt
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -11,6 +12,28 @@ type MapStore interface {
 	Delete(key []byte) error            // Delete deletes a key.
 }
 
+// IterableMapStore is a MapStore whose contents can be enumerated.
+type IterableMapStore interface {
+	MapStore
+	// Iterate calls fn for every key-value pair in the store, in no particular
+	// order. Iteration stops at the first error returned by fn, which is
+	// returned to the caller.
+	Iterate(fn func(key []byte, value []byte) error) error
+}
+
+// UncountedMapStore is a MapStore that counts the writes to each key, such as
+// a RefCountedMapStore, and that can also write a key without counting it, so
+// that the key is overwritten by every uncounted write.
+type UncountedMapStore interface {
+	MapStore
+	// SetUncounted updates the value for a key without counting the write.
+	SetUncounted(key []byte, value []byte) error
+}
+
+// ErrNotIterable is returned when iterating over a store that wraps a MapStore
+// which is not an IterableMapStore.
+var ErrNotIterable = errors.New("map store is not iterable")
+
 // InvalidKeyError is thrown when a key that does not exist is being accessed.
 type InvalidKeyError struct {
 	Key []byte
@@ -55,3 +78,13 @@ func (sm *SimpleMap) Delete(key []byte) error {
 	}
 	return &InvalidKeyError{Key: key}
 }
+
+// Iterate calls fn for every key-value pair in the map, in no particular order.
+func (sm *SimpleMap) Iterate(fn func(key []byte, value []byte) error) error {
+	for k, v := range sm.m {
+		if err := fn([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package smt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+)
+
+// metadataKey is the key of the tree metadata record in the node store. It is
+// shorter than the digest of any supported hash function, so it cannot
+// collide with the key of a node.
+var metadataKey = []byte("\x00smt:metadata")
+
+const metadataFormatVersion = 2
+
+// hasherFingerprintData is digested to identify the hash function of a tree.
+var hasherFingerprintData = []byte("smt hasher fingerprint")
+
+// ErrNoTreeMetadata is returned when opening a tree from a store without a
+// metadata record.
+var ErrNoTreeMetadata = errors.New("store has no tree metadata")
+
+// ErrHasherMismatch is returned when opening a tree from a store that was
+// created with a different hash function.
+var ErrHasherMismatch = errors.New("store was created with a different hash function")
+
+// TreeMetadata is the record persisted in the node store of a tree created
+// with the PersistRoot option.
+type TreeMetadata struct {
+	// Root is the root of the tree at the last commit.
+	Root []byte
+
+	// HasherFingerprint identifies the hash function of the tree. It is the
+	// digest of a fixed string.
+	HasherFingerprint []byte
+
+	// HasherID is the registry identifier of the hash function of the tree,
+	// or HasherUnknown if it is not in the registry.
+	HasherID HasherID
+
+	// Version is the number of commits made to the tree.
+	Version uint64
+
+	// Timestamp is the time of the last commit.
+	Timestamp time.Time
+}
+
+func (md *TreeMetadata) marshal() []byte {
+	data := []byte{metadataFormatVersion}
+	data = appendLengthPrefixed(data, md.Root)
+	data = appendLengthPrefixed(data, md.HasherFingerprint)
+	data = append(data, byte(md.HasherID))
+	trailer := make([]byte, 16)
+	binary.BigEndian.PutUint64(trailer[:8], md.Version)
+	binary.BigEndian.PutUint64(trailer[8:], uint64(md.Timestamp.UnixNano()))
+	return append(data, trailer...)
+}
+
+func (md *TreeMetadata) unmarshal(data []byte) error {
+	if len(data) == 0 || data[0] != metadataFormatVersion {
+		return errors.New("unsupported tree metadata format")
+	}
+	r := data[1:]
+	var err error
+	if md.Root, r, err = readLengthPrefixed(r); err != nil {
+		return fmt.Errorf("malformed tree metadata: %w", err)
+	}
+	if md.HasherFingerprint, r, err = readLengthPrefixed(r); err != nil {
+		return fmt.Errorf("malformed tree metadata: %w", err)
+	}
+	if len(r) != 17 {
+		return errors.New("malformed tree metadata")
+	}
+	md.HasherID, r = HasherID(r[0]), r[1:]
+	md.Version = binary.BigEndian.Uint64(r[:8])
+	md.Timestamp = time.Unix(0, int64(binary.BigEndian.Uint64(r[8:])))
+	return nil
+}
+
+// ReadTreeMetadata reads the metadata record from the node store of a tree. It
+// returns ErrNoTreeMetadata if the store has none.
+func ReadTreeMetadata(nodes MapStore) (*TreeMetadata, error) {
+	data, err := nodes.Get(metadataKey)
+	if err != nil {
+		var invalidKeyError *InvalidKeyError
+		if errors.As(err, &invalidKeyError) {
+			return nil, ErrNoTreeMetadata
+		}
+		return nil, err
+	}
+	var md TreeMetadata
+	if err := md.unmarshal(data); err != nil {
+		return nil, err
+	}
+	return &md, nil
+}
+
+// OpenSparseMerkleTree opens a Sparse Merkle tree from a MapStore written by a
+// tree created with the PersistRoot option, at the root of its last commit.
+// The opened tree also persists its root. If hasher is nil, the hash function
+// is looked up in the registry by the identifier in the metadata.
+//
+// It returns ErrNoTreeMetadata if the store was not written by such a tree,
+// and ErrHasherMismatch if it was created with a different hash function.
+func OpenSparseMerkleTree(nodes, values MapStore, hasher hash.Hash, options ...Option) (*SparseMerkleTree, error) {
+	md, err := ReadTreeMetadata(nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasher == nil {
+		if hasher, err = md.HasherID.New(); err != nil {
+			return nil, err
+		}
+	}
+	smt := NewSparseMerkleTree(nodes, values, hasher, append(options, PersistRoot())...)
+	if !bytes.Equal(md.HasherFingerprint, smt.th.fingerprint()) {
+		return nil, ErrHasherMismatch
+	}
+	smt.SetRoot(md.Root)
+	smt.version = md.Version
+
+	return smt, nil
+}
+
+// CommitRoot writes the current root of the tree to the metadata record in
+// the node store, incrementing the version of the tree. It is called by Update
+// and Delete if the tree was created with the PersistRoot option. With an
+// UncountedMapStore, such as a RefCountedMapStore, the record is written
+// without being counted.
+func (smt *SparseMerkleTree) CommitRoot() error {
+	md := TreeMetadata{
+		Root:              smt.Root(),
+		HasherFingerprint: smt.th.fingerprint(),
+		HasherID:          smt.hasherID,
+		Version:           smt.version + 1,
+		Timestamp:         time.Now(),
+	}
+	set := smt.nodes.Set
+	if nodes, ok := smt.nodes.(UncountedMapStore); ok {
+		// The record is overwritten by every commit, which a counted Set
+		// would only do for the first one.
+		set = nodes.SetUncounted
+	}
+	if err := set(metadataKey, md.marshal()); err != nil {
+		return err
+	}
+	smt.version = md.Version
+	return nil
+}
+
+// Version returns the number of commits made to the tree. It is only tracked
+// for trees created with the PersistRoot option.
+func (smt *SparseMerkleTree) Version() uint64 {
+	return smt.version
+}
+
+// SetVersion sets the number of commits made to the tree, which the next
+// commit increments, so that a tree rebuilt or restored from another one can
+// carry on its versions.
+func (smt *SparseMerkleTree) SetVersion(version uint64) {
+	smt.version = version
+}
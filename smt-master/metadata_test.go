@@ -0,0 +1,138 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestOpenSparseMerkleTree(t *testing.T) {
+	smn, smv := NewSimpleMap(), NewSimpleMap()
+
+	_, err := OpenSparseMerkleTree(smn, smv, sha256.New())
+	if !errors.Is(err, ErrNoTreeMetadata) {
+		t.Errorf("did not return ErrNoTreeMetadata when opening an empty store: %v", err)
+	}
+
+	before := time.Now()
+	smt := NewSparseMerkleTree(smn, smv, sha256.New(), PersistRoot())
+	smt.Update([]byte("testKey1"), []byte("testValue1"))
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+	smt.Delete([]byte("testKey1"))
+	if smt.Version() != 3 {
+		t.Errorf("expected version 3 after three commits, got: %d", smt.Version())
+	}
+
+	md, err := ReadTreeMetadata(smn)
+	if err != nil {
+		t.Errorf("returned error when reading tree metadata: %v", err)
+	}
+	if !bytes.Equal(md.Root, smt.Root()) || md.Version != 3 || md.Timestamp.Before(before.Truncate(time.Second)) {
+		t.Errorf("tree metadata is not as expected: %+v", md)
+	}
+
+	reopened, err := OpenSparseMerkleTree(smn, smv, sha256.New())
+	if err != nil {
+		t.Errorf("returned error when opening tree: %v", err)
+	}
+	if !bytes.Equal(reopened.Root(), smt.Root()) {
+		t.Error("opened tree does not have the committed root")
+	}
+	value, err := reopened.Get([]byte("testKey2"))
+	if err != nil {
+		t.Errorf("returned error when getting key: %v", err)
+	}
+	if !bytes.Equal(value, []byte("testValue2")) {
+		t.Error("did not get correct value from opened tree")
+	}
+	proof, err := reopened.Prove([]byte("testKey1"))
+	if err != nil {
+		t.Errorf("returned error when proving key: %v", err)
+	}
+	if !VerifyProof(proof, reopened.Root(), []byte("testKey1"), defaultValue, sha256.New()) {
+		t.Error("valid proof failed to verify on opened tree")
+	}
+
+	reopened.Update([]byte("testKey3"), []byte("testValue3"))
+	if reopened.Version() != 4 {
+		t.Errorf("expected version 4 after committing to opened tree, got: %d", reopened.Version())
+	}
+
+	_, err = OpenSparseMerkleTree(smn, smv, sha512.New())
+	if !errors.Is(err, ErrHasherMismatch) {
+		t.Errorf("did not return ErrHasherMismatch when opening with a different hasher: %v", err)
+	}
+	_, err = OpenSparseMerkleTree(smn, smv, sha256.New224())
+	if !errors.Is(err, ErrHasherMismatch) {
+		t.Errorf("did not return ErrHasherMismatch when opening with a hasher of the same type: %v", err)
+	}
+}
+
+// Test that committing an empty tree allows it to be opened.
+func TestCommitRootEmptyTree(t *testing.T) {
+	smn, smv := NewSimpleMap(), NewSimpleMap()
+	smt := NewSparseMerkleTree(smn, smv, sha256.New(), PersistRoot())
+	if err := smt.CommitRoot(); err != nil {
+		t.Errorf("returned error when committing root: %v", err)
+	}
+
+	opened, err := OpenSparseMerkleTree(smn, smv, sha256.New())
+	if err != nil {
+		t.Errorf("returned error when opening tree: %v", err)
+	}
+	if !bytes.Equal(opened.Root(), opened.th.placeholder()) {
+		t.Error("opened tree is not empty")
+	}
+	has, err := opened.Has([]byte("testKey"))
+	if err != nil {
+		t.Errorf("returned error when checking presence of key: %v", err)
+	}
+	if has {
+		t.Error("empty tree has a key")
+	}
+}
+
+// Test that every commit persists the root in a reference-counted node store.
+func TestCommitRootRefCounted(t *testing.T) {
+	rc := NewRefCountedMapStore(NewSimpleMap(), NewSimpleMap())
+	smv := NewSimpleMap()
+	smt := NewSparseMerkleTree(rc, smv, sha256.New(), PersistRoot())
+	smt.Update([]byte("testKey1"), []byte("testValue1"))
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+	smt.Delete([]byte("testKey1"))
+
+	opened, err := OpenSparseMerkleTree(rc, smv, sha256.New())
+	if err != nil {
+		t.Fatalf("returned error when opening tree: %v", err)
+	}
+	if !bytes.Equal(opened.Root(), smt.Root()) || opened.Version() != 3 {
+		t.Errorf("opened tree at root %x and version %d, want %x and 3", opened.Root(), opened.Version(), smt.Root())
+	}
+	if count, _ := rc.RefCount(metadataKey); count != 0 {
+		t.Errorf("metadata record has %d references, want 0", count)
+	}
+}
+
+// Test that commits through a PrefixedMapStore over a reference-counted store
+// are not counted either.
+func TestCommitRootPrefixedRefCounted(t *testing.T) {
+	rc := NewRefCountedMapStore(NewSimpleMap(), NewSimpleMap())
+	nodes, values := NewNamespacedMapStores(rc, []byte("tree"))
+	smt := NewSparseMerkleTree(nodes, values, sha256.New(), PersistRoot())
+	smt.Update([]byte("testKey1"), []byte("testValue1"))
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+
+	opened, err := OpenSparseMerkleTree(nodes, values, sha256.New())
+	if err != nil {
+		t.Fatalf("returned error when opening tree: %v", err)
+	}
+	if !bytes.Equal(opened.Root(), smt.Root()) || opened.Version() != 2 {
+		t.Errorf("opened tree at root %x and version %d, want %x and 2", opened.Root(), opened.Version(), smt.Root())
+	}
+	if count, _ := rc.RefCount(nodes.prefixed(metadataKey)); count != 0 {
+		t.Errorf("metadata record has %d references, want 0", count)
+	}
+}
@@ -0,0 +1,46 @@
+package smt
+
+import "errors"
+
+// ErrDepthMismatch is returned when migrating a tree into a tree of a different
+// depth.
+var ErrDepthMismatch = errors.New("trees have different depths")
+
+// MigrateSparseMerkleTree copies the leaves of a tree at its current root into
+// a new tree on empty MapStores, created with the hash function of the source
+// tree and the given options, and returns the new tree. It converts trees
+// between the layouts with values in a separate values store and with values
+// in the leaves: the values store of the new tree can be nil if the options
+// include InlineValues.
+//
+// Leaves keep their paths, so the new tree must have the same depth as the
+// source tree, or ErrDepthMismatch is returned, and should be created with the
+// same RawKeys option for its keys to be found. The roots of the
+// two trees differ if their layouts or prefixes differ.
+func MigrateSparseMerkleTree(src *SparseMerkleTree, nodes, values MapStore, options ...Option) (*SparseMerkleTree, error) {
+	dst := NewSparseMerkleTree(nodes, values, src.th.hasher, options...)
+	if dst.depth() != src.depth() {
+		return nil, ErrDepthMismatch
+	}
+
+	root := dst.Root()
+	err := src.IterateLeaves(func(path, value []byte) error {
+		// Copy the path and the value, as inline values alias the node
+		// data of the source tree.
+		path, value = append([]byte{}, path...), append([]byte{}, value...)
+		var err error
+		root, err = dst.updateForPath(path, value, root)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dst.SetRoot(root)
+	if dst.persistRoot {
+		if err := dst.CommitRoot(); err != nil {
+			return nil, err
+		}
+	}
+	return dst, nil
+}
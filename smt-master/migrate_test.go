@@ -0,0 +1,56 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestMigrateSparseMerkleTree(t *testing.T) {
+	kv := map[string]string{"testKey": "testValue", "testKey2": "testValue2", "foo": "bar"}
+
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+	inline := NewSparseMerkleTree(NewSimpleMap(), nil, sha256.New(), InlineValues())
+	for k, v := range kv {
+		smt.Update([]byte(k), []byte(v))
+		inline.Update([]byte(k), []byte(v))
+	}
+
+	// Separate values to inline values.
+	migrated, err := MigrateSparseMerkleTree(smt, NewSimpleMap(), nil, InlineValues())
+	if err != nil {
+		t.Fatalf("returned error when migrating to inline values: %v", err)
+	}
+	if !bytes.Equal(migrated.Root(), inline.Root()) {
+		t.Errorf("got root %x after migrating to inline values, want %x", migrated.Root(), inline.Root())
+	}
+	for k, v := range kv {
+		value, err := migrated.Get([]byte(k))
+		if err != nil || !bytes.Equal(value, []byte(v)) {
+			t.Errorf("got value %q for key %q, want %q: %v", value, k, v, err)
+		}
+	}
+
+	// And back.
+	nodes, values := NewSimpleMap(), NewSimpleMap()
+	restored, err := MigrateSparseMerkleTree(migrated, nodes, values, PersistRoot())
+	if err != nil {
+		t.Fatalf("returned error when migrating to separate values: %v", err)
+	}
+	if !bytes.Equal(restored.Root(), smt.Root()) {
+		t.Errorf("got root %x after migrating to separate values, want %x", restored.Root(), smt.Root())
+	}
+	if len(values.m) != len(kv) {
+		t.Errorf("got %d values in the values store, want %d", len(values.m), len(kv))
+	}
+	reopened, err := OpenSparseMerkleTree(nodes, values, sha256.New())
+	if err != nil || !bytes.Equal(reopened.Root(), smt.Root()) {
+		t.Errorf("migrated root was not committed: %v", err)
+	}
+
+	// Migrating an empty tree.
+	empty, err := MigrateSparseMerkleTree(NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New()), NewSimpleMap(), nil, InlineValues())
+	if err != nil || !bytes.Equal(empty.Root(), empty.th.placeholder()) {
+		t.Errorf("got root %x after migrating an empty tree: %v", empty.Root(), err)
+	}
+}
@@ -1,4 +1,105 @@
 package smt
 
+import "hash"
+
 // Option is a function that configures SMT.
 type Option func(*SparseMerkleTree)
+
+// PersistRoot is an Option that makes the tree commit its root to a metadata
+// record in the node store with every update, so that the tree can later be
+// reopened with OpenSparseMerkleTree. Only one tree can persist its root in a
+// node store, so among trees sharing a node store through a RefCountedMapStore,
+// at most one should use it.
+func PersistRoot() Option {
+	return func(smt *SparseMerkleTree) {
+		smt.persistRoot = true
+	}
+}
+
+// LeafPrefix is an Option that sets the prefix of the data of leaf nodes, which
+// is {0} by default. Together with NodePrefix, it allows matching the encoding
+// of other Sparse Merkle tree implementations. Proofs of the tree must be
+// verified with the same options.
+//
+// The leaf and node prefixes must differ, and neither may be a prefix of the
+// other; creating a tree or verifying a proof with such options panics.
+func LeafPrefix(prefix []byte) Option {
+	prefix = append([]byte{}, prefix...)
+	return func(smt *SparseMerkleTree) {
+		smt.th.leafPrefix = prefix
+	}
+}
+
+// NodePrefix is an Option that sets the prefix of the data of inner nodes,
+// which is {1} by default. See LeafPrefix.
+func NodePrefix(prefix []byte) Option {
+	prefix = append([]byte{}, prefix...)
+	return func(smt *SparseMerkleTree) {
+		smt.th.nodePrefix = prefix
+	}
+}
+
+// RawKeys is an Option that makes the tree use the keys themselves as paths
+// instead of their digests. Keys must then be as long as a digest, and
+// operations on keys of any other size return ErrBadKeySize; proofs of such
+// keys do not verify. With the Depth option, keys must instead be as long as
+// the depth in bytes. The keys should be uniformly distributed, as the depth of
+// the tree grows with the length of their common prefixes. Leaves are iterated
+// in key order.
+//
+// Proofs of the tree must be verified with the same option.
+func RawKeys() Option {
+	return func(smt *SparseMerkleTree) {
+		smt.th.rawKeys = true
+	}
+}
+
+// InlineValues is an Option that stores values in the leaves of the tree
+// instead of their digests, so that the values store is not used and can be
+// nil. Proofs of non-membership then carry the value of the unrelated leaf
+// they contain. See MigrateSparseMerkleTree for converting trees to and from
+// this layout.
+//
+// Proofs of the tree must be verified with the same option.
+func InlineValues() Option {
+	return func(smt *SparseMerkleTree) {
+		smt.th.inlineValues = true
+	}
+}
+
+// Depth is an Option that sets the depth of the tree in bits, which is the size
+// of a digest by default, so that trees over small key spaces have shorter
+// proofs. The depth must be a multiple of 8 no greater than the size of a
+// digest; creating a tree or verifying a proof with another depth panics.
+//
+// A depth below the size of a digest requires the RawKeys option, with keys as
+// long as the depth, e.g. 4-byte big-endian integers for a depth of 32. Paths
+// truncated from the digests of keys would let distinct keys share a leaf, and
+// proofs for one key verify for the other.
+//
+// Proofs of the tree must be verified with the same option.
+func Depth(bits int) Option {
+	return func(smt *SparseMerkleTree) {
+		smt.th.depth = bits
+	}
+}
+
+func (smt *SparseMerkleTree) applyOptions(options []Option) {
+	for _, option := range options {
+		option(smt)
+	}
+	if err := smt.th.checkPrefixes(); err != nil {
+		panic(err)
+	}
+	if err := smt.th.checkDepth(); err != nil {
+		panic(err)
+	}
+}
+
+// treeHasherFromOptions returns the tree hasher of a tree created with a
+// hasher and options, for verifying proofs without a tree.
+func treeHasherFromOptions(hasher hash.Hash, options []Option) *treeHasher {
+	smt := SparseMerkleTree{th: *newTreeHasher(hasher)}
+	smt.applyOptions(options)
+	return &smt.th
+}
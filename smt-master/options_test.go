@@ -0,0 +1,377 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestPrefixOptions(t *testing.T) {
+	kv := map[string]string{"testKey": "testValue", "testKey2": "testValue2", "foo": "bar"}
+	options := []Option{LeafPrefix([]byte("LEAF")), NodePrefix([]byte("NODE"))}
+
+	tests := []struct {
+		options []Option
+		spec    referenceSpec
+	}{
+		{nil, referenceSpec{}},
+		{[]Option{LeafPrefix([]byte{0}), NodePrefix([]byte{1})}, referenceSpec{}},
+		{options, referenceSpec{leafPrefix: []byte("LEAF"), nodePrefix: []byte("NODE")}},
+	}
+	for _, test := range tests {
+		smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), test.options...)
+		for k, v := range kv {
+			smt.Update([]byte(k), []byte(v))
+		}
+		if want := referenceRoot(sha256.New(), kv, test.spec); !bytes.Equal(smt.Root(), want) {
+			t.Errorf("got root %x, want %x", smt.Root(), want)
+		}
+	}
+
+	nodes, values := NewSimpleMap(), NewSimpleMap()
+	smt := NewSparseMerkleTree(nodes, values, sha256.New(), options...)
+	for k, v := range kv {
+		smt.Update([]byte(k), []byte(v))
+	}
+	root := smt.Root()
+
+	for _, key := range []string{"testKey", "absentKey"} {
+		value, _ := smt.Get([]byte(key))
+		proof, err := smt.ProveUpdatable([]byte(key))
+		if err != nil {
+			t.Fatalf("returned error when proving key %q: %v", key, err)
+		}
+		if !VerifyProof(proof, root, []byte(key), value, sha256.New(), options...) {
+			t.Errorf("valid proof for key %q failed to verify with the tree options", key)
+		}
+		if VerifyProof(proof, root, []byte(key), value, sha256.New()) {
+			t.Errorf("proof for key %q verified with the default prefixes", key)
+		}
+
+		compact, err := smt.ProveCompact([]byte(key))
+		if err != nil {
+			t.Fatalf("returned error when proving key %q: %v", key, err)
+		}
+		if !VerifyCompactProof(compact, root, []byte(key), value, sha256.New(), options...) {
+			t.Errorf("valid compact proof for key %q failed to verify with the tree options", key)
+		}
+		decompacted, err := DecompactProof(compact, sha256.New(), options...)
+		if err != nil || !VerifyProof(decompacted, root, []byte(key), value, sha256.New(), options...) {
+			t.Errorf("decompacted proof for key %q failed to verify: %v", key, err)
+		}
+
+		// Build a deep subtree from the proof and update it.
+		dsmst := NewDeepSparseMerkleSubTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), root, options...)
+		if err := dsmst.AddBranch(proof, []byte(key), value); err != nil {
+			t.Errorf("returned error when adding branch for key %q: %v", key, err)
+		}
+		subRoot, err := dsmst.Update([]byte(key), []byte("newValue"))
+		if err != nil {
+			t.Errorf("returned error when updating deep subtree: %v", err)
+		}
+		updated := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), options...)
+		for k, v := range kv {
+			updated.Update([]byte(k), []byte(v))
+		}
+		treeRoot, _ := updated.Update([]byte(key), []byte("newValue"))
+		if !bytes.Equal(subRoot, treeRoot) {
+			t.Errorf("deep subtree root differs from the tree root after updating key %q", key)
+		}
+	}
+
+	imported := ImportSparseMerkleTree(nodes, values, sha256.New(), root, options...)
+	if value, _ := imported.Get([]byte("foo")); string(value) != "bar" {
+		t.Errorf("got %q from the imported tree", value)
+	}
+}
+
+func TestAmbiguousPrefixes(t *testing.T) {
+	ambiguous := [][]Option{
+		{LeafPrefix([]byte{1})},
+		{LeafPrefix([]byte{1, 2}), NodePrefix([]byte{1})},
+		{NodePrefix([]byte{0, 0})},
+		{LeafPrefix(nil)},
+	}
+	for _, options := range ambiguous {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("did not panic when creating a tree with ambiguous prefixes")
+				}
+			}()
+			NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), options...)
+		}()
+	}
+}
+
+func TestRawKeys(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), RawKeys())
+	hashed := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+
+	keys := make([][]byte, 20)
+	for i := range keys {
+		key := sha256.Sum256([]byte{byte(i)})
+		keys[i] = key[:]
+		smt.Update(keys[i], []byte{byte(i)})
+		hashed.Update([]byte{byte(i)}, []byte{byte(i)})
+	}
+	// Using the digests of the keys as raw keys gives the tree with hashed keys.
+	if !bytes.Equal(smt.Root(), hashed.Root()) {
+		t.Error("tree with raw keys differs from the tree with hashed keys")
+	}
+	root := smt.Root()
+
+	for i, key := range keys {
+		if value, err := smt.Get(key); err != nil || !bytes.Equal(value, []byte{byte(i)}) {
+			t.Errorf("got %x, %v for key %x", value, err, key)
+		}
+		proof, err := smt.Prove(key)
+		if err != nil {
+			t.Fatalf("returned error when proving key: %v", err)
+		}
+		if !VerifyProof(proof, root, key, []byte{byte(i)}, sha256.New(), RawKeys()) {
+			t.Error("valid proof failed to verify with raw keys")
+		}
+		if VerifyProof(proof, root, key, []byte{byte(i)}, sha256.New()) {
+			t.Error("proof verified with hashed keys")
+		}
+	}
+
+	shortKey := []byte("testKey")
+	if _, err := smt.Get(shortKey); !errors.Is(err, ErrBadKeySize) {
+		t.Errorf("got error %v when getting a short key, want ErrBadKeySize", err)
+	}
+	if _, err := smt.Update(shortKey, []byte("testValue")); !errors.Is(err, ErrBadKeySize) {
+		t.Errorf("got error %v when updating a short key, want ErrBadKeySize", err)
+	}
+	if _, err := smt.Delete(append(keys[0], 0)); !errors.Is(err, ErrBadKeySize) {
+		t.Errorf("got error %v when deleting a long key, want ErrBadKeySize", err)
+	}
+	if _, err := smt.Prove(shortKey); !errors.Is(err, ErrBadKeySize) {
+		t.Errorf("got error %v when proving a short key, want ErrBadKeySize", err)
+	}
+	empty := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), RawKeys())
+	if _, err := empty.Get(shortKey); !errors.Is(err, ErrBadKeySize) {
+		t.Errorf("got error %v when getting a short key from an empty tree, want ErrBadKeySize", err)
+	}
+	proof, _ := hashed.Prove(shortKey)
+	if VerifyProof(proof, root, shortKey, defaultValue, sha256.New(), RawKeys()) {
+		t.Error("proof of a short key verified with raw keys")
+	}
+	if !bytes.Equal(smt.Root(), root) {
+		t.Error("failed operations changed the root")
+	}
+}
+
+func TestInlineValues(t *testing.T) {
+	kv := map[string]string{"testKey": "testValue", "testKey2": "testValue2", "foo": "bar"}
+
+	// The values store is never used.
+	nodes := NewSimpleMap()
+	smt := NewSparseMerkleTree(nodes, nil, sha256.New(), InlineValues())
+	for k, v := range kv {
+		if _, err := smt.Update([]byte(k), []byte(v)); err != nil {
+			t.Fatalf("returned error when updating key %q: %v", k, err)
+		}
+	}
+	if want := referenceRoot(sha256.New(), kv, referenceSpec{inlineValues: true}); !bytes.Equal(smt.Root(), want) {
+		t.Errorf("got root %x, want %x", smt.Root(), want)
+	}
+	for k, v := range kv {
+		value, err := smt.Get([]byte(k))
+		if err != nil || !bytes.Equal(value, []byte(v)) {
+			t.Errorf("got value %q for key %q, want %q: %v", value, k, v, err)
+		}
+	}
+	if has, err := smt.Has([]byte("absentKey")); has || err != nil {
+		t.Errorf("absent key is present: %v", err)
+	}
+	root := smt.Root()
+
+	for _, key := range []string{"testKey", "absentKey"} {
+		value, _ := smt.Get([]byte(key))
+		proof, err := smt.ProveUpdatable([]byte(key))
+		if err != nil {
+			t.Fatalf("returned error when proving key %q: %v", key, err)
+		}
+		if !VerifyProof(proof, root, []byte(key), value, sha256.New(), InlineValues()) {
+			t.Errorf("valid proof for key %q failed to verify with the tree options", key)
+		}
+		if len(value) > 0 && VerifyProof(proof, root, []byte(key), value, sha256.New()) {
+			t.Errorf("proof for key %q verified without inline values", key)
+		}
+		compact, err := smt.ProveCompact([]byte(key))
+		if err != nil {
+			t.Fatalf("returned error when proving key %q: %v", key, err)
+		}
+		if !VerifyCompactProof(compact, root, []byte(key), value, sha256.New(), InlineValues()) {
+			t.Errorf("valid compact proof for key %q failed to verify with the tree options", key)
+		}
+
+		// Build a deep subtree without a values store from the proof.
+		dsmst := NewDeepSparseMerkleSubTree(NewSimpleMap(), nil, sha256.New(), root, InlineValues())
+		if err := dsmst.AddBranch(proof, []byte(key), value); err != nil {
+			t.Errorf("returned error when adding branch for key %q: %v", key, err)
+		}
+		if got, err := dsmst.Get([]byte(key)); err != nil || !bytes.Equal(got, value) {
+			t.Errorf("got value %q for key %q from deep subtree, want %q: %v", got, key, value, err)
+		}
+	}
+
+	// A non-membership proof showing an unrelated leaf carries its value.
+	found := false
+	for i := 0; i < 64 && !found; i++ {
+		key := []byte{byte(i)}
+		proof, _ := smt.Prove(key)
+		if proof.NonMembershipLeafData == nil {
+			continue
+		}
+		found = true
+		_, value := smt.th.parseLeaf(proof.NonMembershipLeafData)
+		if _, ok := map[string]bool{"testValue": true, "testValue2": true, "bar": true}[string(value)]; !ok {
+			t.Errorf("got value %q in non-membership leaf data", value)
+		}
+		if !VerifyProof(proof, root, key, defaultValue, sha256.New(), InlineValues()) {
+			t.Error("valid non-membership proof with an unrelated leaf failed to verify")
+		}
+	}
+	if !found {
+		t.Fatal("found no non-membership proof with an unrelated leaf")
+	}
+
+	// Deleting every key leaves no nodes.
+	for k := range kv {
+		if _, err := smt.Delete([]byte(k)); err != nil {
+			t.Fatalf("returned error when deleting key %q: %v", k, err)
+		}
+	}
+	if !bytes.Equal(smt.Root(), smt.th.placeholder()) {
+		t.Errorf("got root %x for empty tree", smt.Root())
+	}
+	if len(nodes.m) != 0 {
+		t.Errorf("%d nodes left in the store of an empty tree", len(nodes.m))
+	}
+}
+
+func TestDepth(t *testing.T) {
+	// A full tree of depth 8, whose leaves are all at the bottom.
+	options := []Option{Depth(8), RawKeys()}
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), options...)
+	kv := make(map[string]string)
+	for i := 0; i < 256; i++ {
+		key, value := []byte{byte(i)}, fmt.Sprintf("value%d", i)
+		kv[string(key)] = value
+		if _, err := smt.Update(key, []byte(value)); err != nil {
+			t.Fatalf("returned error when updating key %d: %v", i, err)
+		}
+	}
+	if want := referenceRoot(sha256.New(), kv, referenceSpec{rawKeys: true}); !bytes.Equal(smt.Root(), want) {
+		t.Errorf("got root %x for full tree of depth 8, want %x", smt.Root(), want)
+	}
+	for i := 0; i < 256; i++ {
+		key, want := []byte{byte(i)}, []byte(fmt.Sprintf("value%d", i))
+		if value, err := smt.GetDescend(key); err != nil || !bytes.Equal(value, want) {
+			t.Errorf("got value %q for key %d, want %q: %v", value, i, want, err)
+		}
+		proof, err := smt.Prove(key)
+		if err != nil {
+			t.Fatalf("returned error when proving key %d: %v", i, err)
+		}
+		if len(proof.SideNodes) != 8 || !VerifyProof(proof, smt.Root(), key, want, sha256.New(), options...) {
+			t.Errorf("proof for key %d with %d side nodes failed to verify", i, len(proof.SideNodes))
+		}
+	}
+	if _, err := smt.Get([]byte{1, 2}); !errors.Is(err, ErrBadKeySize) {
+		t.Errorf("got error %v for key longer than the depth, want ErrBadKeySize", err)
+	}
+
+	// A sparse tree over 4-byte indices.
+	options = []Option{Depth(32), RawKeys()}
+	newTree := func() *SparseMerkleTree {
+		smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), options...)
+		for _, i := range []uint32{7, 0, 1 << 31, 42, 43, 1<<32 - 1, 1 << 16} {
+			key := make([]byte, 4)
+			binary.BigEndian.PutUint32(key, i)
+			smt.Update(key, []byte(fmt.Sprint(i)))
+		}
+		return smt
+	}
+	smt = newTree()
+	root := smt.Root()
+	var visited []uint32
+	smt.IterateLeaves(func(path, value []byte) error {
+		visited = append(visited, binary.BigEndian.Uint32(path))
+		return nil
+	})
+	if fmt.Sprint(visited) != "[0 7 42 43 65536 2147483648 4294967295]" {
+		t.Errorf("got leaves %v, want them in index order", visited)
+	}
+
+	for _, i := range []uint32{42, 44} {
+		key := make([]byte, 4)
+		binary.BigEndian.PutUint32(key, i)
+		value, _ := smt.Get(key)
+		proof, err := smt.ProveUpdatable(key)
+		if err != nil {
+			t.Fatalf("returned error when proving key %d: %v", i, err)
+		}
+		if len(proof.SideNodes) > 32 {
+			t.Errorf("got %d side nodes in proof for key %d", len(proof.SideNodes), i)
+		}
+		if !VerifyProof(proof, root, key, value, sha256.New(), options...) {
+			t.Errorf("valid proof for key %d failed to verify", i)
+		}
+		compact, _ := smt.ProveCompact(key)
+		if !VerifyCompactProof(compact, root, key, value, sha256.New(), options...) {
+			t.Errorf("valid compact proof for key %d failed to verify", i)
+		}
+
+		dsmst := NewDeepSparseMerkleSubTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), root, options...)
+		if err := dsmst.AddBranch(proof, key, value); err != nil {
+			t.Errorf("returned error when adding branch for key %d: %v", i, err)
+		}
+		subRoot, _ := dsmst.Update(key, []byte("newValue"))
+		treeRoot, _ := newTree().Update(key, []byte("newValue"))
+		if !bytes.Equal(subRoot, treeRoot) {
+			t.Errorf("got root %x from deep subtree, want %x", subRoot, treeRoot)
+		}
+	}
+
+	// Side nodes beyond the depth are rejected.
+	proof := SparseMerkleProof{SideNodes: make([][]byte, 33)}
+	for i := range proof.SideNodes {
+		proof.SideNodes[i] = make([]byte, 32)
+	}
+	if proof.sanityCheck(&smt.th) {
+		t.Error("proof with more side nodes than the depth passed the sanity check")
+	}
+
+	// Trees of different depths cannot be migrated into each other.
+	if _, err := MigrateSparseMerkleTree(smt, NewSimpleMap(), NewSimpleMap(), RawKeys()); !errors.Is(err, ErrDepthMismatch) {
+		t.Errorf("got error %v when migrating to another depth, want ErrDepthMismatch", err)
+	}
+}
+
+func TestInvalidDepth(t *testing.T) {
+	for _, depth := range []int{0, -8, 12, 264} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("creating a tree of depth %d did not panic", depth)
+				}
+			}()
+			NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), Depth(depth), RawKeys())
+		}()
+	}
+
+	// Paths truncated from digests could be shared by distinct keys.
+	defer func() {
+		if recover() == nil {
+			t.Error("creating a tree of depth 64 without raw keys did not panic")
+		}
+	}()
+	NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), Depth(64))
+}
@@ -0,0 +1,191 @@
+package smt
+
+import (
+	"errors"
+)
+
+// OverlayMapStore is a copy-on-write MapStore layered on top of a base
+// MapStore. Reads fall through to the base store, while writes and deletes are
+// kept in memory until they are either flushed into the base store or
+// discarded. The base store is never modified before Flush is called.
+type OverlayMapStore struct {
+	base       MapStore
+	writes     map[string][]byte
+	tombstones map[string]struct{}
+}
+
+// NewOverlayMapStore creates a new empty overlay on top of base.
+func NewOverlayMapStore(base MapStore) *OverlayMapStore {
+	return &OverlayMapStore{
+		base:       base,
+		writes:     make(map[string][]byte),
+		tombstones: make(map[string]struct{}),
+	}
+}
+
+// Get gets the value for a key.
+func (ov *OverlayMapStore) Get(key []byte) ([]byte, error) {
+	if _, ok := ov.tombstones[string(key)]; ok {
+		return nil, &InvalidKeyError{Key: key}
+	}
+	if value, ok := ov.writes[string(key)]; ok {
+		return value, nil
+	}
+	return ov.base.Get(key)
+}
+
+// Set updates the value for a key.
+func (ov *OverlayMapStore) Set(key []byte, value []byte) error {
+	delete(ov.tombstones, string(key))
+	ov.writes[string(key)] = value
+	return nil
+}
+
+// Delete deletes a key. Keys that exist in the base store are shadowed by a
+// tombstone until the overlay is flushed.
+func (ov *OverlayMapStore) Delete(key []byte) error {
+	if _, ok := ov.tombstones[string(key)]; ok {
+		return &InvalidKeyError{Key: key}
+	}
+	_, written := ov.writes[string(key)]
+	delete(ov.writes, string(key))
+
+	_, err := ov.base.Get(key)
+	if err != nil {
+		var invalidKeyError *InvalidKeyError
+		if !errors.As(err, &invalidKeyError) {
+			return err
+		}
+		if !written {
+			return &InvalidKeyError{Key: key}
+		}
+		return nil
+	}
+	ov.tombstones[string(key)] = struct{}{}
+	return nil
+}
+
+// Flush applies all pending writes and deletes to the base store and empties
+// the overlay. Writes are applied before deletes, so that an interrupted flush
+// never removes data from the base store without also having added its
+// replacement. Changes that were applied before an error are removed from the
+// overlay, so Flush may be retried.
+func (ov *OverlayMapStore) Flush() error {
+	for k, v := range ov.writes {
+		if err := ov.base.Set([]byte(k), v); err != nil {
+			return err
+		}
+		delete(ov.writes, k)
+	}
+	for k := range ov.tombstones {
+		if err := ov.base.Delete([]byte(k)); err != nil {
+			return err
+		}
+		delete(ov.tombstones, k)
+	}
+	return nil
+}
+
+// Discard drops all pending writes and deletes.
+func (ov *OverlayMapStore) Discard() {
+	ov.writes = make(map[string][]byte)
+	ov.tombstones = make(map[string]struct{})
+}
+
+// Iterate calls fn for every key-value pair visible through the overlay. It
+// returns ErrNotIterable if the base store is not an IterableMapStore.
+func (ov *OverlayMapStore) Iterate(fn func(key []byte, value []byte) error) error {
+	base, ok := ov.base.(IterableMapStore)
+	if !ok {
+		return ErrNotIterable
+	}
+	err := base.Iterate(func(key []byte, value []byte) error {
+		if _, ok := ov.tombstones[string(key)]; ok {
+			return nil
+		}
+		if _, ok := ov.writes[string(key)]; ok {
+			return nil
+		}
+		return fn(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	for k, v := range ov.writes {
+		if err := fn([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countingOverlayMapStore is an OverlayMapStore that also counts the Sets and
+// Deletes of each key, and flushes their net number to the base store rather
+// than the last write. This keeps the reference counts of a
+// RefCountedMapStore balanced when a key is deleted and set again, or set and
+// deleted, before the overlay is flushed.
+type countingOverlayMapStore struct {
+	*OverlayMapStore
+	// counts holds the net number of Sets of each key, and values the value
+	// of its last Set.
+	counts map[string]int
+	values map[string][]byte
+}
+
+func newCountingOverlayMapStore(base MapStore) *countingOverlayMapStore {
+	return &countingOverlayMapStore{
+		OverlayMapStore: NewOverlayMapStore(base),
+		counts:          make(map[string]int),
+		values:          make(map[string][]byte),
+	}
+}
+
+// Set updates the value for a key.
+func (ov *countingOverlayMapStore) Set(key []byte, value []byte) error {
+	if err := ov.OverlayMapStore.Set(key, value); err != nil {
+		return err
+	}
+	ov.counts[string(key)]++
+	ov.values[string(key)] = value
+	return nil
+}
+
+// Delete deletes a key.
+func (ov *countingOverlayMapStore) Delete(key []byte) error {
+	if err := ov.OverlayMapStore.Delete(key); err != nil {
+		return err
+	}
+	ov.counts[string(key)]--
+	return nil
+}
+
+// Flush applies the net number of Sets or Deletes of each key to the base
+// store and empties the overlay. As with OverlayMapStore, Sets are applied
+// before Deletes, and Flush may be retried after an error.
+func (ov *countingOverlayMapStore) Flush() error {
+	for k, n := range ov.counts {
+		for ; n > 0; n-- {
+			if err := ov.base.Set([]byte(k), ov.values[k]); err != nil {
+				return err
+			}
+			ov.counts[k] = n - 1
+		}
+	}
+	for k, n := range ov.counts {
+		for ; n < 0; n++ {
+			if err := ov.base.Delete([]byte(k)); err != nil {
+				return err
+			}
+			ov.counts[k] = n + 1
+		}
+	}
+	ov.Discard()
+	return nil
+}
+
+// Discard drops all pending writes and deletes.
+func (ov *countingOverlayMapStore) Discard() {
+	ov.OverlayMapStore.Discard()
+	ov.counts = make(map[string]int)
+	ov.values = make(map[string][]byte)
+}
@@ -0,0 +1,155 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestOverlayMapStore(t *testing.T) {
+	base := NewSimpleMap()
+	base.Set([]byte("base"), []byte("baseValue"))
+	ov := NewOverlayMapStore(base)
+
+	value, err := ov.Get([]byte("base"))
+	if err != nil {
+		t.Errorf("getting a key from the base store returned an error: %v", err)
+	}
+	if !bytes.Equal(value, []byte("baseValue")) {
+		t.Error("did not fall through to the base store")
+	}
+
+	ov.Set([]byte("new"), []byte("newValue"))
+	if err = ov.Delete([]byte("base")); err != nil {
+		t.Errorf("deleting a key returned an error: %v", err)
+	}
+	if _, err = ov.Get([]byte("base")); err == nil {
+		t.Error("deleted key is still visible through the overlay")
+	}
+	if err = ov.Delete([]byte("base")); err == nil {
+		t.Error("deleting a key did not return an error on a deleted key")
+	}
+	if err = ov.Delete([]byte("nonexistent")); err == nil {
+		t.Error("deleting a key did not return an error on a non-existent key")
+	}
+	if _, err = base.Get([]byte("new")); err == nil {
+		t.Error("write reached the base store before flushing")
+	}
+	if _, err = base.Get([]byte("base")); err != nil {
+		t.Error("delete reached the base store before flushing")
+	}
+
+	ov.Discard()
+	if _, err = ov.Get([]byte("new")); err == nil {
+		t.Error("discarded write is still visible")
+	}
+	if _, err = ov.Get([]byte("base")); err != nil {
+		t.Error("discarded delete is still visible")
+	}
+
+	ov.Set([]byte("new"), []byte("newValue"))
+	ov.Delete([]byte("base"))
+	if err = ov.Flush(); err != nil {
+		t.Errorf("flushing returned an error: %v", err)
+	}
+	value, err = base.Get([]byte("new"))
+	if err != nil || !bytes.Equal(value, []byte("newValue")) {
+		t.Error("flushed write did not reach the base store")
+	}
+	if _, err = base.Get([]byte("base")); err == nil {
+		t.Error("flushed delete did not reach the base store")
+	}
+	if len(ov.writes) != 0 || len(ov.tombstones) != 0 {
+		t.Error("overlay is not empty after flushing")
+	}
+}
+
+// Test speculatively updating a tree through overlays.
+func TestOverlayMapStoreTree(t *testing.T) {
+	smn, smv := NewSimpleMap(), NewSimpleMap()
+	smt := NewSparseMerkleTree(smn, smv, sha256.New())
+	smt.Update([]byte("testKey1"), []byte("testValue1"))
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+	root := smt.Root()
+
+	ovn, ovv := NewOverlayMapStore(smn), NewOverlayMapStore(smv)
+	speculative := ImportSparseMerkleTree(ovn, ovv, sha256.New(), root)
+	speculative.Update([]byte("testKey3"), []byte("testValue3"))
+	speculative.Delete([]byte("testKey1"))
+
+	value, err := smt.Get([]byte("testKey1"))
+	if err != nil {
+		t.Errorf("returned error when getting key: %v", err)
+	}
+	if !bytes.Equal(value, []byte("testValue1")) {
+		t.Error("speculative update modified the base tree")
+	}
+	proof, err := smt.Prove([]byte("testKey2"))
+	if err != nil {
+		t.Errorf("returned error when proving key: %v", err)
+	}
+	if !VerifyProof(proof, root, []byte("testKey2"), []byte("testValue2"), sha256.New()) {
+		t.Error("base tree proof failed to verify during speculation")
+	}
+
+	if err = ovn.Flush(); err != nil {
+		t.Errorf("flushing nodes returned an error: %v", err)
+	}
+	if err = ovv.Flush(); err != nil {
+		t.Errorf("flushing values returned an error: %v", err)
+	}
+	smt.SetRoot(speculative.Root())
+	has, err := smt.Has([]byte("testKey1"))
+	if err != nil {
+		t.Errorf("returned error when checking presence of key: %v", err)
+	}
+	if has {
+		t.Error("flushed delete is not visible in the base tree")
+	}
+	value, err = smt.GetDescend([]byte("testKey3"))
+	if err != nil {
+		t.Errorf("returned error when descending tree: %v", err)
+	}
+	if !bytes.Equal(value, []byte("testValue3")) {
+		t.Error("flushed update is not visible in the base tree")
+	}
+}
+
+// Test building a deep subtree on top of an overlay.
+func TestOverlayMapStoreDeepSubTree(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+	smt.Update([]byte("testKey1"), []byte("testValue1"))
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+	proof, _ := smt.ProveUpdatable([]byte("testKey1"))
+
+	smn, smv := NewSimpleMap(), NewSimpleMap()
+	dsmst := NewDeepSparseMerkleSubTree(smn, smv, sha256.New(), smt.Root())
+	err := dsmst.AddBranch(proof, []byte("testKey1"), []byte("testValue1"))
+	if err != nil {
+		t.Errorf("returned error when adding branch to deep subtree: %v", err)
+	}
+
+	ovn, ovv := NewOverlayMapStore(smn), NewOverlayMapStore(smv)
+	speculative := NewDeepSparseMerkleSubTree(ovn, ovv, sha256.New(), dsmst.Root())
+	smt.Update([]byte("testKey1"), []byte("testValue3"))
+	_, err = speculative.Update([]byte("testKey1"), []byte("testValue3"))
+	if err != nil {
+		t.Errorf("returned error when updating deep subtree: %v", err)
+	}
+	if !bytes.Equal(speculative.Root(), smt.Root()) {
+		t.Error("speculative deep subtree root does not match the full tree")
+	}
+	if len(smn.m) != 3 {
+		t.Errorf("expected base store to be untouched with 3 nodes, got: %d", len(smn.m))
+	}
+
+	ovn.Discard()
+	ovv.Discard()
+	value, err := dsmst.Get([]byte("testKey1"))
+	if err != nil {
+		t.Errorf("returned error when getting value in deep subtree: %v", err)
+	}
+	if !bytes.Equal(value, []byte("testValue1")) {
+		t.Error("discarded update is visible in the deep subtree")
+	}
+}
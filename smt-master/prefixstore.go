@@ -0,0 +1,113 @@
+package smt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var nodesNamespaceTag = []byte{'n'}
+var valuesNamespaceTag = []byte{'v'}
+
+// PrefixedMapStore is a MapStore that transparently prefixes every key before
+// passing it on to an underlying MapStore, so that several trees can share a
+// single store without their keys colliding.
+//
+// Two PrefixedMapStores on the same base only have disjoint key spaces if
+// neither prefix is a prefix of the other. Use NewNamespacedMapStores to
+// derive prefixes that are guaranteed to have this property.
+type PrefixedMapStore struct {
+	base   MapStore
+	prefix []byte
+}
+
+// NewPrefixedMapStore creates a new PrefixedMapStore on top of base.
+func NewPrefixedMapStore(base MapStore, prefix []byte) *PrefixedMapStore {
+	p := make([]byte, len(prefix))
+	copy(p, prefix)
+	return &PrefixedMapStore{
+		base:   base,
+		prefix: p,
+	}
+}
+
+// NewNamespacedMapStores creates the node and value stores of a tree living in
+// namespace within base. Stores created for different namespaces never share
+// keys, as the namespace is length-prefixed before being used as a key prefix.
+func NewNamespacedMapStores(base MapStore, namespace []byte) (nodes, values *PrefixedMapStore) {
+	prefix := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(namespace))
+	prefix = prefix[:binary.PutUvarint(prefix, uint64(len(namespace)))]
+	prefix = append(prefix, namespace...)
+
+	nodes = NewPrefixedMapStore(base, append(prefix, nodesNamespaceTag...))
+	values = NewPrefixedMapStore(base, append(prefix, valuesNamespaceTag...))
+	return nodes, values
+}
+
+// Prefix returns the prefix prepended to every key.
+func (ps *PrefixedMapStore) Prefix() []byte {
+	return ps.prefix
+}
+
+func (ps *PrefixedMapStore) prefixed(key []byte) []byte {
+	k := make([]byte, 0, len(ps.prefix)+len(key))
+	k = append(k, ps.prefix...)
+	return append(k, key...)
+}
+
+// Get gets the value for a key.
+func (ps *PrefixedMapStore) Get(key []byte) ([]byte, error) {
+	value, err := ps.base.Get(ps.prefixed(key))
+	if err != nil {
+		return nil, ps.unprefixedError(key, err)
+	}
+	return value, nil
+}
+
+// Set updates the value for a key.
+func (ps *PrefixedMapStore) Set(key []byte, value []byte) error {
+	return ps.base.Set(ps.prefixed(key), value)
+}
+
+// SetUncounted updates the value for a key without counting the write if the
+// underlying store is an UncountedMapStore, and with Set otherwise.
+func (ps *PrefixedMapStore) SetUncounted(key []byte, value []byte) error {
+	if base, ok := ps.base.(UncountedMapStore); ok {
+		return base.SetUncounted(ps.prefixed(key), value)
+	}
+	return ps.base.Set(ps.prefixed(key), value)
+}
+
+// Delete deletes a key.
+func (ps *PrefixedMapStore) Delete(key []byte) error {
+	if err := ps.base.Delete(ps.prefixed(key)); err != nil {
+		return ps.unprefixedError(key, err)
+	}
+	return nil
+}
+
+// Iterate calls fn for every key-value pair under the prefix, with the prefix
+// stripped from the key. It returns ErrNotIterable if the underlying store is
+// not an IterableMapStore.
+func (ps *PrefixedMapStore) Iterate(fn func(key []byte, value []byte) error) error {
+	base, ok := ps.base.(IterableMapStore)
+	if !ok {
+		return ErrNotIterable
+	}
+	return base.Iterate(func(key []byte, value []byte) error {
+		if !bytes.HasPrefix(key, ps.prefix) {
+			return nil
+		}
+		return fn(key[len(ps.prefix):], value)
+	})
+}
+
+// unprefixedError reports InvalidKeyErrors against the caller's key rather
+// than the prefixed key seen by the underlying store.
+func (ps *PrefixedMapStore) unprefixedError(key []byte, err error) error {
+	var invalidKeyError *InvalidKeyError
+	if errors.As(err, &invalidKeyError) {
+		return &InvalidKeyError{Key: key}
+	}
+	return err
+}
@@ -0,0 +1,122 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestPrefixedMapStore(t *testing.T) {
+	base := NewSimpleMap()
+	ps := NewPrefixedMapStore(base, []byte("prefix"))
+
+	err := ps.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Errorf("updating a key returned an error: %v", err)
+	}
+	value, err := base.Get([]byte("prefixkey"))
+	if err != nil {
+		t.Errorf("key was not prefixed in the base store: %v", err)
+	}
+	if !bytes.Equal(value, []byte("value")) {
+		t.Error("base store holds the wrong value")
+	}
+	value, err = ps.Get([]byte("key"))
+	if err != nil {
+		t.Errorf("getting a key returned an error: %v", err)
+	}
+	if !bytes.Equal(value, []byte("value")) {
+		t.Error("failed to update key")
+	}
+
+	_, err = ps.Get([]byte("prefixkey"))
+	var invalidKeyError *InvalidKeyError
+	if !errors.As(err, &invalidKeyError) {
+		t.Errorf("did not return InvalidKeyError when getting a non-existent key: %v", err)
+	} else if !bytes.Equal(invalidKeyError.Key, []byte("prefixkey")) {
+		t.Error("InvalidKeyError did not report the unprefixed key")
+	}
+
+	err = ps.Delete([]byte("key"))
+	if err != nil {
+		t.Errorf("deleting a key returned an error: %v", err)
+	}
+	if err = ps.Delete([]byte("key")); err == nil {
+		t.Error("deleting a key did not return an error on a non-existent key")
+	}
+}
+
+func TestPrefixedMapStoreIterate(t *testing.T) {
+	base := NewSimpleMap()
+	base.Set([]byte("other"), []byte("value"))
+	ps := NewPrefixedMapStore(base, []byte("p/"))
+	ps.Set([]byte("a"), []byte("1"))
+	ps.Set([]byte("b"), []byte("2"))
+
+	seen := make(map[string]string)
+	err := ps.Iterate(func(key []byte, value []byte) error {
+		seen[string(key)] = string(value)
+		return nil
+	})
+	if err != nil {
+		t.Errorf("iterating returned an error: %v", err)
+	}
+	if len(seen) != 2 || seen["a"] != "1" || seen["b"] != "2" {
+		t.Errorf("iteration was not scoped to the prefix: %v", seen)
+	}
+
+	ps = NewPrefixedMapStore(struct{ MapStore }{base}, []byte("p/"))
+	err = ps.Iterate(func(key []byte, value []byte) error { return nil })
+	if !errors.Is(err, ErrNotIterable) {
+		t.Errorf("did not return ErrNotIterable for a non-iterable base store: %v", err)
+	}
+}
+
+// Test that trees in different namespaces of the same store do not interfere.
+func TestNamespacedMapStores(t *testing.T) {
+	base := NewSimpleMap()
+	nodes1, values1 := NewNamespacedMapStores(base, []byte("a"))
+	nodes2, values2 := NewNamespacedMapStores(base, []byte("ab"))
+	if bytes.HasPrefix(nodes2.Prefix(), nodes1.Prefix()) || bytes.HasPrefix(values2.Prefix(), values1.Prefix()) {
+		t.Error("namespace prefixes are not prefix-free")
+	}
+	smt1 := NewSparseMerkleTree(nodes1, values1, sha256.New())
+	smt2 := NewSparseMerkleTree(nodes2, values2, sha256.New())
+	reference := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+
+	for _, tree := range []*SparseMerkleTree{smt1, smt2, reference} {
+		tree.Update([]byte("testKey1"), []byte("testValue1"))
+		tree.Update([]byte("testKey2"), []byte("testValue2"))
+	}
+	smt2.Update([]byte("testKey3"), []byte("testValue3"))
+	_, err := smt2.Delete([]byte("testKey1"))
+	if err != nil {
+		t.Errorf("returned error when deleting key: %v", err)
+	}
+
+	if !bytes.Equal(smt1.Root(), reference.Root()) {
+		t.Error("namespaced tree root differs from a tree with its own stores")
+	}
+	value, err := smt1.Get([]byte("testKey1"))
+	if err != nil {
+		t.Errorf("returned error when getting key: %v", err)
+	}
+	if !bytes.Equal(value, []byte("testValue1")) {
+		t.Error("did not get correct value after a tree in another namespace deleted the same key")
+	}
+	proof, err := smt1.Prove([]byte("testKey2"))
+	if err != nil {
+		t.Errorf("returned error when proving key: %v", err)
+	}
+	if !VerifyProof(proof, smt1.Root(), []byte("testKey2"), []byte("testValue2"), sha256.New()) {
+		t.Error("valid proof failed to verify")
+	}
+	has, err := smt2.Has([]byte("testKey1"))
+	if err != nil {
+		t.Errorf("returned error when checking presence of key: %v", err)
+	}
+	if has {
+		t.Error("deleted key is still present")
+	}
+}
@@ -0,0 +1,188 @@
+package smt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+const (
+	proofEncodingVersion = 1
+
+	proofKindFull    = 0
+	proofKindCompact = 1
+	proofKindClassic = 2
+
+	// maxProofSideNodes bounds the number of side nodes of a decoded proof,
+	// so that a malicious encoding cannot cause a large allocation. It is
+	// the depth of a tree with 512-bit paths.
+	maxProofSideNodes = 512
+)
+
+// ErrBadProofEncoding is returned when a serialized proof cannot be decoded.
+var ErrBadProofEncoding = errors.New("bad proof encoding")
+
+// MarshalBinary encodes the proof, including the identifier of its hash
+// function.
+func (proof *SparseMerkleProof) MarshalBinary() ([]byte, error) {
+	data := []byte{proofEncodingVersion, proofKindFull, byte(proof.HasherID)}
+	data = appendLengthPrefixedList(data, proof.SideNodes)
+	data = appendOptional(data, proof.NonMembershipLeafData)
+	data = appendOptional(data, proof.SiblingData)
+	return data, nil
+}
+
+// UnmarshalBinary decodes a proof encoded by MarshalBinary.
+func (proof *SparseMerkleProof) UnmarshalBinary(data []byte) error {
+	r, hasherID, err := readProofHeader(data, proofKindFull)
+	if err != nil {
+		return err
+	}
+	decoded := SparseMerkleProof{HasherID: hasherID}
+	if decoded.SideNodes, r, err = readLengthPrefixedList(r); err != nil {
+		return fmt.Errorf("%w: side nodes: %v", ErrBadProofEncoding, err)
+	}
+	if decoded.NonMembershipLeafData, r, err = readOptional(r); err != nil {
+		return fmt.Errorf("%w: non-membership leaf data: %v", ErrBadProofEncoding, err)
+	}
+	if decoded.SiblingData, r, err = readOptional(r); err != nil {
+		return fmt.Errorf("%w: sibling data: %v", ErrBadProofEncoding, err)
+	}
+	if len(r) != 0 {
+		return fmt.Errorf("%w: trailing data", ErrBadProofEncoding)
+	}
+	*proof = decoded
+	return nil
+}
+
+// MarshalBinary encodes the compact proof, including the identifier of its
+// hash function.
+func (proof *SparseCompactMerkleProof) MarshalBinary() ([]byte, error) {
+	if proof.NumSideNodes < 0 {
+		return nil, ErrBadProof
+	}
+	data := []byte{proofEncodingVersion, proofKindCompact, byte(proof.HasherID)}
+	data = appendUvarint(data, uint64(proof.NumSideNodes))
+	data = appendLengthPrefixed(data, proof.BitMask)
+	data = appendLengthPrefixedList(data, proof.SideNodes)
+	data = appendOptional(data, proof.NonMembershipLeafData)
+	data = appendOptional(data, proof.SiblingData)
+	return data, nil
+}
+
+// UnmarshalBinary decodes a compact proof encoded by MarshalBinary.
+func (proof *SparseCompactMerkleProof) UnmarshalBinary(data []byte) error {
+	r, hasherID, err := readProofHeader(data, proofKindCompact)
+	if err != nil {
+		return err
+	}
+	decoded := SparseCompactMerkleProof{HasherID: hasherID}
+	numSideNodes, n := binary.Uvarint(r)
+	if n <= 0 || numSideNodes > maxProofSideNodes {
+		return fmt.Errorf("%w: number of side nodes", ErrBadProofEncoding)
+	}
+	decoded.NumSideNodes, r = int(numSideNodes), r[n:]
+	if decoded.BitMask, r, err = readLengthPrefixed(r); err != nil {
+		return fmt.Errorf("%w: bit mask: %v", ErrBadProofEncoding, err)
+	}
+	if decoded.SideNodes, r, err = readLengthPrefixedList(r); err != nil {
+		return fmt.Errorf("%w: side nodes: %v", ErrBadProofEncoding, err)
+	}
+	if decoded.NonMembershipLeafData, r, err = readOptional(r); err != nil {
+		return fmt.Errorf("%w: non-membership leaf data: %v", ErrBadProofEncoding, err)
+	}
+	if decoded.SiblingData, r, err = readOptional(r); err != nil {
+		return fmt.Errorf("%w: sibling data: %v", ErrBadProofEncoding, err)
+	}
+	if len(r) != 0 {
+		return fmt.Errorf("%w: trailing data", ErrBadProofEncoding)
+	}
+	*proof = decoded
+	return nil
+}
+
+// MarshalBinary encodes the classic proof, including the identifier of its hash
+// function.
+func (proof *ClassicMerkleProof) MarshalBinary() ([]byte, error) {
+	data := []byte{proofEncodingVersion, proofKindClassic, byte(proof.HasherID)}
+	return appendLengthPrefixedList(data, proof.SideNodes), nil
+}
+
+// UnmarshalBinary decodes a classic proof encoded by MarshalBinary.
+func (proof *ClassicMerkleProof) UnmarshalBinary(data []byte) error {
+	r, hasherID, err := readProofHeader(data, proofKindClassic)
+	if err != nil {
+		return err
+	}
+	decoded := ClassicMerkleProof{HasherID: hasherID}
+	if decoded.SideNodes, r, err = readLengthPrefixedList(r); err != nil {
+		return fmt.Errorf("%w: side nodes: %v", ErrBadProofEncoding, err)
+	}
+	if len(r) != 0 {
+		return fmt.Errorf("%w: trailing data", ErrBadProofEncoding)
+	}
+	*proof = decoded
+	return nil
+}
+
+func readProofHeader(data []byte, kind byte) ([]byte, HasherID, error) {
+	if len(data) < 3 {
+		return nil, HasherUnknown, fmt.Errorf("%w: short header", ErrBadProofEncoding)
+	}
+	if data[0] != proofEncodingVersion {
+		return nil, HasherUnknown, fmt.Errorf("%w: unsupported version %d", ErrBadProofEncoding, data[0])
+	}
+	if data[1] != kind {
+		return nil, HasherUnknown, fmt.Errorf("%w: unexpected proof kind %d", ErrBadProofEncoding, data[1])
+	}
+	return data[3:], HasherID(data[2]), nil
+}
+
+func appendLengthPrefixedList(data []byte, items [][]byte) []byte {
+	data = appendUvarint(data, uint64(len(items)))
+	for _, item := range items {
+		data = appendLengthPrefixed(data, item)
+	}
+	return data
+}
+
+func readLengthPrefixedList(data []byte) ([][]byte, []byte, error) {
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count > maxProofSideNodes {
+		return nil, nil, errors.New("invalid item count")
+	}
+	data = data[n:]
+	var items [][]byte
+	for i := uint64(0); i < count; i++ {
+		var item []byte
+		var err error
+		if item, data, err = readLengthPrefixed(data); err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+	}
+	return items, data, nil
+}
+
+// appendOptional appends a field that may be nil, which is distinct from an
+// empty field.
+func appendOptional(data []byte, field []byte) []byte {
+	if field == nil {
+		return append(data, 0)
+	}
+	return appendLengthPrefixed(append(data, 1), field)
+}
+
+func readOptional(data []byte) ([]byte, []byte, error) {
+	if len(data) == 0 {
+		return nil, nil, errors.New("missing field")
+	}
+	switch data[0] {
+	case 0:
+		return nil, data[1:], nil
+	case 1:
+		return readLengthPrefixed(data[1:])
+	default:
+		return nil, nil, errors.New("invalid field flag")
+	}
+}
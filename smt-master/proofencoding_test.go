@@ -0,0 +1,95 @@
+package smt
+
+import (
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"testing"
+
+	"MPT_MOI/blake2b"
+)
+
+func TestProofEncoding(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), blake2b.New256())
+	smt.Update([]byte("testKey"), []byte("testValue"))
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+	root, _ := smt.Update([]byte("testKey3"), []byte("testValue3"))
+
+	for _, key := range []string{"testKey", "absentKey", "otherAbsentKey"} {
+		proofs := []SparseMerkleProof{}
+		proof, _ := smt.Prove([]byte(key))
+		proofs = append(proofs, proof)
+		proof, _ = smt.ProveUpdatable([]byte(key))
+		proofs = append(proofs, proof)
+
+		for _, proof := range proofs {
+			data, err := proof.MarshalBinary()
+			if err != nil {
+				t.Fatalf("returned error when encoding proof: %v", err)
+			}
+			var decoded SparseMerkleProof
+			if err = decoded.UnmarshalBinary(data); err != nil {
+				t.Fatalf("returned error when decoding proof: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, proof) {
+				t.Errorf("decoded proof %+v differs from %+v", decoded, proof)
+			}
+			value, _ := smt.Get([]byte(key))
+			if !VerifyProof(decoded, root, []byte(key), value, blake2b.New256()) {
+				t.Errorf("decoded proof for key %q failed to verify", key)
+			}
+			if VerifyProof(decoded, root, []byte(key), value, sha256.New()) {
+				t.Error("decoded proof verified with a different hash function")
+			}
+
+			compact, _ := CompactProof(proof, blake2b.New256())
+			if data, err = compact.MarshalBinary(); err != nil {
+				t.Fatalf("returned error when encoding compact proof: %v", err)
+			}
+			var decodedCompact SparseCompactMerkleProof
+			if err = decodedCompact.UnmarshalBinary(data); err != nil {
+				t.Fatalf("returned error when decoding compact proof: %v", err)
+			}
+			if !reflect.DeepEqual(decodedCompact, compact) {
+				t.Errorf("decoded compact proof %+v differs from %+v", decodedCompact, compact)
+			}
+			if !VerifyCompactProof(decodedCompact, root, []byte(key), value, blake2b.New256()) {
+				t.Errorf("decoded compact proof for key %q failed to verify", key)
+			}
+
+			// A full proof is not a compact proof, and vice versa.
+			if err = decoded.UnmarshalBinary(data); !errors.Is(err, ErrBadProofEncoding) {
+				t.Errorf("got error %v when decoding a compact proof as a full proof", err)
+			}
+		}
+	}
+}
+
+func TestProofEncodingInvalid(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+	smt.Update([]byte("testKey"), []byte("testValue"))
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+	proof, _ := smt.ProveUpdatable([]byte("testKey"))
+	data, _ := proof.MarshalBinary()
+
+	var decoded SparseMerkleProof
+	for i := 0; i < len(data); i++ {
+		if err := decoded.UnmarshalBinary(data[:i]); !errors.Is(err, ErrBadProofEncoding) {
+			t.Errorf("got error %v when decoding a proof truncated to %d bytes", err, i)
+		}
+	}
+	if err := decoded.UnmarshalBinary(append(data, 0)); !errors.Is(err, ErrBadProofEncoding) {
+		t.Errorf("got error %v when decoding a proof with trailing data", err)
+	}
+	bad := append([]byte{}, data...)
+	bad[0] = 99
+	if err := decoded.UnmarshalBinary(bad); !errors.Is(err, ErrBadProofEncoding) {
+		t.Errorf("got error %v when decoding an unsupported version", err)
+	}
+	// A huge side node count must be rejected before allocating.
+	bad = append([]byte{}, data[:3]...)
+	bad = appendUvarint(bad, 1<<40)
+	if err := decoded.UnmarshalBinary(bad); !errors.Is(err, ErrBadProofEncoding) {
+		t.Errorf("got error %v when decoding a huge side node count", err)
+	}
+}
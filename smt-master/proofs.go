@@ -19,6 +19,11 @@ type SparseMerkleProof struct {
 	// SiblingData is the data of the sibling node to the leaf being proven,
 	// required for updatable proofs. For unupdatable proofs, is nil.
 	SiblingData []byte
+
+	// HasherID identifies the hash function of the tree the proof was
+	// generated from. Proofs with HasherUnknown are checked against any hash
+	// function; other proofs are rejected by a different hash function.
+	HasherID HasherID
 }
 
 func (proof *SparseMerkleProof) sanityCheck(th *treeHasher) bool {
@@ -26,11 +31,14 @@ func (proof *SparseMerkleProof) sanityCheck(th *treeHasher) bool {
 	// cause the verifier to fatally exit (e.g. due to an index out-of-range
 	// error) or cause a CPU DoS attack.
 
-	// Check that the number of supplied sidenodes does not exceed the maximum possible.
-	if len(proof.SideNodes) > th.pathSize()*8 ||
+	// Check that the proof was generated with the same hash function.
+	if !proof.HasherID.matches(th) ||
+
+		// Check that the number of supplied sidenodes does not exceed the maximum possible.
+		len(proof.SideNodes) > th.pathSize()*8 ||
 
 		// Check that leaf data for non-membership proofs is the correct size.
-		(proof.NonMembershipLeafData != nil && len(proof.NonMembershipLeafData) != len(leafPrefix)+th.pathSize()+th.hasher.Size()) {
+		(proof.NonMembershipLeafData != nil && !th.leafSizeValid(proof.NonMembershipLeafData)) {
 		return false
 	}
 
@@ -72,6 +80,11 @@ type SparseCompactMerkleProof struct {
 	// SiblingData is the data of the sibling node to the leaf being proven,
 	// required for updatable proofs. For unupdatable proofs, is nil.
 	SiblingData []byte
+
+	// HasherID identifies the hash function of the tree the proof was
+	// generated from. Proofs with HasherUnknown are checked against any hash
+	// function; other proofs are rejected by a different hash function.
+	HasherID HasherID
 }
 
 func (proof *SparseCompactMerkleProof) sanityCheck(th *treeHasher) bool {
@@ -81,8 +94,11 @@ func (proof *SparseCompactMerkleProof) sanityCheck(th *treeHasher) bool {
 	// When the proof is de-compacted and verified, the sanity check for the
 	// de-compacted proof should be executed.
 
-	// Compact proofs: check that NumSideNodes is within the right range.
-	if proof.NumSideNodes < 0 || proof.NumSideNodes > th.pathSize()*8 ||
+	// Check that the proof was generated with the same hash function.
+	if !proof.HasherID.matches(th) ||
+
+		// Compact proofs: check that NumSideNodes is within the right range.
+		proof.NumSideNodes < 0 || proof.NumSideNodes > th.pathSize()*8 ||
 
 		// Compact proofs: check that the length of the bit mask is as expected
 		// according to NumSideNodes.
@@ -97,17 +113,16 @@ func (proof *SparseCompactMerkleProof) sanityCheck(th *treeHasher) bool {
 	return true
 }
 
-// VerifyProof verifies a Merkle proof.
-func VerifyProof(proof SparseMerkleProof, root []byte, key []byte, value []byte, hasher hash.Hash) bool {
-	result, _ := verifyProofWithUpdates(proof, root, key, value, hasher)
+// VerifyProof verifies a Merkle proof. The options must be the ones of the
+// tree the proof was generated from.
+func VerifyProof(proof SparseMerkleProof, root []byte, key []byte, value []byte, hasher hash.Hash, options ...Option) bool {
+	result, _ := verifyProofWithUpdates(proof, root, key, value, treeHasherFromOptions(hasher, options))
 	return result
 }
 
-func verifyProofWithUpdates(proof SparseMerkleProof, root []byte, key []byte, value []byte, hasher hash.Hash) (bool, [][][]byte) {
-	th := newTreeHasher(hasher)
-	path := th.path(key)
-
-	if !proof.sanityCheck(th) {
+func verifyProofWithUpdates(proof SparseMerkleProof, root []byte, key []byte, value []byte, th *treeHasher) (bool, [][][]byte) {
+	path, err := th.path(key)
+	if err != nil || !proof.sanityCheck(th) {
 		return false, nil
 	}
 
@@ -119,20 +134,19 @@ func verifyProofWithUpdates(proof SparseMerkleProof, root []byte, key []byte, va
 		if proof.NonMembershipLeafData == nil { // Leaf is a placeholder value.
 			currentHash = th.placeholder()
 		} else { // Leaf is an unrelated leaf.
-			actualPath, valueHash := th.parseLeaf(proof.NonMembershipLeafData)
+			actualPath, valueData := th.parseLeaf(proof.NonMembershipLeafData)
 			if bytes.Equal(actualPath, path) {
 				// This is not an unrelated leaf; non-membership proof failed.
 				return false, nil
 			}
-			currentHash, currentData = th.digestLeaf(actualPath, valueHash)
+			currentHash, currentData = th.digestLeaf(actualPath, valueData)
 
 			update := make([][]byte, 2)
 			update[0], update[1] = currentHash, currentData
 			updates = append(updates, update)
 		}
 	} else { // Membership proof.
-		valueHash := th.digest(value)
-		currentHash, currentData = th.digestLeaf(path, valueHash)
+		currentHash, currentData = th.digestLeaf(path, th.valueData(value))
 		update := make([][]byte, 2)
 		update[0], update[1] = currentHash, currentData
 		updates = append(updates, update)
@@ -140,7 +154,7 @@ func verifyProofWithUpdates(proof SparseMerkleProof, root []byte, key []byte, va
 
 	// Recompute root.
 	for i := 0; i < len(proof.SideNodes); i++ {
-		node := make([]byte, th.pathSize())
+		node := make([]byte, th.hasher.Size())
 		copy(node, proof.SideNodes[i])
 
 		if getBitAtFromMSB(path, len(proof.SideNodes)-1-i) == right {
@@ -157,19 +171,41 @@ func verifyProofWithUpdates(proof SparseMerkleProof, root []byte, key []byte, va
 	return bytes.Equal(currentHash, root), updates
 }
 
-// VerifyCompactProof verifies a compacted Merkle proof.
-func VerifyCompactProof(proof SparseCompactMerkleProof, root []byte, key []byte, value []byte, hasher hash.Hash) bool {
-	decompactedProof, err := DecompactProof(proof, hasher)
+// VerifyCompactProof verifies a compacted Merkle proof. The options must be the
+// ones of the tree the proof was generated from.
+func VerifyCompactProof(proof SparseCompactMerkleProof, root []byte, key []byte, value []byte, hasher hash.Hash, options ...Option) bool {
+	th := treeHasherFromOptions(hasher, options)
+	decompactedProof, err := decompactProof(proof, th)
+	if err != nil {
+		return false
+	}
+	result, _ := verifyProofWithUpdates(decompactedProof, root, key, value, th)
+	return result
+}
+
+// VerifyProof verifies a Merkle proof with the hash function and the options of
+// the tree.
+func (smt *SparseMerkleTree) VerifyProof(proof SparseMerkleProof, root []byte, key []byte, value []byte) bool {
+	result, _ := verifyProofWithUpdates(proof, root, key, value, &smt.th)
+	return result
+}
+
+// VerifyCompactProof verifies a compacted Merkle proof with the hash function
+// and the options of the tree.
+func (smt *SparseMerkleTree) VerifyCompactProof(proof SparseCompactMerkleProof, root []byte, key []byte, value []byte) bool {
+	decompactedProof, err := decompactProof(proof, &smt.th)
 	if err != nil {
 		return false
 	}
-	return VerifyProof(decompactedProof, root, key, value, hasher)
+	return smt.VerifyProof(decompactedProof, root, key, value)
 }
 
 // CompactProof compacts a proof, to reduce its size.
-func CompactProof(proof SparseMerkleProof, hasher hash.Hash) (SparseCompactMerkleProof, error) {
-	th := newTreeHasher(hasher)
+func CompactProof(proof SparseMerkleProof, hasher hash.Hash, options ...Option) (SparseCompactMerkleProof, error) {
+	return compactProof(proof, treeHasherFromOptions(hasher, options))
+}
 
+func compactProof(proof SparseMerkleProof, th *treeHasher) (SparseCompactMerkleProof, error) {
 	if !proof.sanityCheck(th) {
 		return SparseCompactMerkleProof{}, ErrBadProof
 	}
@@ -192,13 +228,16 @@ func CompactProof(proof SparseMerkleProof, hasher hash.Hash) (SparseCompactMerkl
 		BitMask:               bitMask,
 		NumSideNodes:          len(proof.SideNodes),
 		SiblingData:           proof.SiblingData,
+		HasherID:              proof.HasherID,
 	}, nil
 }
 
 // DecompactProof decompacts a proof, so that it can be used for VerifyProof.
-func DecompactProof(proof SparseCompactMerkleProof, hasher hash.Hash) (SparseMerkleProof, error) {
-	th := newTreeHasher(hasher)
+func DecompactProof(proof SparseCompactMerkleProof, hasher hash.Hash, options ...Option) (SparseMerkleProof, error) {
+	return decompactProof(proof, treeHasherFromOptions(hasher, options))
+}
 
+func decompactProof(proof SparseCompactMerkleProof, th *treeHasher) (SparseMerkleProof, error) {
 	if !proof.sanityCheck(th) {
 		return SparseMerkleProof{}, ErrBadProof
 	}
@@ -218,5 +257,6 @@ func DecompactProof(proof SparseCompactMerkleProof, hasher hash.Hash) (SparseMer
 		SideNodes:             decompactedSideNodes,
 		NonMembershipLeafData: proof.NonMembershipLeafData,
 		SiblingData:           proof.SiblingData,
+		HasherID:              proof.HasherID,
 	}, nil
 }
@@ -6,6 +6,8 @@ import (
 	"hash"
 	"math/rand"
 	"testing"
+
+	"MPT_MOI/keccak"
 )
 
 // Test base case Merkle proof operations.
@@ -91,7 +93,8 @@ func TestProofsBasic(t *testing.T) {
 
 	// Try proving a default value for a non-default leaf.
 	th := newTreeHasher(smt.th.hasher)
-	_, leafData := th.digestLeaf(th.path([]byte("testKey2")), th.digest([]byte("testValue")))
+	path, _ := th.path([]byte("testKey2"))
+	_, leafData := th.digestLeaf(path, th.digest([]byte("testValue")))
 	proof = SparseMerkleProof{
 		SideNodes:             proof.SideNodes,
 		NonMembershipLeafData: leafData,
@@ -246,6 +249,49 @@ func TestCompactProofsSanityCheck(t *testing.T) {
 	}
 }
 
+// Test the tree and its proofs with Keccak-256 against roots derived from the
+// definition of the tree.
+func TestProofsKeccak(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), keccak.NewLegacyKeccak256())
+
+	root, _ := smt.Update([]byte("testKey"), []byte("testValue"))
+	want := referenceRoot(keccak.NewLegacyKeccak256(), map[string]string{"testKey": "testValue"}, referenceSpec{})
+	if !bytes.Equal(root, want) {
+		t.Errorf("got root %x, want %x", root, want)
+	}
+	kv := map[string]string{"testKey": "testValue", "testKey2": "testValue2", "foo": "bar"}
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+	root, _ = smt.Update([]byte("foo"), []byte("bar"))
+	if want := referenceRoot(keccak.NewLegacyKeccak256(), kv, referenceSpec{}); !bytes.Equal(root, want) {
+		t.Errorf("got root %x, want %x", root, want)
+	}
+
+	for k, v := range kv {
+		proof, err := smt.Prove([]byte(k))
+		if err != nil {
+			t.Errorf("error returned when trying to prove inclusion: %v", err)
+		}
+		checkCompactEquivalence(t, proof, smt.th.hasher)
+		if !VerifyProof(proof, root, []byte(k), []byte(v), keccak.NewLegacyKeccak256()) {
+			t.Errorf("valid proof for key %q failed to verify", k)
+		}
+		if VerifyProof(proof, root, []byte(k), []byte("badValue"), keccak.NewLegacyKeccak256()) {
+			t.Error("invalid proof verification returned true")
+		}
+	}
+
+	proof, err := smt.Prove([]byte("absentKey"))
+	if err != nil {
+		t.Errorf("error returned when trying to prove non-membership: %v", err)
+	}
+	if !VerifyProof(proof, root, []byte("absentKey"), defaultValue, keccak.NewLegacyKeccak256()) {
+		t.Error("valid non-membership proof failed to verify")
+	}
+	if VerifyProof(proof, root, []byte("absentKey"), defaultValue, sha256.New()) {
+		t.Error("proof verification with a different hasher returned true")
+	}
+}
+
 func randomiseProof(proof SparseMerkleProof) SparseMerkleProof {
 	sideNodes := make([][]byte, len(proof.SideNodes))
 	for i := range sideNodes {
@@ -279,3 +325,30 @@ func checkCompactEquivalence(t *testing.T, proof SparseMerkleProof, hasher hash.
 		t.Error("de-compacted proof does not match original proof")
 	}
 }
+
+// Test verifying proofs with the hash function and options of a tree.
+func TestTreeVerifyProof(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), Depth(16), RawKeys(), LeafPrefix([]byte{2}), NodePrefix([]byte{3}))
+	smt.Update([]byte("ab"), []byte("testValue"))
+	smt.Update([]byte("cd"), []byte("testValue2"))
+
+	proof, _ := smt.Prove([]byte("ab"))
+	if !smt.VerifyProof(proof, smt.Root(), []byte("ab"), []byte("testValue")) {
+		t.Error("valid proof failed to verify")
+	}
+	if smt.VerifyProof(proof, smt.Root(), []byte("ab"), []byte("badValue")) {
+		t.Error("invalid proof verification returned true")
+	}
+	// The package function needs the options of the tree.
+	if VerifyProof(proof, smt.Root(), []byte("ab"), []byte("testValue"), sha256.New()) {
+		t.Error("proof verified without the options of the tree")
+	}
+
+	compactProof, _ := smt.ProveCompact([]byte("ef"))
+	if !smt.VerifyCompactProof(compactProof, smt.Root(), []byte("ef"), defaultValue) {
+		t.Error("valid compact proof failed to verify")
+	}
+	if smt.VerifyCompactProof(compactProof, smt.Root(), []byte("ef"), []byte("testValue")) {
+		t.Error("invalid compact proof verification returned true")
+	}
+}
@@ -0,0 +1,159 @@
+package smt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"sort"
+)
+
+// ErrInlineValuesRebuild is returned when rebuilding a tree with inline values,
+// which has no values store to rebuild from.
+var ErrInlineValuesRebuild = errors.New("trees with inline values cannot be rebuilt from a values store")
+
+// RebuildSparseMerkleTree rebuilds the nodes of a tree from its values store,
+// for instance after losing or corrupting its node store. It writes the nodes
+// to the given node store, which should be empty, and returns the tree, at the
+// root of the values. The hash function and the options must be the ones of
+// the lost tree; with PersistRoot, the root is committed to the node store.
+//
+// The paths and the hashes of the values are held in memory and sorted, and
+// the nodes are then built bottom-up in a single pass.
+func RebuildSparseMerkleTree(nodes MapStore, values IterableMapStore, hasher hash.Hash, options ...Option) (*SparseMerkleTree, error) {
+	smt := NewSparseMerkleTree(nodes, values, hasher, options...)
+	if smt.th.inlineValues {
+		return nil, ErrInlineValuesRebuild
+	}
+
+	type leaf struct {
+		path, valueData []byte
+	}
+	var leaves []leaf
+	err := values.Iterate(func(path, value []byte) error {
+		if len(path) != smt.th.pathSize() {
+			return fmt.Errorf("%w: values store has key %x", ErrBadKeySize, path)
+		}
+		leaves = append(leaves, leaf{path: append([]byte(nil), path...), valueData: smt.th.valueData(value)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		return bytes.Compare(leaves[i].path, leaves[j].path) < 0
+	})
+
+	b := treeBuilder{smt: smt}
+	for _, leaf := range leaves {
+		if err := b.add(leaf.path, leaf.valueData); err != nil {
+			return nil, err
+		}
+	}
+	root, err := b.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	smt.SetRoot(root)
+	if smt.persistRoot {
+		if err := smt.CommitRoot(); err != nil {
+			return nil, err
+		}
+	}
+	return smt, nil
+}
+
+// builderNode is a subtree built by a treeBuilder, with the path of one of its
+// leaves.
+type builderNode struct {
+	hash  []byte
+	path  []byte
+	depth int
+}
+
+// treeBuilder writes the nodes of a tree bottom-up from its leaves, added in
+// ascending order of paths. The depth of a leaf is one more than the longest
+// common prefix of its path with the paths of its neighbours, so each leaf is
+// placed once the next one is known.
+type treeBuilder struct {
+	smt *SparseMerkleTree
+
+	// stack holds the subtrees waiting for their right siblings, by
+	// increasing depth.
+	stack []builderNode
+	// pending is the last leaf added, and split the length of the common
+	// prefix of its path with the path of the leaf before, or -1.
+	pending *builderNode
+	split   int
+}
+
+// add adds a leaf, with the data of its value.
+func (b *treeBuilder) add(path, valueData []byte) error {
+	if b.pending == nil {
+		b.split = -1
+	} else {
+		if bytes.Compare(path, b.pending.path) <= 0 {
+			return fmt.Errorf("path %x after path %x: paths are not in ascending order", path, b.pending.path)
+		}
+		split := countCommonPrefix(b.pending.path, path)
+		if err := b.place(split); err != nil {
+			return err
+		}
+		b.split = split
+	}
+
+	hash, data := b.smt.th.digestLeaf(path, valueData)
+	if err := b.smt.nodes.Set(hash, data); err != nil {
+		return err
+	}
+	b.pending = &builderNode{hash: hash, path: path}
+	return nil
+}
+
+// finish builds the nodes above the last leaf, and returns the root.
+func (b *treeBuilder) finish() ([]byte, error) {
+	if b.pending == nil {
+		return b.smt.th.placeholder(), nil
+	}
+	if err := b.place(-1); err != nil {
+		return nil, err
+	}
+	return b.stack[0].hash, nil
+}
+
+// place pushes the pending leaf at its depth, given the length of the common
+// prefix of its path with the path of the next leaf, or -1 for the last leaf,
+// and builds the nodes up to the depth where the next leaf branches off.
+func (b *treeBuilder) place(nextSplit int) error {
+	depth := b.split
+	if nextSplit > depth {
+		depth = nextSplit
+	}
+	b.pending.depth = depth + 1
+	b.stack = append(b.stack, *b.pending)
+
+	for {
+		top := b.stack[len(b.stack)-1]
+		if top.depth <= nextSplit+1 {
+			return nil
+		}
+		var leftNode, rightNode []byte
+		if n := len(b.stack); n > 1 && b.stack[n-2].depth == top.depth {
+			// The subtree below is the left sibling of the top one.
+			leftNode, rightNode = b.stack[n-2].hash, top.hash
+			b.stack = b.stack[:n-2]
+		} else if getBitAtFromMSB(top.path, top.depth-1) == right {
+			leftNode, rightNode = b.smt.th.placeholder(), top.hash
+			b.stack = b.stack[:n-1]
+		} else {
+			leftNode, rightNode = top.hash, b.smt.th.placeholder()
+			b.stack = b.stack[:n-1]
+		}
+		hash, data := b.smt.th.digestNode(leftNode, rightNode)
+		if err := b.smt.nodes.Set(hash, data); err != nil {
+			return err
+		}
+		b.stack = append(b.stack, builderNode{hash: hash, path: top.path, depth: top.depth - 1})
+	}
+}
@@ -0,0 +1,78 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestRebuildSparseMerkleTree(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 3, 50, 500} {
+		nodes, values := NewSimpleMap(), NewSimpleMap()
+		smt := NewSparseMerkleTree(nodes, values, sha256.New())
+		for i := 0; i < n; i++ {
+			smt.Update([]byte{byte(i), byte(i >> 8)}, []byte{byte(i), 1})
+		}
+
+		rebuiltNodes := NewSimpleMap()
+		rebuilt, err := RebuildSparseMerkleTree(rebuiltNodes, values, sha256.New(), PersistRoot())
+		if err != nil {
+			t.Fatalf("%d leaves: returned error: %v", n, err)
+		}
+		if !bytes.Equal(rebuilt.Root(), smt.Root()) {
+			t.Errorf("%d leaves: got root %x, want %x", n, rebuilt.Root(), smt.Root())
+		}
+		// The same nodes are rebuilt, besides the metadata record.
+		if _, err := ReadTreeMetadata(rebuiltNodes); err != nil {
+			t.Errorf("%d leaves: root not committed: %v", n, err)
+		}
+		delete(rebuiltNodes.m, string(metadataKey))
+		if len(rebuiltNodes.m) != len(nodes.m) {
+			t.Errorf("%d leaves: rebuilt %d nodes, want %d", n, len(rebuiltNodes.m), len(nodes.m))
+		}
+		for key, data := range nodes.m {
+			if !bytes.Equal(rebuiltNodes.m[key], data) {
+				t.Errorf("%d leaves: node %x not rebuilt", n, key)
+				break
+			}
+		}
+	}
+}
+
+func TestRebuildShallowTree(t *testing.T) {
+	// Every leaf of a full tree of depth 8 is at the bottom.
+	options := []Option{Depth(8), RawKeys(), LeafPrefix([]byte{2}), NodePrefix([]byte{3})}
+	for _, count := range []int{256, 17} {
+		values := NewSimpleMap()
+		smt := NewSparseMerkleTree(NewSimpleMap(), values, sha256.New(), options...)
+		for _, i := range rand.New(rand.NewSource(int64(count))).Perm(256)[:count] {
+			smt.Update([]byte{byte(i)}, []byte{byte(i)})
+		}
+		rebuilt, err := RebuildSparseMerkleTree(NewSimpleMap(), values, sha256.New(), options...)
+		if err != nil || !bytes.Equal(rebuilt.Root(), smt.Root()) {
+			t.Errorf("%d leaves: got root %x, want %x: %v", count, rebuilt.Root(), smt.Root(), err)
+		}
+		if report, err := rebuilt.Check(); err != nil || !report.OK() {
+			t.Errorf("%d leaves: rebuilt tree has problems %v: %v", count, report.Problems, err)
+		}
+	}
+}
+
+func TestRebuildErrors(t *testing.T) {
+	values := NewSimpleMap()
+	values.Set([]byte("short"), []byte("value"))
+	if _, err := RebuildSparseMerkleTree(NewSimpleMap(), values, sha256.New()); !errors.Is(err, ErrBadKeySize) {
+		t.Errorf("got error %v for a value with a bad key, want %v", err, ErrBadKeySize)
+	}
+	if _, err := RebuildSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), InlineValues()); err != ErrInlineValuesRebuild {
+		t.Errorf("got error %v for inline values, want %v", err, ErrInlineValuesRebuild)
+	}
+
+	b := treeBuilder{smt: NewSparseMerkleTree(NewSimpleMap(), nil, sha256.New())}
+	b.add(bytes.Repeat([]byte{1}, 32), nil)
+	if err := b.add(bytes.Repeat([]byte{1}, 32), nil); err == nil {
+		t.Error("no error for paths out of order")
+	}
+}
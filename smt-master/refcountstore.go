@@ -0,0 +1,111 @@
+package smt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// RefCountedMapStore is a MapStore that counts references to each key. Set
+// increments the count and Delete decrements it, and a key is only removed
+// from the underlying store once its count drops to zero.
+//
+// Because tree nodes are content-addressed, identical nodes produced by
+// different trees share a single entry. A SparseMerkleTree balances every Set
+// on its node store with a Delete once the node is orphaned, so each tree
+// holds exactly one reference to every node reachable from its root. Using a
+// RefCountedMapStore as the node store therefore lets several trees share one
+// store without orphan removal in one tree deleting nodes still used by
+// another.
+type RefCountedMapStore struct {
+	base   MapStore
+	counts MapStore
+}
+
+// NewRefCountedMapStore creates a new RefCountedMapStore that keeps values in
+// base and reference counts in counts. Both may be namespaces of the same
+// store, see NewPrefixedMapStore.
+func NewRefCountedMapStore(base MapStore, counts MapStore) *RefCountedMapStore {
+	return &RefCountedMapStore{
+		base:   base,
+		counts: counts,
+	}
+}
+
+// RefCount returns the number of references held to a key. Keys that are not
+// in the store have a count of zero.
+func (rc *RefCountedMapStore) RefCount(key []byte) (uint64, error) {
+	data, err := rc.counts.Get(key)
+	if err != nil {
+		var invalidKeyError *InvalidKeyError
+		if errors.As(err, &invalidKeyError) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	if len(data) != 8 {
+		return 0, fmt.Errorf("malformed reference count for key %x", key)
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+func (rc *RefCountedMapStore) setRefCount(key []byte, count uint64) error {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, count)
+	return rc.counts.Set(key, data)
+}
+
+// Get gets the value for a key.
+func (rc *RefCountedMapStore) Get(key []byte) ([]byte, error) {
+	return rc.base.Get(key)
+}
+
+// Set adds a reference to a key, storing its value if it is the first one.
+func (rc *RefCountedMapStore) Set(key []byte, value []byte) error {
+	count, err := rc.RefCount(key)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		if err := rc.base.Set(key, value); err != nil {
+			return err
+		}
+	}
+	return rc.setRefCount(key, count+1)
+}
+
+// SetUncounted updates the value for a key in the underlying store without
+// adding a reference to it. The key must not also be written with Set.
+func (rc *RefCountedMapStore) SetUncounted(key []byte, value []byte) error {
+	return rc.base.Set(key, value)
+}
+
+// Delete removes a reference to a key, deleting it from the underlying store
+// once no references remain.
+func (rc *RefCountedMapStore) Delete(key []byte) error {
+	count, err := rc.RefCount(key)
+	if err != nil {
+		return err
+	}
+	switch count {
+	case 0:
+		return &InvalidKeyError{Key: key}
+	case 1:
+		if err := rc.base.Delete(key); err != nil {
+			return err
+		}
+		return rc.counts.Delete(key)
+	default:
+		return rc.setRefCount(key, count-1)
+	}
+}
+
+// Iterate calls fn for every key-value pair in the underlying store. It
+// returns ErrNotIterable if the underlying store is not an IterableMapStore.
+func (rc *RefCountedMapStore) Iterate(fn func(key []byte, value []byte) error) error {
+	base, ok := rc.base.(IterableMapStore)
+	if !ok {
+		return ErrNotIterable
+	}
+	return base.Iterate(fn)
+}
@@ -0,0 +1,164 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestRefCountedMapStore(t *testing.T) {
+	base, counts := NewSimpleMap(), NewSimpleMap()
+	rc := NewRefCountedMapStore(base, counts)
+
+	rc.Set([]byte("key"), []byte("value"))
+	rc.Set([]byte("key"), []byte("value"))
+	count, err := rc.RefCount([]byte("key"))
+	if err != nil {
+		t.Errorf("getting a reference count returned an error: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 references, got: %d", count)
+	}
+
+	if err = rc.Delete([]byte("key")); err != nil {
+		t.Errorf("deleting a key returned an error: %v", err)
+	}
+	value, err := rc.Get([]byte("key"))
+	if err != nil {
+		t.Errorf("key with remaining references was removed: %v", err)
+	}
+	if !bytes.Equal(value, []byte("value")) {
+		t.Error("got incorrect value for referenced key")
+	}
+
+	if err = rc.Delete([]byte("key")); err != nil {
+		t.Errorf("deleting a key returned an error: %v", err)
+	}
+	if _, err = rc.Get([]byte("key")); err == nil {
+		t.Error("key without references was not removed")
+	}
+	if len(base.m) != 0 || len(counts.m) != 0 {
+		t.Error("stores are not empty after removing all references")
+	}
+	if err = rc.Delete([]byte("key")); err == nil {
+		t.Error("deleting a key did not return an error on a non-existent key")
+	}
+}
+
+// Test that a tree holds exactly one reference to each of its nodes.
+func TestRefCountedMapStoreBalanced(t *testing.T) {
+	rc := NewRefCountedMapStore(NewSimpleMap(), NewSimpleMap())
+	smt := NewSparseMerkleTree(rc, NewSimpleMap(), sha256.New())
+
+	smt.Update([]byte("testKey1"), []byte("testValue1"))
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+	smt.Update([]byte("testKey3"), []byte("testValue3"))
+	smt.Update([]byte("testKey1"), []byte("testValue4"))
+	smt.Delete([]byte("testKey3"))
+
+	for k := range rc.counts.(*SimpleMap).m {
+		count, err := rc.RefCount([]byte(k))
+		if err != nil {
+			t.Errorf("getting a reference count returned an error: %v", err)
+		}
+		if count != 1 {
+			t.Errorf("expected 1 reference to node %x, got: %d", k, count)
+		}
+	}
+
+	smt.Delete([]byte("testKey1"))
+	smt.Delete([]byte("testKey2"))
+	if len(rc.base.(*SimpleMap).m) != 0 {
+		t.Error("node store is not empty after deleting all keys")
+	}
+}
+
+// Test that trees sharing a node store do not remove each other's nodes.
+func TestRefCountedMapStoreSharedTrees(t *testing.T) {
+	rc := NewRefCountedMapStore(NewSimpleMap(), NewSimpleMap())
+	smt1 := NewSparseMerkleTree(rc, NewSimpleMap(), sha256.New())
+	smt2 := NewSparseMerkleTree(rc, NewSimpleMap(), sha256.New())
+
+	for _, tree := range []*SparseMerkleTree{smt1, smt2} {
+		tree.Update([]byte("testKey1"), []byte("testValue1"))
+		tree.Update([]byte("testKey2"), []byte("testValue2"))
+		tree.Update([]byte("testKey3"), []byte("testValue3"))
+	}
+	if !bytes.Equal(smt1.Root(), smt2.Root()) {
+		t.Error("trees with the same contents have different roots")
+	}
+
+	_, err := smt1.Update([]byte("testKey1"), []byte("testValue4"))
+	if err != nil {
+		t.Errorf("returned error when updating key: %v", err)
+	}
+	smt1.Delete([]byte("testKey2"))
+	smt1.Delete([]byte("testKey3"))
+
+	for i, key := range []string{"testKey1", "testKey2", "testKey3"} {
+		value, err := smt2.GetDescend([]byte(key))
+		if err != nil {
+			t.Errorf("returned error when descending shared tree: %v", err)
+		}
+		if !bytes.Equal(value, []byte("testValue"+string(rune('1'+i)))) {
+			t.Error("did not get correct value from shared tree")
+		}
+		proof, err := smt2.Prove([]byte(key))
+		if err != nil {
+			t.Errorf("returned error when proving key in shared tree: %v", err)
+		}
+		if !VerifyProof(proof, smt2.Root(), []byte(key), value, sha256.New()) {
+			t.Error("valid proof failed to verify in shared tree")
+		}
+	}
+
+	smt1.Delete([]byte("testKey1"))
+	for _, key := range []string{"testKey1", "testKey2", "testKey3"} {
+		if _, err = smt2.Delete([]byte(key)); err != nil {
+			t.Errorf("returned error when deleting key from shared tree: %v", err)
+		}
+	}
+	if len(rc.base.(*SimpleMap).m) != 0 {
+		t.Error("node store is not empty after both trees were emptied")
+	}
+}
+
+// Test that batches keep the reference counts of shared nodes balanced when a
+// node is orphaned and set again within a batch.
+func TestRefCountedMapStoreUpdateBatch(t *testing.T) {
+	rc := NewRefCountedMapStore(NewSimpleMap(), NewSimpleMap())
+	smt1 := NewSparseMerkleTree(rc, NewSimpleMap(), sha256.New())
+	smt2 := NewSparseMerkleTree(rc, NewSimpleMap(), sha256.New())
+	for _, tree := range []*SparseMerkleTree{smt1, smt2} {
+		tree.Update([]byte("testKey1"), []byte("testValue1"))
+		tree.Update([]byte("testKey2"), []byte("testValue2"))
+	}
+
+	keys := [][]byte{[]byte("testKey1"), []byte("testKey3"), []byte("testKey3"), []byte("testKey1")}
+	values := [][]byte{[]byte("testValue3"), []byte("testValue3"), defaultValue, []byte("testValue1")}
+	if _, err := smt1.UpdateBatch(keys, values); err != nil {
+		t.Fatalf("returned error when updating batch: %v", err)
+	}
+	if !bytes.Equal(smt1.Root(), smt2.Root()) {
+		t.Error("batch restoring the contents of a tree changed its root")
+	}
+	for k := range rc.counts.(*SimpleMap).m {
+		count, err := rc.RefCount([]byte(k))
+		if err != nil {
+			t.Errorf("getting a reference count returned an error: %v", err)
+		}
+		if count != 2 {
+			t.Errorf("expected 2 references to node %x, got: %d", k, count)
+		}
+	}
+
+	for _, tree := range []*SparseMerkleTree{smt1, smt2} {
+		if _, err := tree.UpdateBatch([][]byte{[]byte("testKey1"), []byte("testKey2")}, [][]byte{defaultValue, defaultValue}); err != nil {
+			t.Errorf("returned error when deleting keys in a batch: %v", err)
+		}
+	}
+	if len(rc.base.(*SimpleMap).m) != 0 || len(rc.counts.(*SimpleMap).m) != 0 {
+		t.Error("node store is not empty after both trees were emptied")
+	}
+}
@@ -0,0 +1,128 @@
+package smt
+
+import (
+	"hash"
+	"sort"
+)
+
+// referenceSpec holds the parameters of a tree set by its options, for
+// referenceRoot. The zero value is a tree without options.
+type referenceSpec struct {
+	leafPrefix, nodePrefix []byte
+	// With rawKeys, the keys are the paths, so they also set the depth.
+	rawKeys      bool
+	inlineValues bool
+}
+
+// referenceRoot computes the root of a tree holding kv from the definition of
+// the tree, without treeHasher, so that the roots computed by trees can be
+// checked against it. A key is at the path of its digest, or of the key itself
+// with raw keys. An empty subtree hashes to zeros,
+// a subtree with a single leaf to H(leafPrefix || path || H(value)), or
+// H(leafPrefix || path || value) with inline values, and any other subtree to
+// H(nodePrefix || left || right), with its leaves split by the bit of their
+// paths at its depth, from the most significant bit.
+func referenceRoot(hasher hash.Hash, kv map[string]string, spec referenceSpec) []byte {
+	digest := func(data ...[]byte) []byte {
+		hasher.Reset()
+		for _, d := range data {
+			hasher.Write(d)
+		}
+		return hasher.Sum(nil)
+	}
+	leafPrefix, nodePrefix := []byte{0}, []byte{1}
+	if spec.leafPrefix != nil {
+		leafPrefix = spec.leafPrefix
+	}
+	if spec.nodePrefix != nil {
+		nodePrefix = spec.nodePrefix
+	}
+
+	type leaf struct {
+		path, data []byte
+	}
+	var leaves []leaf
+	for k, v := range kv {
+		path := []byte(k)
+		if !spec.rawKeys {
+			path = digest(path)
+		}
+		data := []byte(v)
+		if !spec.inlineValues {
+			data = digest(data)
+		}
+		leaves = append(leaves, leaf{path: path, data: data})
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		return string(leaves[i].path) < string(leaves[j].path)
+	})
+
+	var root func(leaves []leaf, bit int) []byte
+	root = func(leaves []leaf, bit int) []byte {
+		switch len(leaves) {
+		case 0:
+			return make([]byte, hasher.Size())
+		case 1:
+			return digest(leafPrefix, leaves[0].path, leaves[0].data)
+		}
+		// The leaves are sorted, so those on the left come first.
+		split := sort.Search(len(leaves), func(i int) bool {
+			return leaves[i].path[bit/8]&(0x80>>(bit%8)) != 0
+		})
+		return digest(nodePrefix, root(leaves[:split], bit+1), root(leaves[split:], bit+1))
+	}
+	return root(leaves, 0)
+}
+
+// referenceClassicRoot computes the root of a classic tree with paths of depth
+// bytes holding kv from the definition of the tree, so that the roots computed
+// by classic trees can be checked against it. A key is at the path of its
+// digest, or of the key itself with raw keys. A leaf
+// hashes to H(value) and an empty leaf to zeros, and an inner node hashes to
+// H(left || right), with its leaves split by the bit of their paths at its
+// depth, from the most significant bit.
+func referenceClassicRoot(hasher hash.Hash, kv map[string]string, depth int, rawKeys bool) []byte {
+	digest := func(data ...[]byte) []byte {
+		hasher.Reset()
+		for _, d := range data {
+			hasher.Write(d)
+		}
+		return hasher.Sum(nil)
+	}
+	height := depth * 8
+	// empty holds the hashes of empty subtrees, by height.
+	empty := [][]byte{make([]byte, hasher.Size())}
+	for h := 1; h <= height; h++ {
+		empty = append(empty, digest(empty[h-1], empty[h-1]))
+	}
+
+	type leaf struct {
+		path, value []byte
+	}
+	var leaves []leaf
+	for k, v := range kv {
+		path := []byte(k)
+		if !rawKeys {
+			path = digest(path)
+		}
+		leaves = append(leaves, leaf{path: path, value: []byte(v)})
+	}
+	sort.Slice(leaves, func(i, j int) bool {
+		return string(leaves[i].path) < string(leaves[j].path)
+	})
+
+	var root func(leaves []leaf, bit int) []byte
+	root = func(leaves []leaf, bit int) []byte {
+		if len(leaves) == 0 {
+			return empty[height-bit]
+		}
+		if bit == height {
+			return digest(leaves[0].value)
+		}
+		split := sort.Search(len(leaves), func(i int) bool {
+			return leaves[i].path[bit/8]&(0x80>>(bit%8)) != 0
+		})
+		return digest(root(leaves[:split], bit+1), root(leaves[split:], bit+1))
+	}
+	return root(leaves, 0)
+}
@@ -0,0 +1,172 @@
+package smt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// renderHashSize is the number of bytes of the hashes shown in renderings.
+const renderHashSize = 4
+
+// renderKind is the kind of a node in a rendering.
+type renderKind int
+
+const (
+	renderPlaceholder renderKind = iota
+	renderLeaf
+	renderInner
+	// renderCollapsed is an inner node off the rendered path, whose subtree
+	// is not shown.
+	renderCollapsed
+)
+
+// renderNode is a node of a rendering.
+type renderNode struct {
+	kind renderKind
+	hash []byte
+	// path and valueHash are set for leaves.
+	path      []byte
+	valueHash []byte
+	children  [2]*renderNode
+}
+
+// RenderDOT writes the tree at its current root as a Graphviz DOT digraph. With
+// a non-nil key, only the path of the key is expanded, and the inner nodes off
+// the path are shown collapsed. Leaves are labelled with their hashes and the
+// hashes of their paths and values, inner nodes with their hashes, and
+// placeholders as empty; hashes are truncated.
+func (smt *SparseMerkleTree) RenderDOT(w io.Writer, key []byte) error {
+	root, err := smt.renderTree(key)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("digraph smt {\n")
+	b.WriteString("\tnode [fontname=\"monospace\"];\n")
+	id := 0
+	var visit func(n *renderNode) int
+	visit = func(n *renderNode) int {
+		nodeID := id
+		id++
+		switch n.kind {
+		case renderPlaceholder:
+			fmt.Fprintf(&b, "\tn%d [shape=point, label=\"\", xlabel=\"empty\"];\n", nodeID)
+		case renderLeaf:
+			fmt.Fprintf(&b, "\tn%d [shape=ellipse, label=\"leaf %s\\npath %s\\nvalue %s\"];\n",
+				nodeID, renderHash(n.hash), renderHash(n.path), renderHash(n.valueHash))
+		case renderInner:
+			fmt.Fprintf(&b, "\tn%d [shape=box, label=\"%s\"];\n", nodeID, renderHash(n.hash))
+		case renderCollapsed:
+			fmt.Fprintf(&b, "\tn%d [shape=box, style=dashed, label=\"%s\"];\n", nodeID, renderHash(n.hash))
+		}
+		for bit, child := range n.children {
+			if child != nil {
+				childID := visit(child)
+				fmt.Fprintf(&b, "\tn%d -> n%d [label=\"%d\"];\n", nodeID, childID, bit)
+			}
+		}
+		return nodeID
+	}
+	visit(root)
+	b.WriteString("}\n")
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// RenderASCII writes the tree at its current root as an indented diagram, with
+// a node per line, and the left (0) child of an inner node before its right (1)
+// child. Nodes are labelled as with RenderDOT, and a non-nil key also
+// restricts the diagram to the path of the key.
+func (smt *SparseMerkleTree) RenderASCII(w io.Writer, key []byte) error {
+	root, err := smt.renderTree(key)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	var visit func(n *renderNode, prefix, indent string)
+	visit = func(n *renderNode, prefix, indent string) {
+		b.WriteString(prefix)
+		switch n.kind {
+		case renderPlaceholder:
+			b.WriteString("empty\n")
+		case renderLeaf:
+			fmt.Fprintf(&b, "leaf %s path %s value %s\n", renderHash(n.hash), renderHash(n.path), renderHash(n.valueHash))
+		case renderInner:
+			fmt.Fprintf(&b, "node %s\n", renderHash(n.hash))
+		case renderCollapsed:
+			fmt.Fprintf(&b, "node %s (collapsed)\n", renderHash(n.hash))
+		}
+		for bit, child := range n.children {
+			if child == nil {
+				continue
+			}
+			if bit == 0 {
+				visit(child, fmt.Sprintf("%s|-- 0: ", indent), indent+"|   ")
+			} else {
+				visit(child, fmt.Sprintf("%s`-- 1: ", indent), indent+"    ")
+			}
+		}
+	}
+	visit(root, "", "")
+
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// renderHash returns a truncated hash in hex.
+func renderHash(hash []byte) string {
+	if len(hash) <= renderHashSize {
+		return hex.EncodeToString(hash)
+	}
+	return hex.EncodeToString(hash[:renderHashSize]) + ".."
+}
+
+// renderTree reads the nodes to render, from the current root. With a non-nil
+// key, the inner nodes off the path of the key are not expanded.
+func (smt *SparseMerkleTree) renderTree(key []byte) (*renderNode, error) {
+	var path []byte
+	if key != nil {
+		var err error
+		if path, err = smt.th.path(key); err != nil {
+			return nil, err
+		}
+	}
+
+	var read func(hash []byte, depth int, onPath bool) (*renderNode, error)
+	read = func(hash []byte, depth int, onPath bool) (*renderNode, error) {
+		if bytes.Equal(hash, smt.th.placeholder()) {
+			return &renderNode{kind: renderPlaceholder}, nil
+		}
+		data, err := smt.nodes.Get(hash)
+		if err != nil {
+			return nil, err
+		}
+		if smt.th.isLeaf(data) {
+			leafPath, valueHash := smt.th.parseLeaf(data)
+			if smt.th.inlineValues {
+				valueHash = smt.th.digest(valueHash)
+			}
+			return &renderNode{kind: renderLeaf, hash: hash, path: leafPath, valueHash: valueHash}, nil
+		}
+		if !onPath {
+			return &renderNode{kind: renderCollapsed, hash: hash}, nil
+		}
+
+		n := &renderNode{kind: renderInner, hash: hash}
+		leftNode, rightNode := smt.th.parseNode(data)
+		for bit, child := range [][]byte{leftNode, rightNode} {
+			childOnPath := path == nil || getBitAtFromMSB(path, depth) == bit
+			if n.children[bit], err = read(child, depth+1, childOnPath); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	}
+	return read(smt.Root(), 0, true)
+}
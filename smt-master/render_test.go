@@ -0,0 +1,67 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), Depth(8), RawKeys())
+	var b bytes.Buffer
+	if err := smt.RenderASCII(&b, nil); err != nil || b.String() != "empty\n" {
+		t.Errorf("got rendering %q of an empty tree: %v", b.String(), err)
+	}
+
+	smt.Update([]byte{0x00}, []byte("a"))
+	smt.Update([]byte{0x40}, []byte("b"))
+	smt.Update([]byte{0x80}, []byte("c"))
+	smt.Delete([]byte{0x80})
+	// The root has a placeholder on the right, and an inner node with both
+	// leaves on the left.
+	leafA, _ := smt.th.digestLeaf([]byte{0x00}, smt.th.digest([]byte("a")))
+	leafB, _ := smt.th.digestLeaf([]byte{0x40}, smt.th.digest([]byte("b")))
+	inner, _ := smt.th.digestNode(leafA, leafB)
+	h := renderHash
+
+	b.Reset()
+	if err := smt.RenderASCII(&b, nil); err != nil {
+		t.Fatalf("returned error: %v", err)
+	}
+	want := fmt.Sprintf("node %s\n|-- 0: node %s\n|   |-- 0: leaf %s path 00 value %s\n|   `-- 1: leaf %s path 40 value %s\n`-- 1: empty\n",
+		h(smt.Root()), h(inner), h(leafA), h(smt.th.digest([]byte("a"))), h(leafB), h(smt.th.digest([]byte("b"))))
+	if b.String() != want {
+		t.Errorf("got rendering\n%s\nwant\n%s", b.String(), want)
+	}
+
+	// Off the path of a key, inner nodes are collapsed.
+	b.Reset()
+	if err := smt.RenderASCII(&b, []byte{0x80}); err != nil {
+		t.Fatalf("returned error: %v", err)
+	}
+	want = fmt.Sprintf("node %s\n|-- 0: node %s (collapsed)\n`-- 1: empty\n", h(smt.Root()), h(inner))
+	if b.String() != want {
+		t.Errorf("got rendering along a path\n%s\nwant\n%s", b.String(), want)
+	}
+
+	b.Reset()
+	if err := smt.RenderDOT(&b, nil); err != nil {
+		t.Fatalf("returned error: %v", err)
+	}
+	dot := b.String()
+	if !strings.HasPrefix(dot, "digraph smt {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("got invalid DOT rendering %q", dot)
+	}
+	if strings.Count(dot, " -> ") != 4 || strings.Count(dot, "shape=point") != 1 || strings.Count(dot, "shape=ellipse") != 2 {
+		t.Errorf("got DOT rendering with wrong nodes or edges:\n%s", dot)
+	}
+	if !strings.Contains(dot, fmt.Sprintf("label=\"leaf %s\\npath 40\\nvalue %s\"", h(leafB), h(smt.th.digest([]byte("b"))))) {
+		t.Errorf("DOT rendering is missing a leaf:\n%s", dot)
+	}
+
+	if err := smt.RenderDOT(&b, []byte("too long")); err == nil {
+		t.Error("did not return an error for an invalid key")
+	}
+}
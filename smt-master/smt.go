@@ -4,6 +4,7 @@ package smt
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"hash"
 )
 
@@ -14,11 +15,20 @@ const (
 var defaultValue = []byte{}
 var errKeyAlreadyEmpty = errors.New("key already empty")
 
+// ErrBadKeySize is returned for keys that are not the size of a path in trees
+// created with the RawKeys option.
+var ErrBadKeySize = errors.New("bad key size")
+
 // SparseMerkleTree is a Sparse Merkle tree.
 type SparseMerkleTree struct {
 	th            treeHasher
 	nodes, values MapStore
 	root          []byte
+
+	hasherID HasherID
+
+	persistRoot bool
+	version     uint64
 }
 
 // NewSparseMerkleTree creates a new Sparse Merkle tree on an empty MapStore.
@@ -28,10 +38,9 @@ func NewSparseMerkleTree(nodes, values MapStore, hasher hash.Hash, options ...Op
 		nodes:  nodes,
 		values: values,
 	}
+	smt.hasherID = smt.th.hasherID()
 
-	for _, option := range options {
-		option(&smt)
-	}
+	smt.applyOptions(options)
 
 	smt.SetRoot(smt.th.placeholder())
 
@@ -39,13 +48,16 @@ func NewSparseMerkleTree(nodes, values MapStore, hasher hash.Hash, options ...Op
 }
 
 // ImportSparseMerkleTree imports a Sparse Merkle tree from a non-empty MapStore.
-func ImportSparseMerkleTree(nodes, values MapStore, hasher hash.Hash, root []byte) *SparseMerkleTree {
+// The options must be the ones the tree was created with.
+func ImportSparseMerkleTree(nodes, values MapStore, hasher hash.Hash, root []byte, options ...Option) *SparseMerkleTree {
 	smt := SparseMerkleTree{
 		th:     *newTreeHasher(hasher),
 		nodes:  nodes,
 		values: values,
 		root:   root,
 	}
+	smt.hasherID = smt.th.hasherID()
+	smt.applyOptions(options)
 	return &smt
 }
 
@@ -59,12 +71,29 @@ func (smt *SparseMerkleTree) SetRoot(root []byte) {
 	smt.root = root
 }
 
+// HasherID returns the registry identifier of the hash function of the tree,
+// or HasherUnknown if it is not in the registry.
+func (smt *SparseMerkleTree) HasherID() HasherID {
+	return smt.hasherID
+}
+
+// KeysArePaths returns whether the tree uses its keys as paths, with the
+// RawKeys option.
+func (smt *SparseMerkleTree) KeysArePaths() bool {
+	return smt.th.rawKeys
+}
+
 func (smt *SparseMerkleTree) depth() int {
 	return smt.th.pathSize() * 8
 }
 
 // Get gets the value of a key from the tree.
 func (smt *SparseMerkleTree) Get(key []byte) ([]byte, error) {
+	path, err := smt.th.path(key)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get tree's root
 	root := smt.Root()
 
@@ -73,7 +102,11 @@ func (smt *SparseMerkleTree) Get(key []byte) ([]byte, error) {
 		return defaultValue, nil
 	}
 
-	path := smt.th.path(key)
+	if smt.th.inlineValues {
+		// There is no values store; the value is in the leaf.
+		return smt.GetDescend(key)
+	}
+
 	value, err := smt.values.Get(path)
 
 	if err != nil {
@@ -104,6 +137,11 @@ func (smt *SparseMerkleTree) Update(key []byte, value []byte) ([]byte, error) {
 		return nil, err
 	}
 	smt.SetRoot(newRoot)
+	if smt.persistRoot {
+		if err := smt.CommitRoot(); err != nil {
+			return nil, err
+		}
+	}
 	return newRoot, nil
 }
 
@@ -114,7 +152,16 @@ func (smt *SparseMerkleTree) Delete(key []byte) ([]byte, error) {
 
 // UpdateForRoot sets a new value for a key in the tree at a specific root, and returns the new root.
 func (smt *SparseMerkleTree) UpdateForRoot(key []byte, value []byte, root []byte) ([]byte, error) {
-	path := smt.th.path(key)
+	path, err := smt.th.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return smt.updateForPath(path, value, root)
+}
+
+// updateForPath sets a new value for a path in the tree at a specific root, and
+// returns the new root.
+func (smt *SparseMerkleTree) updateForPath(path []byte, value []byte, root []byte) ([]byte, error) {
 	sideNodes, pathNodes, oldLeafData, _, err := smt.sideNodesForRoot(path, root, false)
 	if err != nil {
 		return nil, err
@@ -128,7 +175,10 @@ func (smt *SparseMerkleTree) UpdateForRoot(key []byte, value []byte, root []byte
 			// This key is already empty; return the old root.
 			return root, nil
 		}
-		if err := smt.values.Delete(path); err != nil {
+		if err != nil {
+			return nil, err
+		}
+		if err := smt.deleteValue(path); err != nil {
 			return nil, err
 		}
 
@@ -144,6 +194,43 @@ func (smt *SparseMerkleTree) DeleteForRoot(key, root []byte) ([]byte, error) {
 	return smt.UpdateForRoot(key, defaultValue, root)
 }
 
+// UpdateBatch sets new values for several keys in the tree, deleting the keys
+// whose values are empty, and sets and returns the new root of the tree. The
+// updates are staged in memory and written to the stores at once, so that the
+// nodes created and orphaned within the batch are never written, and the
+// stores are left unchanged if an update fails.
+func (smt *SparseMerkleTree) UpdateBatch(keys [][]byte, values [][]byte) ([]byte, error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("got %d keys and %d values", len(keys), len(values))
+	}
+	nodes, valueStore := newCountingOverlayMapStore(smt.nodes), NewOverlayMapStore(smt.values)
+	staged := *smt
+	staged.nodes = nodes
+	staged.values = valueStore
+
+	root := smt.Root()
+	for i := range keys {
+		var err error
+		if root, err = staged.UpdateForRoot(keys[i], values[i], root); err != nil {
+			return nil, err
+		}
+	}
+	if err := nodes.Flush(); err != nil {
+		return nil, err
+	}
+	if err := valueStore.Flush(); err != nil {
+		return nil, err
+	}
+
+	smt.SetRoot(root)
+	if smt.persistRoot {
+		if err := smt.CommitRoot(); err != nil {
+			return nil, err
+		}
+	}
+	return root, nil
+}
+
 func (smt *SparseMerkleTree) deleteWithSideNodes(path []byte, sideNodes [][]byte, pathNodes [][]byte, oldLeafData []byte) ([]byte, error) {
 	if bytes.Equal(pathNodes[0], smt.th.placeholder()) {
 		// This key is already empty as it is a placeholder; return an error.
@@ -211,12 +298,7 @@ func (smt *SparseMerkleTree) deleteWithSideNodes(path []byte, sideNodes [][]byte
 }
 
 func (smt *SparseMerkleTree) updateWithSideNodes(path []byte, value []byte, sideNodes [][]byte, pathNodes [][]byte, oldLeafData []byte) ([]byte, error) {
-	valueHash := smt.th.digest(value)
-	currentHash, currentData := smt.th.digestLeaf(path, valueHash)
-	if err := smt.nodes.Set(currentHash, currentData); err != nil {
-		return nil, err
-	}
-	currentData = currentHash
+	valueData := smt.th.valueData(value)
 
 	// If the leaf node that sibling nodes lead to has a different actual path
 	// than the leaf node being updated, we need to create an intermediate node
@@ -225,14 +307,27 @@ func (smt *SparseMerkleTree) updateWithSideNodes(path []byte, value []byte, side
 	// First, get the number of bits that the paths of the two leaf nodes share
 	// in common as a prefix.
 	var commonPrefixCount int
-	var oldValueHash []byte
+	var oldValueData []byte
 	if bytes.Equal(pathNodes[0], smt.th.placeholder()) {
 		commonPrefixCount = smt.depth()
 	} else {
 		var actualPath []byte
-		actualPath, oldValueHash = smt.th.parseLeaf(oldLeafData)
+		actualPath, oldValueData = smt.th.parseLeaf(oldLeafData)
 		commonPrefixCount = countCommonPrefix(path, actualPath)
 	}
+	// Short-circuit if the same value is being set. This happens before any
+	// node is written, so that every Set on the node store is matched by a
+	// Delete once the node is orphaned.
+	if commonPrefixCount == smt.depth() && oldValueData != nil && bytes.Equal(oldValueData, valueData) {
+		return pathNodes[len(pathNodes)-1], nil
+	}
+
+	currentHash, currentData := smt.th.digestLeaf(path, valueData)
+	if err := smt.nodes.Set(currentHash, currentData); err != nil {
+		return nil, err
+	}
+	currentData = currentHash
+
 	if commonPrefixCount != smt.depth() {
 		if getBitAtFromMSB(path, commonPrefixCount) == right {
 			currentHash, currentData = smt.th.digestNode(pathNodes[0], currentData)
@@ -246,16 +341,12 @@ func (smt *SparseMerkleTree) updateWithSideNodes(path []byte, value []byte, side
 		}
 
 		currentData = currentHash
-	} else if oldValueHash != nil {
-		// Short-circuit if the same value is being set
-		if bytes.Equal(oldValueHash, valueHash) {
-			return smt.root, nil
-		}
+	} else if oldValueData != nil {
 		// If an old leaf exists, remove it
 		if err := smt.nodes.Delete(pathNodes[0]); err != nil {
 			return nil, err
 		}
-		if err := smt.values.Delete(path); err != nil {
+		if err := smt.deleteValue(path); err != nil {
 			return nil, err
 		}
 	}
@@ -298,13 +389,56 @@ func (smt *SparseMerkleTree) updateWithSideNodes(path []byte, value []byte, side
 		}
 		currentData = currentHash
 	}
-	if err := smt.values.Set(path, value); err != nil {
+	if err := smt.setValue(path, value); err != nil {
 		return nil, err
 	}
 
 	return currentHash, nil
 }
 
+// setValue stores the value of a path in the values store, unless values are
+// inline.
+func (smt *SparseMerkleTree) setValue(path []byte, value []byte) error {
+	if smt.th.inlineValues {
+		return nil
+	}
+	return smt.values.Set(path, value)
+}
+
+// deleteValue deletes the value of a path from the values store, unless values
+// are inline.
+func (smt *SparseMerkleTree) deleteValue(path []byte) error {
+	if smt.th.inlineValues {
+		return nil
+	}
+	return smt.values.Delete(path)
+}
+
+// leafValue returns the value of the leaf with the given path and data.
+func (smt *SparseMerkleTree) leafValue(path []byte, leafData []byte) ([]byte, error) {
+	if smt.th.inlineValues {
+		_, value := smt.th.parseLeaf(leafData)
+		return value, nil
+	}
+	return smt.values.Get(path)
+}
+
+// SideNodesForRoot returns the path of a key and the sibling nodes (sidenodes)
+// along it from a given root, from the sibling of the leaf up to the sibling of
+// the child of the root, together with the hash of the leaf or placeholder the
+// path leads to and the data of the leaf, which is nil for a placeholder. It
+// is mainly useful for inspecting the structure of a tree.
+func (smt *SparseMerkleTree) SideNodesForRoot(key []byte, root []byte) (path []byte, sideNodes [][]byte, leafHash []byte, leafData []byte, err error) {
+	if path, err = smt.th.path(key); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	sideNodes, pathNodes, leafData, _, err := smt.sideNodesForRoot(path, root, false)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return path, sideNodes, pathNodes[0], leafData, nil
+}
+
 // Get all the sibling nodes (sidenodes) for a given path from a given root.
 // Returns an array of sibling nodes, the leaf hash found at that path, the
 // leaf data, and the sibling data.
@@ -405,7 +539,10 @@ func (smt *SparseMerkleTree) ProveUpdatableForRoot(key []byte, root []byte) (Spa
 }
 
 func (smt *SparseMerkleTree) doProveForRoot(key []byte, root []byte, isUpdatable bool) (SparseMerkleProof, error) {
-	path := smt.th.path(key)
+	path, err := smt.th.path(key)
+	if err != nil {
+		return SparseMerkleProof{}, err
+	}
 	sideNodes, pathNodes, leafData, siblingData, err := smt.sideNodesForRoot(path, root, isUpdatable)
 	if err != nil {
 		return SparseMerkleProof{}, err
@@ -434,6 +571,7 @@ func (smt *SparseMerkleTree) doProveForRoot(key []byte, root []byte, isUpdatable
 		SideNodes:             nonEmptySideNodes,
 		NonMembershipLeafData: nonMembershipLeafData,
 		SiblingData:           siblingData,
+		HasherID:              smt.hasherID,
 	}
 
 	return proof, err
@@ -451,6 +589,6 @@ func (smt *SparseMerkleTree) ProveCompactForRoot(key []byte, root []byte) (Spars
 	if err != nil {
 		return SparseCompactMerkleProof{}, err
 	}
-	compactedProof, err := CompactProof(proof, smt.th.hasher)
+	compactedProof, err := compactProof(proof, &smt.th)
 	return compactedProof, err
 }
@@ -614,3 +614,74 @@ func TestOrphanRemoval(t *testing.T) {
 		}
 	})
 }
+
+// Test the side nodes returned for inspecting the tree.
+func TestSideNodesForRoot(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+	smt.Update([]byte("testKey"), []byte("testValue"))
+	smt.Update([]byte("testKey2"), []byte("testValue2"))
+	smt.Update([]byte("foo"), []byte("bar"))
+
+	for _, key := range []string{"testKey", "absentKey"} {
+		path, sideNodes, leafHash, leafData, err := smt.SideNodesForRoot([]byte(key), smt.Root())
+		if err != nil {
+			t.Fatalf("returned error when getting side nodes: %v", err)
+		}
+		if !bytes.Equal(path, smt.th.digest([]byte(key))) {
+			t.Errorf("got path %x for key %q", path, key)
+		}
+		proof, _ := smt.Prove([]byte(key))
+		if len(sideNodes) != len(proof.SideNodes) {
+			t.Errorf("got %d side nodes for key %q, want %d", len(sideNodes), key, len(proof.SideNodes))
+		}
+		if leafData == nil {
+			if !bytes.Equal(leafHash, smt.th.placeholder()) {
+				t.Errorf("got leaf hash %x without leaf data", leafHash)
+			}
+		} else if !bytes.Equal(leafHash, smt.th.digest(leafData)) {
+			t.Errorf("leaf hash %x does not match leaf data", leafHash)
+		}
+	}
+}
+
+// Test updating several keys at once.
+func TestSparseMerkleTreeUpdateBatch(t *testing.T) {
+	smn, smv := NewSimpleMap(), NewSimpleMap()
+	smt := NewSparseMerkleTree(smn, smv, sha256.New())
+	expected := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+	smt.Update([]byte("testKey"), []byte("testValue"))
+	expected.Update([]byte("testKey"), []byte("testValue"))
+
+	keys := [][]byte{[]byte("foo"), []byte("testKey"), []byte("bar"), []byte("foo")}
+	values := [][]byte{[]byte("a"), defaultValue, []byte("b"), []byte("c")}
+	root, err := smt.UpdateBatch(keys, values)
+	if err != nil {
+		t.Fatalf("returned error when updating batch: %v", err)
+	}
+	for i := range keys {
+		expected.Update(keys[i], values[i])
+	}
+	if !bytes.Equal(root, expected.Root()) || !bytes.Equal(smt.Root(), root) {
+		t.Errorf("got root %x after batch, want %x", root, expected.Root())
+	}
+	// Only the nodes and values of the final tree are in the stores.
+	if len(smn.m) != 3 || len(smv.m) != 2 {
+		t.Errorf("got %d nodes and %d values in the stores, want 3 and 2", len(smn.m), len(smv.m))
+	}
+	if value, _ := smt.Get([]byte("foo")); !bytes.Equal(value, []byte("c")) {
+		t.Errorf("got value %q for updated key", value)
+	}
+
+	// A failing batch leaves the stores unchanged.
+	smt = NewSparseMerkleTree(smn, smv, sha256.New(), RawKeys())
+	smt.SetRoot(root)
+	if _, err := smt.UpdateBatch([][]byte{make([]byte, 32), []byte("short")}, [][]byte{[]byte("a"), []byte("b")}); err == nil {
+		t.Error("no error for batch with invalid key")
+	}
+	if len(smn.m) != 3 || len(smv.m) != 2 || !bytes.Equal(smt.Root(), root) {
+		t.Error("failing batch modified the tree")
+	}
+	if _, err := smt.UpdateBatch(keys, values[1:]); err == nil {
+		t.Error("no error for batch with missing values")
+	}
+}
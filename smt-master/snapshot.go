@@ -0,0 +1,319 @@
+package smt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// Snapshots hold the leaves of a tree, in the format:
+//
+//	magic     "SMTSNAP" and the format version, 1
+//	hasher    the registry identifier of the hash function, one byte
+//	depth     the depth of the tree in bits, as a uvarint
+//	flags     one byte, with bit 0 set for trees with raw keys and bit 1 for
+//	          trees with inline values
+//	prefixes  the leaf and node prefixes, each prefixed with its length as a
+//	          uvarint
+//	root      the root, prefixed with its length as a uvarint
+//	count     the number of leaves, as a uvarint
+//	leaves    for each leaf in ascending order of paths, its path and its
+//	          value prefixed with its length as a uvarint
+//	checksum  the SHA-256 digest of all the preceding bytes
+const snapshotMagic = "SMTSNAP\x01"
+
+// maxSnapshotRootSize bounds the size of the roots of snapshots, which is the
+// size of the largest digests.
+const maxSnapshotRootSize = 64
+
+// maxSnapshotPrefixSize bounds the size of the leaf and node prefixes of
+// snapshots.
+const maxSnapshotPrefixSize = 255
+
+// Flags of the layout of the tree of a snapshot.
+const (
+	snapshotRawKeys = 1 << iota
+	snapshotInlineValues
+)
+
+// maxSnapshotValueSize bounds the size of the values of snapshots, so that a
+// corrupt length cannot cause a large allocation.
+const maxSnapshotValueSize = 1 << 30
+
+// ErrBadSnapshot is returned when a snapshot is malformed or corrupt.
+var ErrBadSnapshot = errors.New("bad snapshot")
+
+// ErrSnapshotRootMismatch is returned when the leaves of a snapshot do not
+// hash to the root in its header.
+var ErrSnapshotRootMismatch = errors.New("snapshot leaves do not match its root")
+
+// ErrSnapshotLayoutMismatch is returned when a snapshot was taken from a tree
+// with other raw keys, inline values or prefix options than those it is
+// imported with.
+var ErrSnapshotLayoutMismatch = errors.New("snapshot was taken from a tree with another layout")
+
+// SnapshotHeader is the header of a snapshot.
+type SnapshotHeader struct {
+	HasherID     HasherID
+	Depth        int
+	RawKeys      bool
+	InlineValues bool
+	LeafPrefix   []byte
+	NodePrefix   []byte
+	Root         []byte
+	Leaves       uint64
+}
+
+// ExportSnapshot writes a snapshot of the tree at its current root to w. The
+// leaves are walked twice, to count them and then to write them.
+func (smt *SparseMerkleTree) ExportSnapshot(w io.Writer) error {
+	header := SnapshotHeader{
+		HasherID:     smt.hasherID,
+		Depth:        smt.depth(),
+		RawKeys:      smt.th.rawKeys,
+		InlineValues: smt.th.inlineValues,
+		LeafPrefix:   smt.th.leafPrefix,
+		NodePrefix:   smt.th.nodePrefix,
+		Root:         smt.Root(),
+	}
+	err := smt.IterateLeaves(func(path, value []byte) error {
+		header.Leaves++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	checksum := sha256.New()
+	out := io.MultiWriter(bw, checksum)
+	data := []byte(snapshotMagic)
+	data = append(data, byte(header.HasherID))
+	data = appendUvarint(data, uint64(header.Depth))
+	var flags byte
+	if header.RawKeys {
+		flags |= snapshotRawKeys
+	}
+	if header.InlineValues {
+		flags |= snapshotInlineValues
+	}
+	data = append(data, flags)
+	data = appendLengthPrefixed(data, header.LeafPrefix)
+	data = appendLengthPrefixed(data, header.NodePrefix)
+	data = appendLengthPrefixed(data, header.Root)
+	data = appendUvarint(data, header.Leaves)
+	if _, err := out.Write(data); err != nil {
+		return err
+	}
+
+	var written uint64
+	err = smt.IterateLeaves(func(path, value []byte) error {
+		written++
+		data = append(data[:0], path...)
+		data = appendLengthPrefixed(data, value)
+		_, err := out.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if written != header.Leaves {
+		return fmt.Errorf("tree changed during the snapshot: %d leaves, then %d", header.Leaves, written)
+	}
+	if _, err := bw.Write(checksum.Sum(nil)); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// snapshotReader reads a snapshot, hashing the bytes read.
+type snapshotReader struct {
+	r        *bufio.Reader
+	checksum hash.Hash
+}
+
+func (sr *snapshotReader) ReadByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err == nil {
+		sr.checksum.Write([]byte{b})
+	}
+	return b, err
+}
+
+func (sr *snapshotReader) read(n uint64) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := io.ReadFull(sr.r, data); err != nil {
+		return nil, err
+	}
+	sr.checksum.Write(data)
+	return data, nil
+}
+
+func (sr *snapshotReader) readUvarint() (uint64, error) {
+	return binary.ReadUvarint(sr)
+}
+
+func (sr *snapshotReader) readPrefix() ([]byte, error) {
+	size, err := sr.readUvarint()
+	if err != nil {
+		return nil, err
+	}
+	if size == 0 || size > maxSnapshotPrefixSize {
+		return nil, fmt.Errorf("invalid size %d", size)
+	}
+	return sr.read(size)
+}
+
+// badSnapshot returns an error wrapping ErrBadSnapshot for an error reading a
+// field of a snapshot.
+func badSnapshot(field string, err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("%w: %s: %v", ErrBadSnapshot, field, err)
+}
+
+func (sr *snapshotReader) readHeader() (*SnapshotHeader, error) {
+	magic, err := sr.read(uint64(len(snapshotMagic)))
+	if err != nil {
+		return nil, badSnapshot("magic", err)
+	}
+	if string(magic) != snapshotMagic {
+		return nil, fmt.Errorf("%w: not a snapshot, or an unsupported version", ErrBadSnapshot)
+	}
+	var header SnapshotHeader
+	id, err := sr.ReadByte()
+	if err != nil {
+		return nil, badSnapshot("hash function", err)
+	}
+	header.HasherID = HasherID(id)
+	depth, err := sr.readUvarint()
+	if err != nil || depth == 0 || depth%8 != 0 || depth > maxProofSideNodes {
+		return nil, badSnapshot("depth", fmt.Errorf("invalid depth %d: %v", depth, err))
+	}
+	header.Depth = int(depth)
+	flags, err := sr.ReadByte()
+	if err != nil || flags&^(snapshotRawKeys|snapshotInlineValues) != 0 {
+		return nil, badSnapshot("flags", fmt.Errorf("invalid flags %#x: %v", flags, err))
+	}
+	header.RawKeys = flags&snapshotRawKeys != 0
+	header.InlineValues = flags&snapshotInlineValues != 0
+	if header.LeafPrefix, err = sr.readPrefix(); err != nil {
+		return nil, badSnapshot("leaf prefix", err)
+	}
+	if header.NodePrefix, err = sr.readPrefix(); err != nil {
+		return nil, badSnapshot("node prefix", err)
+	}
+	rootSize, err := sr.readUvarint()
+	if err != nil || rootSize > maxSnapshotRootSize {
+		return nil, badSnapshot("root", fmt.Errorf("invalid size %d: %v", rootSize, err))
+	}
+	if header.Root, err = sr.read(rootSize); err != nil {
+		return nil, badSnapshot("root", err)
+	}
+	if header.Leaves, err = sr.readUvarint(); err != nil {
+		return nil, badSnapshot("leaf count", err)
+	}
+	return &header, nil
+}
+
+// ReadSnapshotHeader reads the header of a snapshot.
+func ReadSnapshotHeader(r io.Reader) (*SnapshotHeader, error) {
+	sr := &snapshotReader{r: bufio.NewReader(r), checksum: sha256.New()}
+	return sr.readHeader()
+}
+
+// ImportSnapshot reads a snapshot and rebuilds its tree on the given MapStores,
+// which should be empty, with the given options; with PersistRoot, the root is
+// committed to the node store. If hasher is nil, the hash function is looked
+// up in the registry by the identifier in the snapshot.
+//
+// The nodes are built bottom-up while the leaves are read. The snapshot is
+// refused if it is corrupt, with ErrBadSnapshot, if it was taken with a
+// different hash function, with ErrHasherMismatch, or from a tree of a
+// different depth, with ErrDepthMismatch, or with other raw keys, inline
+// values or prefix options, with ErrSnapshotLayoutMismatch, and if its leaves
+// do not hash to its root, with ErrSnapshotRootMismatch. The stores hold
+// partial contents after an error, and should be discarded.
+func ImportSnapshot(r io.Reader, nodes, values MapStore, hasher hash.Hash, options ...Option) (*SparseMerkleTree, error) {
+	sr := &snapshotReader{r: bufio.NewReader(r), checksum: sha256.New()}
+	header, err := sr.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if hasher == nil {
+		if hasher, err = header.HasherID.New(); err != nil {
+			return nil, err
+		}
+	}
+	smt := NewSparseMerkleTree(nodes, values, hasher, options...)
+	if header.HasherID != HasherUnknown && smt.hasherID != HasherUnknown && header.HasherID != smt.hasherID {
+		return nil, ErrHasherMismatch
+	}
+	if header.Depth != smt.depth() {
+		return nil, ErrDepthMismatch
+	}
+	if header.RawKeys != smt.th.rawKeys || header.InlineValues != smt.th.inlineValues ||
+		!bytes.Equal(header.LeafPrefix, smt.th.leafPrefix) || !bytes.Equal(header.NodePrefix, smt.th.nodePrefix) {
+		return nil, ErrSnapshotLayoutMismatch
+	}
+
+	b := treeBuilder{smt: smt}
+	for i := uint64(0); i < header.Leaves; i++ {
+		path, err := sr.read(uint64(smt.th.pathSize()))
+		if err != nil {
+			return nil, badSnapshot(fmt.Sprintf("leaf %d", i), err)
+		}
+		size, err := sr.readUvarint()
+		if err != nil || size > maxSnapshotValueSize {
+			return nil, badSnapshot(fmt.Sprintf("leaf %d", i), fmt.Errorf("invalid value size %d: %v", size, err))
+		}
+		value, err := sr.read(size)
+		if err != nil {
+			return nil, badSnapshot(fmt.Sprintf("leaf %d", i), err)
+		}
+		if len(value) == 0 {
+			return nil, badSnapshot(fmt.Sprintf("leaf %d", i), errors.New("empty value"))
+		}
+		if err := smt.setValue(path, value); err != nil {
+			return nil, err
+		}
+		if err := b.add(path, smt.th.valueData(value)); err != nil {
+			return nil, badSnapshot(fmt.Sprintf("leaf %d", i), err)
+		}
+	}
+
+	checksum := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(sr.r, checksum); err != nil {
+		return nil, badSnapshot("checksum", err)
+	}
+	if !bytes.Equal(checksum, sr.checksum.Sum(nil)) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBadSnapshot)
+	}
+	if _, err := sr.r.ReadByte(); err != io.EOF {
+		if err == nil {
+			err = errors.New("trailing data after the checksum")
+		}
+		return nil, fmt.Errorf("%w: %v", ErrBadSnapshot, err)
+	}
+
+	root, err := b.finish()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(root, header.Root) {
+		return nil, fmt.Errorf("%w: got root %x, want %x", ErrSnapshotRootMismatch, root, header.Root)
+	}
+	smt.SetRoot(root)
+	if smt.persistRoot {
+		if err := smt.CommitRoot(); err != nil {
+			return nil, err
+		}
+	}
+	return smt, nil
+}
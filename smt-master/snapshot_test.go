@@ -0,0 +1,107 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"MPT_MOI/keccak"
+)
+
+func TestSnapshot(t *testing.T) {
+	for _, options := range [][]Option{nil, {InlineValues()}, {Depth(16), RawKeys()}} {
+		smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), options...)
+		for i := 0; i < 100; i++ {
+			smt.Update([]byte{byte(i), byte(i)}, bytes.Repeat([]byte{byte(i)}, i+1))
+		}
+		var buf bytes.Buffer
+		if err := smt.ExportSnapshot(&buf); err != nil {
+			t.Fatalf("export returned error: %v", err)
+		}
+		snapshot := buf.Bytes()
+
+		header, err := ReadSnapshotHeader(bytes.NewReader(snapshot))
+		if err != nil || header.HasherID != SHA256 || header.Depth != smt.depth() ||
+			header.RawKeys != smt.th.rawKeys || header.InlineValues != smt.th.inlineValues || !bytes.Equal(header.Root, smt.Root()) || header.Leaves != 100 {
+			t.Errorf("got header %+v: %v", header, err)
+		}
+
+		nodes, values := NewSimpleMap(), NewSimpleMap()
+		imported, err := ImportSnapshot(bytes.NewReader(snapshot), nodes, values, nil, append(options, PersistRoot())...)
+		if err != nil {
+			t.Fatalf("import returned error: %v", err)
+		}
+		if !bytes.Equal(imported.Root(), smt.Root()) {
+			t.Errorf("got root %x after import, want %x", imported.Root(), smt.Root())
+		}
+		if value, err := imported.Get([]byte{7, 7}); err != nil || !bytes.Equal(value, bytes.Repeat([]byte{7}, 8)) {
+			t.Errorf("got value %x after import: %v", value, err)
+		}
+		if report, err := imported.Check(); err != nil || !report.OK() {
+			t.Errorf("imported tree has problems %v: %v", report.Problems, err)
+		}
+		if reopened, err := OpenSparseMerkleTree(nodes, values, nil, options...); err != nil || !bytes.Equal(reopened.Root(), smt.Root()) {
+			t.Errorf("root not committed after import: %v", err)
+		}
+	}
+}
+
+func TestSnapshotRefused(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+	smt.Update([]byte("foo"), []byte("bar"))
+	smt.Update([]byte("baz"), []byte("qux"))
+	var buf bytes.Buffer
+	smt.ExportSnapshot(&buf)
+	snapshot := buf.Bytes()
+	importSnapshot := func(snapshot []byte, options ...Option) error {
+		_, err := ImportSnapshot(bytes.NewReader(snapshot), NewSimpleMap(), NewSimpleMap(), nil, options...)
+		return err
+	}
+
+	for _, options := range [][]Option{{LeafPrefix([]byte{2})}, {NodePrefix([]byte{2})}, {InlineValues()}, {RawKeys()}} {
+		if err := importSnapshot(snapshot, options...); err != ErrSnapshotLayoutMismatch {
+			t.Errorf("got error %v for other options, want %v", err, ErrSnapshotLayoutMismatch)
+		}
+	}
+	if err := importSnapshot(snapshot, Depth(128), RawKeys()); err != ErrDepthMismatch {
+		t.Errorf("got error %v for another depth, want %v", err, ErrDepthMismatch)
+	}
+	if _, err := ImportSnapshot(bytes.NewReader(snapshot), NewSimpleMap(), NewSimpleMap(), keccak.NewLegacyKeccak256()); err != ErrHasherMismatch {
+		t.Errorf("got error %v for another hash function, want %v", err, ErrHasherMismatch)
+	}
+
+	// A root that does not match the leaves, with a valid checksum.
+	forged := append([]byte(nil), snapshot[:len(snapshot)-sha256.Size]...)
+	// The magic is followed by the hasher, the depth of 256 in two bytes, the
+	// flags, the two length-prefixed one-byte prefixes and the size of the
+	// root.
+	rootOffset := len(snapshotMagic) + 9
+	forged[rootOffset] ^= 1
+	checksum := sha256.Sum256(forged)
+	if err := importSnapshot(append(forged, checksum[:]...)); !errors.Is(err, ErrSnapshotRootMismatch) {
+		t.Errorf("got error %v for a forged root, want %v", err, ErrSnapshotRootMismatch)
+	}
+
+	corrupt := func(name string, snapshot []byte) {
+		if err := importSnapshot(snapshot); !errors.Is(err, ErrBadSnapshot) {
+			t.Errorf("%s: got error %v, want %v", name, err, ErrBadSnapshot)
+		}
+	}
+	corrupt("empty", nil)
+	corrupt("truncated", snapshot[:len(snapshot)-1])
+	corrupt("truncated leaves", snapshot[:len(snapshot)-sha256.Size-2])
+	flipped := append([]byte(nil), snapshot...)
+	flipped[len(flipped)-sha256.Size-1] ^= 1
+	corrupt("corrupt value", flipped)
+	corrupt("trailing data", append(append([]byte(nil), snapshot...), 0))
+	corrupt("bad magic", append([]byte("SMTSNAP\x02"), snapshot[len(snapshotMagic):]...))
+
+	// Leaves out of order are refused, even with a valid checksum.
+	headerSize := rootOffset + sha256.Size + 1
+	leaves := snapshot[headerSize : len(snapshot)-sha256.Size]
+	// Both leaves have 32-byte paths and 3-byte values.
+	swapped := append(append(append([]byte(nil), snapshot[:headerSize]...), leaves[36:]...), leaves[:36]...)
+	checksum = sha256.Sum256(swapped)
+	corrupt("unsorted leaves", append(swapped, checksum[:]...))
+}
@@ -0,0 +1,147 @@
+package smt
+
+import "bytes"
+
+// TreeStats describes the shape and the costs of a tree.
+type TreeStats struct {
+	// Leaves and InnerNodes are the numbers of leaves and inner nodes.
+	Leaves     int
+	InnerNodes int
+
+	// PlaceholderSiblings is the number of placeholder children of inner
+	// nodes, each the sibling of a non-empty subtree.
+	PlaceholderSiblings int
+
+	// LeafDepths is the histogram of the depths of the leaves: LeafDepths[d]
+	// is the number of leaves at depth d.
+	LeafDepths []int
+
+	// AvgProofLength and MaxProofLength are the average and maximum numbers
+	// of side nodes of the membership proofs of the leaves, which are their
+	// depths, and AvgPlaceholderSideNodes the average number of those side
+	// nodes that are placeholders.
+	AvgProofLength          float64
+	MaxProofLength          int
+	AvgPlaceholderSideNodes float64
+
+	// AvgCompactProofSize and MaxCompactProofSize are the average and maximum
+	// sizes in bytes of the encoded compact membership proofs of the leaves.
+	AvgCompactProofSize float64
+	MaxCompactProofSize int
+
+	// NodeBytes is the total size of the keys and data of the nodes, and
+	// ValueBytes the total size of the paths and values in the values store,
+	// which is zero with inline values. The overhead of the stores is not
+	// included.
+	NodeBytes  int
+	ValueBytes int
+}
+
+// Stats walks the tree at its current root and returns its statistics.
+func (smt *SparseMerkleTree) Stats() (*TreeStats, error) {
+	stats := &TreeStats{}
+	compactSizes := make(map[[2]int]int)
+	var proofLengths, placeholderSideNodes, compactProofSizes int
+
+	type position struct {
+		hash  []byte
+		depth int
+		// placeholders is the number of placeholder side nodes above the
+		// node.
+		placeholders int
+	}
+	stack := []position{{hash: smt.Root()}}
+	if bytes.Equal(smt.Root(), smt.th.placeholder()) {
+		stack = nil
+	}
+	for len(stack) > 0 {
+		pos := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		data, err := smt.nodes.Get(pos.hash)
+		if err != nil {
+			return nil, err
+		}
+		stats.NodeBytes += len(pos.hash) + len(data)
+
+		if smt.th.isLeaf(data) {
+			stats.Leaves++
+			for len(stats.LeafDepths) <= pos.depth {
+				stats.LeafDepths = append(stats.LeafDepths, 0)
+			}
+			stats.LeafDepths[pos.depth]++
+			proofLengths += pos.depth
+			if pos.depth > stats.MaxProofLength {
+				stats.MaxProofLength = pos.depth
+			}
+			placeholderSideNodes += pos.placeholders
+
+			shape := [2]int{pos.depth, pos.placeholders}
+			size, ok := compactSizes[shape]
+			if !ok {
+				if size, err = smt.compactProofSize(pos.depth, pos.placeholders); err != nil {
+					return nil, err
+				}
+				compactSizes[shape] = size
+			}
+			compactProofSizes += size
+			if size > stats.MaxCompactProofSize {
+				stats.MaxCompactProofSize = size
+			}
+
+			if !smt.th.inlineValues {
+				path, _ := smt.th.parseLeaf(data)
+				value, err := smt.values.Get(path)
+				if err != nil {
+					return nil, err
+				}
+				stats.ValueBytes += len(path) + len(value)
+			}
+			continue
+		}
+
+		stats.InnerNodes++
+		leftNode, rightNode := smt.th.parseNode(data)
+		leftEmpty, rightEmpty := bytes.Equal(leftNode, smt.th.placeholder()), bytes.Equal(rightNode, smt.th.placeholder())
+		if !rightEmpty {
+			stack = append(stack, position{hash: rightNode, depth: pos.depth + 1, placeholders: pos.placeholders + boolToInt(leftEmpty)})
+		} else {
+			stats.PlaceholderSiblings++
+		}
+		if !leftEmpty {
+			stack = append(stack, position{hash: leftNode, depth: pos.depth + 1, placeholders: pos.placeholders + boolToInt(rightEmpty)})
+		} else {
+			stats.PlaceholderSiblings++
+		}
+	}
+
+	if stats.Leaves > 0 {
+		stats.AvgProofLength = float64(proofLengths) / float64(stats.Leaves)
+		stats.AvgPlaceholderSideNodes = float64(placeholderSideNodes) / float64(stats.Leaves)
+		stats.AvgCompactProofSize = float64(compactProofSizes) / float64(stats.Leaves)
+	}
+	return stats, nil
+}
+
+// compactProofSize returns the size of the encoded compact membership proof of
+// a leaf, given the number of its side nodes and of those that are
+// placeholders.
+func (smt *SparseMerkleTree) compactProofSize(sideNodes, placeholders int) (int, error) {
+	sideNode := make([]byte, smt.th.hasher.Size())
+	proof := SparseCompactMerkleProof{
+		BitMask:      make([]byte, (sideNodes+7)/8),
+		NumSideNodes: sideNodes,
+		HasherID:     smt.hasherID,
+	}
+	for i := 0; i < sideNodes-placeholders; i++ {
+		proof.SideNodes = append(proof.SideNodes, sideNode)
+	}
+	data, err := proof.MarshalBinary()
+	return len(data), err
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package smt
+
+import (
+	"crypto/sha256"
+	"math"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	smt := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New(), RawKeys())
+	stats, err := smt.Stats()
+	if err != nil || stats.Leaves != 0 || stats.InnerNodes != 0 || stats.NodeBytes != 0 {
+		t.Errorf("got stats %+v for an empty tree: %v", stats, err)
+	}
+
+	var keys [][]byte
+	for i := 0; i < 100; i++ {
+		key := sha256.Sum256([]byte{byte(i)})
+		keys = append(keys, key[:])
+		smt.Update(key[:], []byte{byte(i)})
+	}
+	stats, err = smt.Stats()
+	if err != nil {
+		t.Fatalf("returned error: %v", err)
+	}
+
+	// Compare with the proofs of the leaves.
+	var depths []int
+	var proofLengths, placeholders, compactSizes, maxCompactSize int
+	for _, key := range keys {
+		proof, _ := smt.Prove(key)
+		compactProof, _ := smt.ProveCompact(key)
+		data, _ := compactProof.MarshalBinary()
+		for len(depths) <= len(proof.SideNodes) {
+			depths = append(depths, 0)
+		}
+		depths[len(proof.SideNodes)]++
+		proofLengths += len(proof.SideNodes)
+		placeholders += compactProof.NumSideNodes - len(compactProof.SideNodes)
+		compactSizes += len(data)
+		if len(data) > maxCompactSize {
+			maxCompactSize = len(data)
+		}
+	}
+	if stats.Leaves != 100 || len(stats.LeafDepths) != len(depths) {
+		t.Fatalf("got %d leaves and depths %v, want 100 and %v", stats.Leaves, stats.LeafDepths, depths)
+	}
+	for d := range depths {
+		if stats.LeafDepths[d] != depths[d] {
+			t.Errorf("got %d leaves at depth %d, want %d", stats.LeafDepths[d], d, depths[d])
+		}
+	}
+	if stats.MaxProofLength != len(depths)-1 || math.Abs(stats.AvgProofLength-float64(proofLengths)/100) > 1e-9 {
+		t.Errorf("got proof lengths avg %v max %d, want avg %v max %d", stats.AvgProofLength, stats.MaxProofLength, float64(proofLengths)/100, len(depths)-1)
+	}
+	if math.Abs(stats.AvgPlaceholderSideNodes-float64(placeholders)/100) > 1e-9 {
+		t.Errorf("got %v placeholder side nodes on average, want %v", stats.AvgPlaceholderSideNodes, float64(placeholders)/100)
+	}
+	if stats.MaxCompactProofSize != maxCompactSize || math.Abs(stats.AvgCompactProofSize-float64(compactSizes)/100) > 1e-9 {
+		t.Errorf("got compact proof sizes avg %v max %d, want avg %v max %d", stats.AvgCompactProofSize, stats.MaxCompactProofSize, float64(compactSizes)/100, maxCompactSize)
+	}
+
+	// Every inner node has two children, and there are as many nodes in the
+	// store as leaves and inner nodes.
+	nodes := smt.nodes.(*SimpleMap)
+	if len(nodes.m) != stats.Leaves+stats.InnerNodes {
+		t.Errorf("got %d leaves and %d inner nodes, but %d nodes in the store", stats.Leaves, stats.InnerNodes, len(nodes.m))
+	}
+	if 2*stats.InnerNodes != stats.Leaves+stats.InnerNodes-1+stats.PlaceholderSiblings {
+		t.Errorf("got %d inner nodes for %d children and %d placeholder siblings", stats.InnerNodes, stats.Leaves+stats.InnerNodes-1, stats.PlaceholderSiblings)
+	}
+	nodeBytes := 0
+	for key, data := range nodes.m {
+		nodeBytes += len(key) + len(data)
+	}
+	if stats.NodeBytes != nodeBytes || stats.ValueBytes != 100*(32+1) {
+		t.Errorf("got %d node bytes and %d value bytes, want %d and %d", stats.NodeBytes, stats.ValueBytes, nodeBytes, 100*33)
+	}
+
+	inline := NewSparseMerkleTree(NewSimpleMap(), nil, sha256.New(), InlineValues())
+	inline.Update([]byte("foo"), []byte("bar"))
+	if stats, err := inline.Stats(); err != nil || stats.Leaves != 1 || stats.ValueBytes != 0 || stats.LeafDepths[0] != 1 {
+		t.Errorf("got stats %+v for a tree with inline values: %v", stats, err)
+	}
+}
@@ -2,20 +2,35 @@ package smt
 
 import (
 	"bytes"
+	"fmt"
 	"hash"
 )
 
-var leafPrefix = []byte{0}
-var nodePrefix = []byte{1}
+var defaultLeafPrefix = []byte{0}
+var defaultNodePrefix = []byte{1}
 
 type treeHasher struct {
-	hasher    hash.Hash
-	zeroValue []byte
+	hasher     hash.Hash
+	zeroValue  []byte
+	leafPrefix []byte
+	nodePrefix []byte
+	rawKeys    bool
+
+	inlineValues bool
+
+	// depth is the number of bits of paths, which is the size of a digest
+	// unless set by the Depth option.
+	depth int
 }
 
 func newTreeHasher(hasher hash.Hash) *treeHasher {
-	th := treeHasher{hasher: hasher}
-	th.zeroValue = make([]byte, th.pathSize())
+	th := treeHasher{
+		hasher:     hasher,
+		leafPrefix: defaultLeafPrefix,
+		nodePrefix: defaultNodePrefix,
+		depth:      hasher.Size() * 8,
+	}
+	th.zeroValue = make([]byte, hasher.Size())
 
 	return &th
 }
@@ -27,13 +42,40 @@ func (th *treeHasher) digest(data []byte) []byte {
 	return sum
 }
 
-func (th *treeHasher) path(key []byte) []byte {
-	return th.digest(key)
+// path returns the path of a key in the tree: the digest of the key truncated
+// to the size of a path, or with the RawKeys option the key itself, which must
+// then be a full path.
+func (th *treeHasher) path(key []byte) ([]byte, error) {
+	if !th.rawKeys {
+		return th.digest(key)[:th.pathSize()], nil
+	}
+	if len(key) != th.pathSize() {
+		return nil, fmt.Errorf("%w: got %d bytes, want %d", ErrBadKeySize, len(key), th.pathSize())
+	}
+	return key, nil
+}
+
+// valueData returns the data stored in a leaf for a value: the digest of the
+// value, or with the InlineValues option the value itself.
+func (th *treeHasher) valueData(value []byte) []byte {
+	if th.inlineValues {
+		return value
+	}
+	return th.digest(value)
+}
+
+// leafSizeValid reports whether data is the size of the data of a leaf.
+func (th *treeHasher) leafSizeValid(data []byte) bool {
+	size := len(th.leafPrefix) + th.pathSize()
+	if th.inlineValues {
+		return len(data) >= size
+	}
+	return len(data) == size+th.hasher.Size()
 }
 
 func (th *treeHasher) digestLeaf(path []byte, leafData []byte) ([]byte, []byte) {
-	value := make([]byte, 0, len(leafPrefix)+len(path)+len(leafData))
-	value = append(value, leafPrefix...)
+	value := make([]byte, 0, len(th.leafPrefix)+len(path)+len(leafData))
+	value = append(value, th.leafPrefix...)
 	value = append(value, path...)
 	value = append(value, leafData...)
 
@@ -45,16 +87,16 @@ func (th *treeHasher) digestLeaf(path []byte, leafData []byte) ([]byte, []byte)
 }
 
 func (th *treeHasher) parseLeaf(data []byte) ([]byte, []byte) {
-	return data[len(leafPrefix) : th.pathSize()+len(leafPrefix)], data[len(leafPrefix)+th.pathSize():]
+	return data[len(th.leafPrefix) : th.pathSize()+len(th.leafPrefix)], data[len(th.leafPrefix)+th.pathSize():]
 }
 
 func (th *treeHasher) isLeaf(data []byte) bool {
-	return bytes.Equal(data[:len(leafPrefix)], leafPrefix)
+	return bytes.Equal(data[:len(th.leafPrefix)], th.leafPrefix)
 }
 
 func (th *treeHasher) digestNode(leftData []byte, rightData []byte) ([]byte, []byte) {
-	value := make([]byte, 0, len(nodePrefix)+len(leftData)+len(rightData))
-	value = append(value, nodePrefix...)
+	value := make([]byte, 0, len(th.nodePrefix)+len(leftData)+len(rightData))
+	value = append(value, th.nodePrefix...)
 	value = append(value, leftData...)
 	value = append(value, rightData...)
 
@@ -66,11 +108,11 @@ func (th *treeHasher) digestNode(leftData []byte, rightData []byte) ([]byte, []b
 }
 
 func (th *treeHasher) parseNode(data []byte) ([]byte, []byte) {
-	return data[len(nodePrefix) : th.pathSize()+len(nodePrefix)], data[len(nodePrefix)+th.pathSize():]
+	return data[len(th.nodePrefix) : th.hasher.Size()+len(th.nodePrefix)], data[len(th.nodePrefix)+th.hasher.Size():]
 }
 
 func (th *treeHasher) pathSize() int {
-	return th.hasher.Size()
+	return th.depth / 8
 }
 
 func (th *treeHasher) placeholder() []byte {
@@ -79,3 +121,35 @@ func (th *treeHasher) placeholder() []byte {
 func (th *treeHasher) nullLeaf() []byte {
 	return th.digest(th.zeroValue)
 }
+
+// checkPrefixes checks that leaf and node data can be told apart by their
+// prefixes.
+func (th *treeHasher) checkPrefixes() error {
+	if bytes.HasPrefix(th.leafPrefix, th.nodePrefix) || bytes.HasPrefix(th.nodePrefix, th.leafPrefix) {
+		return fmt.Errorf("leaf prefix %x and node prefix %x are ambiguous", th.leafPrefix, th.nodePrefix)
+	}
+	return nil
+}
+
+// checkDepth checks that the depth of the tree is a positive number of bytes
+// no longer than a digest, and that trees shorter than a digest have raw keys.
+func (th *treeHasher) checkDepth() error {
+	if th.depth <= 0 || th.depth%8 != 0 || th.depth > th.hasher.Size()*8 {
+		return fmt.Errorf("depth %d is not a multiple of 8 between 8 and %d", th.depth, th.hasher.Size()*8)
+	}
+	if th.depth < th.hasher.Size()*8 && !th.rawKeys {
+		return fmt.Errorf("depth %d is shorter than a digest, which requires raw keys", th.depth)
+	}
+	return nil
+}
+
+// hasherID identifies the hash function used by the tree hasher in the
+// registry.
+func (th *treeHasher) hasherID() HasherID {
+	return identifyFingerprint(th.fingerprint())
+}
+
+// fingerprint identifies the hash function used by the tree hasher.
+func (th *treeHasher) fingerprint() []byte {
+	return th.digest(hasherFingerprintData)
+}
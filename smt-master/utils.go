@@ -1,5 +1,10 @@
 package smt
 
+import (
+	"encoding/binary"
+	"io"
+)
+
 // getBitAtFromMSB gets the bit at an offset from the most significant bit
 func getBitAtFromMSB(data []byte, position int) int {
 	if int(data[position/8])&(1<<(8-1-uint(position)%8)) > 0 {
@@ -49,3 +54,24 @@ func reverseByteSlices(slices [][]byte) [][]byte {
 
 	return slices
 }
+
+func appendUvarint(data []byte, x uint64) []byte {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return append(data, buf[:binary.PutUvarint(buf, x)]...)
+}
+
+func appendLengthPrefixed(data []byte, field []byte) []byte {
+	data = appendUvarint(data, uint64(len(field)))
+	return append(data, field...)
+}
+
+// readLengthPrefixed reads a field written by appendLengthPrefixed, returning
+// the field and the remaining data.
+func readLengthPrefixed(data []byte) ([]byte, []byte, error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || length > uint64(len(data)-n) {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	end := n + int(length)
+	return data[n:end:end], data[end:], nil
+}
@@ -0,0 +1,290 @@
+package smt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+)
+
+// WALRecordType is the type of a record in a WriteAheadLog.
+type WALRecordType byte
+
+const (
+	// WALUpdate records an update or deletion of a key, and the root it produced.
+	WALUpdate WALRecordType = iota + 1
+	// WALCheckpoint records a root whose nodes and values have been persisted
+	// by the stores, along with the orphaned nodes still to be removed.
+	WALCheckpoint
+	// WALBatch records the updates of a batch, applied together, and the
+	// root they produced.
+	WALBatch
+)
+
+// walHeaderSize is the size of the length and checksum preceding each record.
+const walHeaderSize = 8
+
+var walChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrBadWALRecord is returned when a write-ahead log record cannot be decoded.
+var ErrBadWALRecord = errors.New("bad write-ahead log record")
+
+// WALRecord is a record in a WriteAheadLog.
+type WALRecord struct {
+	Type WALRecordType
+
+	// Key and Value are the key and value of an update. A deletion is an
+	// update to the default (empty) value.
+	Key, Value []byte
+
+	// Keys and Values are the keys and values of the updates of a batch.
+	Keys, Values [][]byte
+
+	// Root is the root after an update or a batch, or the root of a
+	// checkpoint.
+	Root []byte
+
+	// Orphans are the keys of the nodes that were orphaned since the previous
+	// checkpoint, and are removed from the node store by a checkpoint.
+	Orphans [][]byte
+}
+
+func (record *WALRecord) marshal() []byte {
+	payload := []byte{byte(record.Type)}
+	switch record.Type {
+	case WALUpdate:
+		payload = appendLengthPrefixed(payload, record.Key)
+		payload = appendLengthPrefixed(payload, record.Value)
+		payload = appendLengthPrefixed(payload, record.Root)
+	case WALCheckpoint:
+		payload = appendLengthPrefixed(payload, record.Root)
+		payload = appendUvarint(payload, uint64(len(record.Orphans)))
+		for _, orphan := range record.Orphans {
+			payload = appendLengthPrefixed(payload, orphan)
+		}
+	case WALBatch:
+		payload = appendLengthPrefixed(payload, record.Root)
+		payload = appendUvarint(payload, uint64(len(record.Keys)))
+		for i := range record.Keys {
+			payload = appendLengthPrefixed(payload, record.Keys[i])
+			payload = appendLengthPrefixed(payload, record.Values[i])
+		}
+	}
+
+	data := make([]byte, walHeaderSize, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(data[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(data[4:8], crc32.Checksum(payload, walChecksumTable))
+	return append(data, payload...)
+}
+
+func (record *WALRecord) unmarshal(payload []byte) error {
+	if len(payload) == 0 {
+		return ErrBadWALRecord
+	}
+	record.Type = WALRecordType(payload[0])
+	r := payload[1:]
+	var err error
+	switch record.Type {
+	case WALUpdate:
+		if record.Key, r, err = readLengthPrefixed(r); err != nil {
+			return ErrBadWALRecord
+		}
+		if record.Value, r, err = readLengthPrefixed(r); err != nil {
+			return ErrBadWALRecord
+		}
+		if record.Root, r, err = readLengthPrefixed(r); err != nil {
+			return ErrBadWALRecord
+		}
+	case WALCheckpoint:
+		if record.Root, r, err = readLengthPrefixed(r); err != nil {
+			return ErrBadWALRecord
+		}
+		count, n := binary.Uvarint(r)
+		if n <= 0 || count > uint64(len(r)) {
+			return ErrBadWALRecord
+		}
+		r = r[n:]
+		record.Orphans = make([][]byte, count)
+		for i := range record.Orphans {
+			if record.Orphans[i], r, err = readLengthPrefixed(r); err != nil {
+				return ErrBadWALRecord
+			}
+		}
+	case WALBatch:
+		if record.Root, r, err = readLengthPrefixed(r); err != nil {
+			return ErrBadWALRecord
+		}
+		count, n := binary.Uvarint(r)
+		if n <= 0 || count > uint64(len(r)) {
+			return ErrBadWALRecord
+		}
+		r = r[n:]
+		record.Keys, record.Values = make([][]byte, count), make([][]byte, count)
+		for i := range record.Keys {
+			if record.Keys[i], r, err = readLengthPrefixed(r); err != nil {
+				return ErrBadWALRecord
+			}
+			if record.Values[i], r, err = readLengthPrefixed(r); err != nil {
+				return ErrBadWALRecord
+			}
+		}
+	default:
+		return ErrBadWALRecord
+	}
+	if len(r) != 0 {
+		return ErrBadWALRecord
+	}
+	return nil
+}
+
+// updates returns the keys and values of the updates of an update or a batch
+// record.
+func (record *WALRecord) updates() ([][]byte, [][]byte) {
+	if record.Type == WALBatch {
+		return record.Keys, record.Values
+	}
+	return [][]byte{record.Key}, [][]byte{record.Value}
+}
+
+// WriteAheadLog is an append-only file of checksummed WALRecords. Every
+// record is synced to disk before Append returns.
+type WriteAheadLog struct {
+	path string
+	file *os.File
+}
+
+// OpenWriteAheadLog opens the write-ahead log at path, creating it if it does
+// not exist.
+func OpenWriteAheadLog(path string) (*WriteAheadLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &WriteAheadLog{
+		path: path,
+		file: file,
+	}, nil
+}
+
+// Records reads all records in the log.
+//
+// A record that is cut short or fails its checksum is taken to be the result
+// of a crash while it was being appended: it and everything after it are
+// discarded and truncated from the log.
+func (wal *WriteAheadLog) Records() ([]WALRecord, error) {
+	data, err := os.ReadFile(wal.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []WALRecord
+	offset := 0
+	for offset+walHeaderSize <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[offset : offset+4]))
+		checksum := binary.BigEndian.Uint32(data[offset+4 : offset+8])
+		if length > len(data)-offset-walHeaderSize {
+			break
+		}
+		payload := data[offset+walHeaderSize : offset+walHeaderSize+length]
+		if crc32.Checksum(payload, walChecksumTable) != checksum {
+			break
+		}
+		var record WALRecord
+		if err := record.unmarshal(payload); err != nil {
+			break
+		}
+		records = append(records, record)
+		offset += walHeaderSize + length
+	}
+
+	if offset != len(data) {
+		if err := wal.file.Truncate(int64(offset)); err != nil {
+			return nil, err
+		}
+		if err := wal.file.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// Append appends a record to the log and syncs it to disk.
+func (wal *WriteAheadLog) Append(record WALRecord) error {
+	if _, err := wal.file.Write(record.marshal()); err != nil {
+		return err
+	}
+	return wal.file.Sync()
+}
+
+// reset atomically replaces the contents of the log with a single record.
+func (wal *WriteAheadLog) reset(record WALRecord) error {
+	tmpPath := wal.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(record.marshal()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, wal.path); err != nil {
+		return err
+	}
+	// Sync the directory, so that the rename itself is durable.
+	dir, err := os.Open(filepath.Dir(wal.path))
+	if err != nil {
+		return err
+	}
+	err = dir.Sync()
+	if closeErr := dir.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(wal.path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	wal.file.Close()
+	wal.file = file
+	return nil
+}
+
+// Size returns the size of the log in bytes.
+func (wal *WriteAheadLog) Size() (int64, error) {
+	info, err := wal.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// Close closes the log.
+func (wal *WriteAheadLog) Close() error {
+	return wal.file.Close()
+}
+
+// WALReplayError is returned when replaying an update from a write-ahead log
+// does not produce the root that was logged with it.
+type WALReplayError struct {
+	Record WALRecord
+	Root   []byte
+}
+
+func (e *WALReplayError) Error() string {
+	if e.Record.Type == WALBatch {
+		return fmt.Sprintf("replaying batch of %d updates produced root %x, logged root is %x", len(e.Record.Keys), e.Root, e.Record.Root)
+	}
+	return fmt.Sprintf("replaying update of key %x produced root %x, logged root is %x", e.Record.Key, e.Root, e.Record.Root)
+}
@@ -0,0 +1,265 @@
+package smt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestWAL(t *testing.T, path string) *WriteAheadLog {
+	wal, err := OpenWriteAheadLog(path)
+	if err != nil {
+		t.Fatalf("returned error when opening write-ahead log: %v", err)
+	}
+	return wal
+}
+
+func TestWriteAheadLogRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	wal := openTestWAL(t, path)
+	defer wal.Close()
+
+	records := []WALRecord{
+		{Type: WALCheckpoint, Root: []byte("root0"), Orphans: [][]byte{[]byte("a"), []byte("b")}},
+		{Type: WALUpdate, Key: []byte("key"), Value: []byte("value"), Root: []byte("root1")},
+		{Type: WALUpdate, Key: []byte("key"), Value: []byte{}, Root: []byte("root2")},
+		{Type: WALBatch, Keys: [][]byte{[]byte("a"), []byte("b")}, Values: [][]byte{[]byte("1"), {}}, Root: []byte("root3")},
+	}
+	for _, record := range records {
+		if err := wal.Append(record); err != nil {
+			t.Errorf("returned error when appending record: %v", err)
+		}
+	}
+	size, _ := wal.Size()
+
+	// Simulate a crash while appending a record.
+	torn := (&WALRecord{Type: WALUpdate, Key: []byte("key"), Value: []byte("torn"), Root: []byte("root4")}).marshal()
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write(torn[:len(torn)-1])
+	f.Close()
+
+	read, err := wal.Records()
+	if err != nil {
+		t.Errorf("returned error when reading records: %v", err)
+	}
+	if len(read) != len(records) {
+		t.Fatalf("expected %d records, got: %d", len(records), len(read))
+	}
+	for i := range records {
+		if read[i].Type != records[i].Type || !bytes.Equal(read[i].Key, records[i].Key) ||
+			!bytes.Equal(read[i].Value, records[i].Value) || !bytes.Equal(read[i].Root, records[i].Root) ||
+			len(read[i].Orphans) != len(records[i].Orphans) || len(read[i].Keys) != len(records[i].Keys) {
+			t.Errorf("record %d was not read back correctly", i)
+		}
+	}
+	if newSize, _ := wal.Size(); newSize != size {
+		t.Errorf("torn record was not truncated, expected size %d, got: %d", size, newSize)
+	}
+
+	// Corrupt the checksummed payload of the last record.
+	data, _ := os.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(path, data, 0o644)
+	read, err = wal.Records()
+	if err != nil {
+		t.Errorf("returned error when reading records: %v", err)
+	}
+	if len(read) != len(records)-1 {
+		t.Errorf("corrupt record was not discarded, got %d records", len(read))
+	}
+}
+
+// Test that a logged tree recovers its root after being reopened.
+func TestLoggedSparseMerkleTreeRecovery(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	smn, smv := NewSimpleMap(), NewSimpleMap()
+	lsmt, err := OpenLoggedSparseMerkleTree(smn, smv, sha256.New(), openTestWAL(t, path))
+	if err != nil {
+		t.Fatalf("returned error when opening logged tree: %v", err)
+	}
+	lsmt.Update([]byte("testKey1"), []byte("testValue1"))
+	lsmt.Update([]byte("testKey2"), []byte("testValue2"))
+	lsmt.Update([]byte("testKey1"), []byte("testValue3"))
+	lsmt.Delete([]byte("testKey2"))
+	root := lsmt.Root()
+	lsmt.wal.Close()
+
+	reopened, err := OpenLoggedSparseMerkleTree(smn, smv, sha256.New(), openTestWAL(t, path))
+	if err != nil {
+		t.Fatalf("returned error when reopening logged tree: %v", err)
+	}
+	defer reopened.wal.Close()
+	if !bytes.Equal(reopened.Root(), root) {
+		t.Error("reopened tree does not have the last committed root")
+	}
+	value, err := reopened.Get([]byte("testKey1"))
+	if err != nil {
+		t.Errorf("returned error when getting key: %v", err)
+	}
+	if !bytes.Equal(value, []byte("testValue3")) {
+		t.Error("did not get correct value after reopening")
+	}
+
+	// Simulate a crash after an update was logged, but before it was applied.
+	expected := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+	expected.Update([]byte("testKey1"), []byte("testValue3"))
+	expected.Update([]byte("testKey4"), []byte("testValue4"))
+	reopened.wal.Append(WALRecord{Type: WALUpdate, Key: []byte("testKey4"), Value: []byte("testValue4"), Root: expected.Root()})
+	reopened.wal.Close()
+
+	recovered, err := OpenLoggedSparseMerkleTree(smn, smv, sha256.New(), openTestWAL(t, path))
+	if err != nil {
+		t.Fatalf("returned error when recovering logged tree: %v", err)
+	}
+	defer recovered.wal.Close()
+	if !bytes.Equal(recovered.Root(), expected.Root()) {
+		t.Error("recovered tree does not include the logged update")
+	}
+	proof, err := recovered.Prove([]byte("testKey4"))
+	if err != nil {
+		t.Errorf("returned error when proving key: %v", err)
+	}
+	if !VerifyProof(proof, recovered.Root(), []byte("testKey4"), []byte("testValue4"), sha256.New()) {
+		t.Error("valid proof failed to verify after recovery")
+	}
+
+	// Replaying an update that does not produce the logged root must fail.
+	recovered.wal.Append(WALRecord{Type: WALUpdate, Key: []byte("testKey5"), Value: []byte("testValue5"), Root: root})
+	recovered.wal.Close()
+	_, err = OpenLoggedSparseMerkleTree(smn, smv, sha256.New(), openTestWAL(t, path))
+	var replayError *WALReplayError
+	if !errors.As(err, &replayError) {
+		t.Errorf("did not return WALReplayError for a mismatched root: %v", err)
+	}
+}
+
+// Test that the updates of a batch are logged and recovered.
+func TestLoggedSparseMerkleTreeUpdateBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	smn, smv := NewSimpleMap(), NewSimpleMap()
+	lsmt, err := OpenLoggedSparseMerkleTree(smn, smv, sha256.New(), openTestWAL(t, path))
+	if err != nil {
+		t.Fatalf("returned error when opening logged tree: %v", err)
+	}
+	lsmt.Update([]byte("testKey1"), []byte("testValue1"))
+	keys := [][]byte{[]byte("testKey2"), []byte("testKey1"), []byte("testKey3"), []byte("testKey2")}
+	values := [][]byte{[]byte("testValue2"), defaultValue, []byte("testValue3"), []byte("testValue4")}
+	root, err := lsmt.UpdateBatch(keys, values)
+	if err != nil {
+		t.Fatalf("returned error when updating batch: %v", err)
+	}
+
+	expected := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+	expected.Update([]byte("testKey1"), []byte("testValue1"))
+	for i := range keys {
+		expected.Update(keys[i], values[i])
+	}
+	if !bytes.Equal(root, expected.Root()) || !bytes.Equal(lsmt.Root(), root) {
+		t.Errorf("got root %x after batch, want %x", root, expected.Root())
+	}
+	records, _ := lsmt.wal.Records()
+	if len(records) != 2 || records[1].Type != WALBatch {
+		t.Errorf("got %d records in the log, want the update and a single batch record", len(records))
+	}
+	lsmt.wal.Close()
+
+	reopened, err := OpenLoggedSparseMerkleTree(smn, smv, sha256.New(), openTestWAL(t, path))
+	if err != nil {
+		t.Fatalf("returned error when reopening logged tree: %v", err)
+	}
+	if !bytes.Equal(reopened.Root(), root) {
+		t.Error("reopened tree does not have the root of the batch")
+	}
+	value, err := reopened.Get([]byte("testKey2"))
+	if err != nil {
+		t.Errorf("returned error when getting key: %v", err)
+	}
+	if !bytes.Equal(value, []byte("testValue4")) {
+		t.Error("did not get correct value after reopening")
+	}
+
+	// A failing batch is not logged and leaves the tree unchanged.
+	if _, err := reopened.UpdateBatch(keys, values[1:]); err == nil {
+		t.Error("no error for batch with missing values")
+	}
+	records, _ = reopened.wal.Records()
+	if len(records) != 2 || !bytes.Equal(reopened.Root(), root) {
+		t.Error("failing batch modified the tree or the log")
+	}
+
+	// A batch torn while being logged, before any of it was applied, is
+	// discarded whole when the log is replayed.
+	torn := (&WALRecord{Type: WALBatch, Keys: keys, Values: values, Root: []byte("root")}).marshal()
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write(torn[:len(torn)-1])
+	f.Close()
+	reopened.wal.Close()
+	recovered, err := OpenLoggedSparseMerkleTree(smn, smv, sha256.New(), openTestWAL(t, path))
+	if err != nil {
+		t.Fatalf("returned error when recovering logged tree: %v", err)
+	}
+	defer recovered.wal.Close()
+	if !bytes.Equal(recovered.Root(), root) {
+		t.Error("torn batch was partly replayed")
+	}
+}
+
+// Test that checkpoints remove orphans and truncate the log.
+func TestLoggedSparseMerkleTreeCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wal")
+	smn, smv := NewSimpleMap(), NewSimpleMap()
+	lsmt, err := OpenLoggedSparseMerkleTree(smn, smv, sha256.New(), openTestWAL(t, path))
+	if err != nil {
+		t.Fatalf("returned error when opening logged tree: %v", err)
+	}
+	lsmt.Update([]byte("testKey1"), []byte("testValue1"))
+	lsmt.Update([]byte("testKey2"), []byte("testValue2"))
+	lsmt.Update([]byte("testKey1"), []byte("testValue1"))
+	lsmt.Update([]byte("testKey2"), []byte("testValue3"))
+	lsmt.Update([]byte("testKey3"), []byte("testValue3"))
+	lsmt.Delete([]byte("testKey3"))
+
+	reference := NewSparseMerkleTree(NewSimpleMap(), NewSimpleMap(), sha256.New())
+	reference.Update([]byte("testKey1"), []byte("testValue1"))
+	reference.Update([]byte("testKey2"), []byte("testValue3"))
+	if !bytes.Equal(lsmt.Root(), reference.Root()) {
+		t.Error("logged tree root differs from an unlogged tree")
+	}
+	if len(smn.m) <= 3 {
+		t.Error("orphans were removed before checkpointing")
+	}
+
+	if err = lsmt.Checkpoint(); err != nil {
+		t.Errorf("returned error when checkpointing: %v", err)
+	}
+	if len(smn.m) != 3 {
+		t.Errorf("expected 3 nodes after checkpointing, got: %d", len(smn.m))
+	}
+	records, _ := lsmt.wal.Records()
+	if len(records) != 1 || records[0].Type != WALCheckpoint || !bytes.Equal(records[0].Root, lsmt.Root()) {
+		t.Error("log was not truncated to a checkpoint record")
+	}
+
+	// Simulate a crash in the middle of a checkpoint.
+	lsmt.Update([]byte("testKey1"), []byte("testValue4"))
+	lsmt.wal.Append(WALRecord{Type: WALCheckpoint, Root: lsmt.Root(), Orphans: [][]byte{reference.Root()}})
+	lsmt.wal.Close()
+	recovered, err := OpenLoggedSparseMerkleTree(smn, smv, sha256.New(), openTestWAL(t, path))
+	if err != nil {
+		t.Fatalf("returned error when recovering logged tree: %v", err)
+	}
+	defer recovered.wal.Close()
+	if _, err = smn.Get(reference.Root()); err == nil {
+		t.Error("orphans of an interrupted checkpoint were not removed")
+	}
+	value, err := recovered.GetDescend([]byte("testKey1"))
+	if err != nil {
+		t.Errorf("returned error when descending tree: %v", err)
+	}
+	if !bytes.Equal(value, []byte("testValue4")) {
+		t.Error("did not get correct value after recovering from an interrupted checkpoint")
+	}
+}
@@ -0,0 +1,266 @@
+package smt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+// LoggedSparseMerkleTree is a Sparse Merkle tree that records every update in
+// a WriteAheadLog before applying it to its MapStores, so that the last
+// committed root can be recovered after a crash.
+//
+// Orphaned nodes are not removed from the node store when an update is
+// applied, but when the tree is checkpointed. Until then, every node needed to
+// replay the log is left in place, which makes replaying an update that was
+// only partly applied to the stores safe. This requires Set on the node store
+// to be idempotent, so the node store must not be a RefCountedMapStore. The
+// tree is only updated through Update, Delete and UpdateBatch, which are all
+// logged.
+type LoggedSparseMerkleTree struct {
+	smt     *SparseMerkleTree
+	wal     *WriteAheadLog
+	orphans map[string]struct{}
+}
+
+// OpenLoggedSparseMerkleTree opens a Sparse Merkle tree whose stores contain
+// every change up to the last checkpoint in wal, and replays the updates
+// logged since to reconstruct the last committed root.
+func OpenLoggedSparseMerkleTree(nodes, values MapStore, hasher hash.Hash, wal *WriteAheadLog, options ...Option) (*LoggedSparseMerkleTree, error) {
+	lsmt := &LoggedSparseMerkleTree{
+		smt:     NewSparseMerkleTree(nodes, values, hasher, options...),
+		wal:     wal,
+		orphans: make(map[string]struct{}),
+	}
+
+	records, err := wal.Records()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		switch record.Type {
+		case WALCheckpoint:
+			if err := lsmt.removeOrphans(record.Orphans); err != nil {
+				return nil, err
+			}
+			lsmt.smt.SetRoot(record.Root)
+		case WALUpdate, WALBatch:
+			root, err := lsmt.apply(&record, true)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(root, record.Root) {
+				return nil, &WALReplayError{Record: record, Root: root}
+			}
+			lsmt.smt.SetRoot(root)
+		}
+	}
+
+	return lsmt, nil
+}
+
+// Root gets the root of the tree.
+func (lsmt *LoggedSparseMerkleTree) Root() []byte {
+	return lsmt.smt.Root()
+}
+
+// HasherID returns the registry identifier of the hash function of the tree,
+// or HasherUnknown if it is not in the registry.
+func (lsmt *LoggedSparseMerkleTree) HasherID() HasherID {
+	return lsmt.smt.HasherID()
+}
+
+// KeysArePaths returns whether the tree uses its keys as paths, with the
+// RawKeys option.
+func (lsmt *LoggedSparseMerkleTree) KeysArePaths() bool {
+	return lsmt.smt.KeysArePaths()
+}
+
+// Version returns the number of commits made to the tree. It is only tracked
+// for trees created with the PersistRoot option.
+func (lsmt *LoggedSparseMerkleTree) Version() uint64 {
+	return lsmt.smt.Version()
+}
+
+// Get gets the value of a key from the tree.
+func (lsmt *LoggedSparseMerkleTree) Get(key []byte) ([]byte, error) {
+	return lsmt.smt.Get(key)
+}
+
+// Has returns true if the value at the given key is non-default, false
+// otherwise.
+func (lsmt *LoggedSparseMerkleTree) Has(key []byte) (bool, error) {
+	return lsmt.smt.Has(key)
+}
+
+// GetDescend gets the value of a key from the tree by descending it.
+func (lsmt *LoggedSparseMerkleTree) GetDescend(key []byte) ([]byte, error) {
+	return lsmt.smt.GetDescend(key)
+}
+
+// HasDescend returns true if the value at the given key is non-default, false
+// otherwise, by descending the tree.
+func (lsmt *LoggedSparseMerkleTree) HasDescend(key []byte) (bool, error) {
+	return lsmt.smt.HasDescend(key)
+}
+
+// Prove generates a Merkle proof for a key against the current root.
+func (lsmt *LoggedSparseMerkleTree) Prove(key []byte) (SparseMerkleProof, error) {
+	return lsmt.smt.Prove(key)
+}
+
+// ProveUpdatable generates an updatable Merkle proof for a key against the
+// current root.
+func (lsmt *LoggedSparseMerkleTree) ProveUpdatable(key []byte) (SparseMerkleProof, error) {
+	return lsmt.smt.ProveUpdatable(key)
+}
+
+// ProveCompact generates a compacted Merkle proof for a key against the
+// current root.
+func (lsmt *LoggedSparseMerkleTree) ProveCompact(key []byte) (SparseCompactMerkleProof, error) {
+	return lsmt.smt.ProveCompact(key)
+}
+
+// IterateLeaves calls fn with the path and the value of every leaf of the tree
+// at its current root. See SparseMerkleTree.IterateLeaves.
+func (lsmt *LoggedSparseMerkleTree) IterateLeaves(fn func(path, value []byte) error) error {
+	return lsmt.smt.IterateLeaves(fn)
+}
+
+// Update sets a new value for a key in the tree, and sets and returns the new
+// root of the tree. The update is logged before the stores are modified.
+func (lsmt *LoggedSparseMerkleTree) Update(key []byte, value []byte) ([]byte, error) {
+	return lsmt.commit(&WALRecord{Type: WALUpdate, Key: key, Value: value})
+}
+
+// Delete deletes a value from tree. It returns the new root of the tree.
+func (lsmt *LoggedSparseMerkleTree) Delete(key []byte) ([]byte, error) {
+	return lsmt.Update(key, defaultValue)
+}
+
+// UpdateBatch sets new values for several keys in the tree, as with the
+// UpdateBatch of SparseMerkleTree, and sets and returns the new root of the
+// tree. The batch is logged as a single record before the stores are
+// modified, so that it is either replayed whole or not at all.
+func (lsmt *LoggedSparseMerkleTree) UpdateBatch(keys [][]byte, values [][]byte) ([]byte, error) {
+	if len(keys) != len(values) {
+		return nil, fmt.Errorf("got %d keys and %d values", len(keys), len(values))
+	}
+	return lsmt.commit(&WALRecord{Type: WALBatch, Keys: keys, Values: values})
+}
+
+// commit applies and logs the updates of a record, and sets the new root.
+func (lsmt *LoggedSparseMerkleTree) commit(record *WALRecord) ([]byte, error) {
+	newRoot, err := lsmt.apply(record, false)
+	if err != nil {
+		return nil, err
+	}
+	lsmt.smt.SetRoot(newRoot)
+	if lsmt.smt.persistRoot {
+		if err := lsmt.smt.CommitRoot(); err != nil {
+			return nil, err
+		}
+	}
+	return newRoot, nil
+}
+
+// Checkpoint removes the nodes orphaned since the last checkpoint and
+// truncates the log to a single checkpoint record of the current root.
+//
+// Checkpoint must only be called once the node and value stores have durably
+// persisted every change made to them so far.
+func (lsmt *LoggedSparseMerkleTree) Checkpoint() error {
+	orphans := make([][]byte, 0, len(lsmt.orphans))
+	for k := range lsmt.orphans {
+		orphans = append(orphans, []byte(k))
+	}
+
+	// Log the orphans first, so that an interrupted checkpoint is completed
+	// when the log is replayed.
+	if err := lsmt.wal.Append(WALRecord{Type: WALCheckpoint, Root: lsmt.Root(), Orphans: orphans}); err != nil {
+		return err
+	}
+	if err := lsmt.removeOrphans(orphans); err != nil {
+		return err
+	}
+	return lsmt.wal.reset(WALRecord{Type: WALCheckpoint, Root: lsmt.Root()})
+}
+
+// apply computes the result of the updates of a record on overlays of the
+// stores, logs the record with the new root unless it is being replayed from
+// the log, and then applies the updates to the stores.
+func (lsmt *LoggedSparseMerkleTree) apply(record *WALRecord, replay bool) ([]byte, error) {
+	nodes, valueStore := NewOverlayMapStore(lsmt.smt.nodes), NewOverlayMapStore(lsmt.smt.values)
+	staged := *lsmt.smt
+	staged.nodes = nodes
+	staged.values = valueStore
+	if replay {
+		// The value changes of the updates being replayed may already have
+		// been applied.
+		staged.values = lenientDeleteMapStore{valueStore}
+	}
+
+	newRoot := lsmt.Root()
+	keys, values := record.updates()
+	for i := range keys {
+		var err error
+		if newRoot, err = staged.UpdateForRoot(keys[i], values[i], newRoot); err != nil {
+			return nil, err
+		}
+	}
+	if !replay {
+		logged := *record
+		logged.Root = newRoot
+		if err := lsmt.wal.Append(logged); err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range nodes.writes {
+		if _, ok := lsmt.orphans[k]; ok {
+			// The node was orphaned by an earlier update and is still in
+			// the store; it is simply no longer an orphan.
+			delete(lsmt.orphans, k)
+			continue
+		}
+		if err := lsmt.smt.nodes.Set([]byte(k), v); err != nil {
+			return nil, err
+		}
+	}
+	for k := range nodes.tombstones {
+		lsmt.orphans[k] = struct{}{}
+	}
+	if err := valueStore.Flush(); err != nil {
+		return nil, err
+	}
+
+	return newRoot, nil
+}
+
+func (lsmt *LoggedSparseMerkleTree) removeOrphans(orphans [][]byte) error {
+	nodes := lenientDeleteMapStore{lsmt.smt.nodes}
+	for _, orphan := range orphans {
+		if err := nodes.Delete(orphan); err != nil {
+			return err
+		}
+		delete(lsmt.orphans, string(orphan))
+	}
+	return nil
+}
+
+// lenientDeleteMapStore is a MapStore that ignores deletions of keys that do
+// not exist.
+type lenientDeleteMapStore struct {
+	MapStore
+}
+
+// Delete deletes a key if it exists.
+func (s lenientDeleteMapStore) Delete(key []byte) error {
+	err := s.MapStore.Delete(key)
+	var invalidKeyError *InvalidKeyError
+	if errors.As(err, &invalidKeyError) {
+		return nil
+	}
+	return err
+}
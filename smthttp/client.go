@@ -0,0 +1,182 @@
+package smthttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"MPT_MOI/smt-master"
+)
+
+// maxResponseSize bounds the size of the responses read by clients.
+const maxResponseSize = 64 << 20
+
+// Error is returned by clients for requests failed by the server.
+type Error struct {
+	// StatusCode is the HTTP status of the response.
+	StatusCode int
+	// Message is the error reported by the server.
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("server returned %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client is a client of a Server.
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+// NewClient returns a client of the server at baseURL, such as
+// "http://localhost:8080", which sends requests with httpClient, or with
+// http.DefaultClient if httpClient is nil.
+func NewClient(baseURL string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), http: httpClient}
+}
+
+// call sends a request to an endpoint, with the JSON encoding of req as body
+// if it is not nil, and decodes the response into resp.
+func (c *Client) call(ctx context.Context, endpoint string, req, resp interface{}) error {
+	method := http.MethodGet
+	var body io.Reader
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		method, body = http.MethodPost, bytes.NewReader(data)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint, body)
+	if err != nil {
+		return err
+	}
+	if req != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+
+	httpResp, err := c.http.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(httpResp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		var errResp ErrorResponse
+		if json.Unmarshal(data, &errResp) != nil || errResp.Error == "" {
+			errResp.Error = strings.TrimSpace(string(data))
+		}
+		return &Error{StatusCode: httpResp.StatusCode, Message: errResp.Error}
+	}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return fmt.Errorf("invalid response from %s: %v", endpoint, err)
+	}
+	return nil
+}
+
+// Root returns the root of the tree, its hash function and its version.
+func (c *Client) Root(ctx context.Context) (*RootResponse, error) {
+	var resp RootResponse
+	if err := c.call(ctx, "/root", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Get returns the value of a key, which is empty if the key is absent.
+func (c *Client) Get(ctx context.Context, key []byte) ([]byte, error) {
+	var resp GetResponse
+	if err := c.call(ctx, "/get", &KeyRequest{Key: key}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Value, nil
+}
+
+// GetBatch returns the values of several keys, in the order of the keys.
+func (c *Client) GetBatch(ctx context.Context, keys [][]byte) ([][]byte, error) {
+	var resp BatchGetResponse
+	if err := c.call(ctx, "/batch-get", &BatchGetRequest{Keys: toBytes(keys)}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Values) != len(keys) {
+		return nil, fmt.Errorf("invalid response from /batch-get: got %d values for %d keys", len(resp.Values), len(keys))
+	}
+	return fromBytes(resp.Values), nil
+}
+
+// Update sets the value of a key, and returns the new root of the tree.
+func (c *Client) Update(ctx context.Context, key, value []byte) ([]byte, error) {
+	var resp RootResponse
+	if err := c.call(ctx, "/update", &UpdateRequest{Key: key, Value: value}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Root, nil
+}
+
+// Delete deletes a key, and returns the new root of the tree.
+func (c *Client) Delete(ctx context.Context, key []byte) ([]byte, error) {
+	var resp RootResponse
+	if err := c.call(ctx, "/delete", &KeyRequest{Key: key}, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Root, nil
+}
+
+// Prove returns the value of a key, the root of the tree and a proof for the
+// key against the root. The proof is not verified.
+func (c *Client) Prove(ctx context.Context, key []byte) (*ProveResponse, error) {
+	var resp ProveResponse
+	if err := c.call(ctx, "/prove", &KeyRequest{Key: key}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Proof == nil {
+		return nil, fmt.Errorf("invalid response from /prove: no proof")
+	}
+	return &resp, nil
+}
+
+// ProveCompact returns the value of a key, the root of the tree and a compact
+// proof for the key against the root. The proof is not verified.
+func (c *Client) ProveCompact(ctx context.Context, key []byte) (*ProveCompactResponse, error) {
+	var resp ProveCompactResponse
+	if err := c.call(ctx, "/prove-compact", &KeyRequest{Key: key}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Proof == nil {
+		return nil, fmt.Errorf("invalid response from /prove-compact: no proof")
+	}
+	return &resp, nil
+}
+
+// Verify asks the server to verify a proof for a key and a value, with an
+// empty value for non-membership, against root, or against the current root
+// of the tree if root is empty.
+func (c *Client) Verify(ctx context.Context, key, value, root []byte, proof smt.SparseMerkleProof) (bool, error) {
+	var resp VerifyResponse
+	req := &VerifyRequest{Key: key, Value: value, Root: root, Proof: NewProof(proof)}
+	if err := c.call(ctx, "/verify", req, &resp); err != nil {
+		return false, err
+	}
+	return resp.Valid, nil
+}
+
+// VerifyCompact is Verify for a compact proof.
+func (c *Client) VerifyCompact(ctx context.Context, key, value, root []byte, proof smt.SparseCompactMerkleProof) (bool, error) {
+	var resp VerifyResponse
+	req := &VerifyRequest{Key: key, Value: value, Root: root, CompactProof: NewCompactProof(proof)}
+	if err := c.call(ctx, "/verify", req, &resp); err != nil {
+		return false, err
+	}
+	return resp.Valid, nil
+}
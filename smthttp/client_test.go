@@ -0,0 +1,75 @@
+package smthttp
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"MPT_MOI/smt-master"
+)
+
+func TestClient(t *testing.T) {
+	tree, s := newTestServer()
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	c := NewClient(ts.URL+"/", nil)
+	ctx := context.Background()
+
+	root, err := c.Update(ctx, []byte("baz"), []byte("qux"))
+	if err != nil || !bytes.Equal(root, tree.Root()) {
+		t.Fatalf("got root %x from update, want %x: %v", root, tree.Root(), err)
+	}
+	if resp, err := c.Root(ctx); err != nil || !bytes.Equal(resp.Root, root) || resp.HasherID != smt.SHA256 {
+		t.Errorf("got root %+v, want %x: %v", resp, root, err)
+	}
+	if value, err := c.Get(ctx, []byte("foo")); err != nil || string(value) != "bar" {
+		t.Errorf("got value %q, want bar: %v", value, err)
+	}
+	values, err := c.GetBatch(ctx, [][]byte{[]byte("baz"), []byte("absent"), []byte("foo")})
+	if err != nil || len(values) != 3 || string(values[0]) != "qux" || len(values[1]) != 0 || string(values[2]) != "bar" {
+		t.Errorf("got values %q from batch get: %v", values, err)
+	}
+
+	for _, key := range []string{"foo", "absent"} {
+		resp, err := c.Prove(ctx, []byte(key))
+		if err != nil {
+			t.Fatalf("prove returned error: %v", err)
+		}
+		proof := resp.Proof.SparseMerkleProof()
+		if !smt.VerifyProof(proof, root, []byte(key), resp.Value, sha256.New()) {
+			t.Errorf("proof for %q does not verify", key)
+		}
+		if valid, err := c.Verify(ctx, []byte(key), resp.Value, nil, proof); err != nil || !valid {
+			t.Errorf("server did not verify the proof for %q: %v", key, err)
+		}
+
+		compactResp, err := c.ProveCompact(ctx, []byte(key))
+		if err != nil {
+			t.Fatalf("prove-compact returned error: %v", err)
+		}
+		compactProof := compactResp.Proof.SparseCompactMerkleProof()
+		if !smt.VerifyCompactProof(compactProof, compactResp.Root, []byte(key), compactResp.Value, sha256.New()) {
+			t.Errorf("compact proof for %q does not verify", key)
+		}
+		if valid, err := c.VerifyCompact(ctx, []byte(key), []byte("wrong"), root, compactProof); err != nil || valid {
+			t.Errorf("server verified the compact proof for %q with a wrong value: %v", key, err)
+		}
+	}
+
+	root, err = c.Delete(ctx, []byte("baz"))
+	if err != nil || !bytes.Equal(root, tree.Root()) {
+		t.Errorf("got root %x from delete, want %x: %v", root, tree.Root(), err)
+	}
+
+	ro := httptest.NewServer(NewServer(tree, ReadOnly()))
+	defer ro.Close()
+	_, err = NewClient(ro.URL, nil).Update(ctx, []byte("foo"), []byte("baz"))
+	var serverErr *Error
+	if !errors.As(err, &serverErr) || serverErr.StatusCode != http.StatusForbidden || serverErr.Message != "tree is read-only" {
+		t.Errorf("got error %v from a read-only server, want status 403", err)
+	}
+}
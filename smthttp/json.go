@@ -0,0 +1,188 @@
+package smthttp
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"MPT_MOI/smt-master"
+)
+
+// Bytes is a byte slice encoded in JSON as a hex string. A 0x prefix is
+// accepted when decoding.
+type Bytes []byte
+
+// MarshalJSON encodes b as a hex string.
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes a hex string.
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	decoded, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// Proof is the JSON encoding of a SparseMerkleProof.
+type Proof struct {
+	SideNodes             []Bytes      `json:"sideNodes"`
+	NonMembershipLeafData Bytes        `json:"nonMembershipLeafData,omitempty"`
+	SiblingData           Bytes        `json:"siblingData,omitempty"`
+	HasherID              smt.HasherID `json:"hasherId"`
+}
+
+// NewProof returns the JSON encoding of a proof.
+func NewProof(proof smt.SparseMerkleProof) *Proof {
+	return &Proof{
+		SideNodes:             toBytes(proof.SideNodes),
+		NonMembershipLeafData: proof.NonMembershipLeafData,
+		SiblingData:           proof.SiblingData,
+		HasherID:              proof.HasherID,
+	}
+}
+
+// SparseMerkleProof returns the decoded proof.
+func (p *Proof) SparseMerkleProof() smt.SparseMerkleProof {
+	return smt.SparseMerkleProof{
+		SideNodes:             fromBytes(p.SideNodes),
+		NonMembershipLeafData: p.NonMembershipLeafData,
+		SiblingData:           p.SiblingData,
+		HasherID:              p.HasherID,
+	}
+}
+
+// CompactProof is the JSON encoding of a SparseCompactMerkleProof.
+type CompactProof struct {
+	SideNodes             []Bytes      `json:"sideNodes"`
+	NonMembershipLeafData Bytes        `json:"nonMembershipLeafData,omitempty"`
+	BitMask               Bytes        `json:"bitMask"`
+	NumSideNodes          int          `json:"numSideNodes"`
+	SiblingData           Bytes        `json:"siblingData,omitempty"`
+	HasherID              smt.HasherID `json:"hasherId"`
+}
+
+// NewCompactProof returns the JSON encoding of a compact proof.
+func NewCompactProof(proof smt.SparseCompactMerkleProof) *CompactProof {
+	return &CompactProof{
+		SideNodes:             toBytes(proof.SideNodes),
+		NonMembershipLeafData: proof.NonMembershipLeafData,
+		BitMask:               proof.BitMask,
+		NumSideNodes:          proof.NumSideNodes,
+		SiblingData:           proof.SiblingData,
+		HasherID:              proof.HasherID,
+	}
+}
+
+// SparseCompactMerkleProof returns the decoded proof.
+func (p *CompactProof) SparseCompactMerkleProof() smt.SparseCompactMerkleProof {
+	return smt.SparseCompactMerkleProof{
+		SideNodes:             fromBytes(p.SideNodes),
+		NonMembershipLeafData: p.NonMembershipLeafData,
+		BitMask:               p.BitMask,
+		NumSideNodes:          p.NumSideNodes,
+		SiblingData:           p.SiblingData,
+		HasherID:              p.HasherID,
+	}
+}
+
+func toBytes(items [][]byte) []Bytes {
+	converted := make([]Bytes, len(items))
+	for i, item := range items {
+		converted[i] = item
+	}
+	return converted
+}
+
+func fromBytes(items []Bytes) [][]byte {
+	converted := make([][]byte, len(items))
+	for i, item := range items {
+		converted[i] = item
+	}
+	return converted
+}
+
+// The bodies of the requests and responses of the endpoints. Values are empty
+// for absent keys.
+type (
+	// KeyRequest is the request of /get, /delete, /prove and /prove-compact.
+	KeyRequest struct {
+		Key Bytes `json:"key"`
+	}
+
+	// BatchGetRequest is the request of /batch-get.
+	BatchGetRequest struct {
+		Keys []Bytes `json:"keys"`
+	}
+
+	// UpdateRequest is the request of /update.
+	UpdateRequest struct {
+		Key   Bytes `json:"key"`
+		Value Bytes `json:"value"`
+	}
+
+	// VerifyRequest is the request of /verify, with either a proof or a
+	// compact proof. Proofs are verified against the current root if Root is
+	// empty.
+	VerifyRequest struct {
+		Key          Bytes         `json:"key"`
+		Value        Bytes         `json:"value"`
+		Root         Bytes         `json:"root,omitempty"`
+		Proof        *Proof        `json:"proof,omitempty"`
+		CompactProof *CompactProof `json:"compactProof,omitempty"`
+	}
+
+	// RootResponse is the response of /root, /update and /delete.
+	RootResponse struct {
+		Root     Bytes        `json:"root"`
+		HasherID smt.HasherID `json:"hasherId"`
+		Version  uint64       `json:"version"`
+	}
+
+	// GetResponse is the response of /get.
+	GetResponse struct {
+		Key   Bytes `json:"key"`
+		Value Bytes `json:"value"`
+		Root  Bytes `json:"root"`
+	}
+
+	// BatchGetResponse is the response of /batch-get, with the values in the
+	// order of the keys of the request.
+	BatchGetResponse struct {
+		Values []Bytes `json:"values"`
+		Root   Bytes   `json:"root"`
+	}
+
+	// ProveResponse is the response of /prove.
+	ProveResponse struct {
+		Key   Bytes  `json:"key"`
+		Value Bytes  `json:"value"`
+		Root  Bytes  `json:"root"`
+		Proof *Proof `json:"proof"`
+	}
+
+	// ProveCompactResponse is the response of /prove-compact.
+	ProveCompactResponse struct {
+		Key   Bytes         `json:"key"`
+		Value Bytes         `json:"value"`
+		Root  Bytes         `json:"root"`
+		Proof *CompactProof `json:"proof"`
+	}
+
+	// VerifyResponse is the response of /verify.
+	VerifyResponse struct {
+		Valid bool `json:"valid"`
+	}
+
+	// ErrorResponse is the response of failed requests.
+	ErrorResponse struct {
+		Error string `json:"error"`
+	}
+)
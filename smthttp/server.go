@@ -0,0 +1,300 @@
+// Package smthttp serves a SparseMerkleTree over HTTP with JSON requests and
+// responses, and provides a client for it.
+//
+// The server has the endpoints:
+//
+//	GET  /root           the root of the tree
+//	POST /get            the value of a key
+//	POST /batch-get      the values of several keys
+//	POST /update         set the value of a key
+//	POST /delete         delete a key
+//	POST /prove          a proof for a key
+//	POST /prove-compact  a compact proof for a key
+//	POST /verify         verify a proof for a key
+//
+// Keys, values, roots and the fields of proofs are hex strings. Values are
+// empty for absent keys. Failed requests have a non-2xx status and an
+// ErrorResponse body.
+package smthttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"MPT_MOI/smt-master"
+)
+
+const (
+	// DefaultMaxBodySize is the default size limit of request bodies.
+	DefaultMaxBodySize = 1 << 20
+	// DefaultMaxBatchSize is the default limit of keys per batch get.
+	DefaultMaxBatchSize = 1000
+)
+
+// errTooLarge is returned for request bodies larger than the size limit.
+var errTooLarge = errors.New("request body too large")
+
+// Server is an http.Handler serving a tree. Requests are serialized, as trees
+// are not safe for concurrent use.
+type Server struct {
+	mu   sync.Mutex
+	tree *smt.SparseMerkleTree
+	mux  *http.ServeMux
+
+	readOnly     bool
+	maxBodySize  int64
+	maxBatchSize int
+}
+
+// ServerOption is an option of a Server.
+type ServerOption func(*Server)
+
+// ReadOnly rejects updates and deletes with 403 Forbidden.
+func ReadOnly() ServerOption {
+	return func(s *Server) {
+		s.readOnly = true
+	}
+}
+
+// MaxBodySize sets the size limit of request bodies, beyond which requests are
+// rejected with 413 Request Entity Too Large.
+func MaxBodySize(size int64) ServerOption {
+	return func(s *Server) {
+		s.maxBodySize = size
+	}
+}
+
+// MaxBatchSize sets the limit of keys per batch get, beyond which requests are
+// rejected with 413 Request Entity Too Large.
+func MaxBatchSize(size int) ServerOption {
+	return func(s *Server) {
+		s.maxBatchSize = size
+	}
+}
+
+// NewServer returns a server of a tree. The tree must not be used elsewhere
+// while it is served.
+func NewServer(tree *smt.SparseMerkleTree, options ...ServerOption) *Server {
+	s := &Server{
+		tree:         tree,
+		mux:          http.NewServeMux(),
+		maxBodySize:  DefaultMaxBodySize,
+		maxBatchSize: DefaultMaxBatchSize,
+	}
+	for _, option := range options {
+		option(s)
+	}
+
+	s.mux.HandleFunc("/root", s.handle(http.MethodGet, s.root))
+	s.mux.HandleFunc("/get", s.handle(http.MethodPost, s.get))
+	s.mux.HandleFunc("/batch-get", s.handle(http.MethodPost, s.batchGet))
+	s.mux.HandleFunc("/update", s.handle(http.MethodPost, s.update))
+	s.mux.HandleFunc("/delete", s.handle(http.MethodPost, s.delete))
+	s.mux.HandleFunc("/prove", s.handle(http.MethodPost, s.prove))
+	s.mux.HandleFunc("/prove-compact", s.handle(http.MethodPost, s.proveCompact))
+	s.mux.HandleFunc("/verify", s.handle(http.MethodPost, s.verify))
+	return s
+}
+
+// ServeHTTP serves a request.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// httpError is an error with the status of its response.
+type httpError struct {
+	status int
+	err    error
+}
+
+func (e *httpError) Error() string {
+	return e.err.Error()
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{http.StatusBadRequest, fmt.Errorf(format, args...)}
+}
+
+// handle returns a handler of requests with a method, which calls fn with the
+// request body and writes the JSON encoding of its result.
+func (s *Server) handle(method string, fn func(body []byte) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, ErrorResponse{Error: "method not allowed"})
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, s.maxBodySize+1))
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		if int64(len(body)) > s.maxBodySize {
+			writeJSON(w, http.StatusRequestEntityTooLarge, ErrorResponse{Error: errTooLarge.Error()})
+			return
+		}
+
+		s.mu.Lock()
+		result, err := fn(body)
+		s.mu.Unlock()
+
+		if err != nil {
+			status := http.StatusInternalServerError
+			var he *httpError
+			if errors.As(err, &he) {
+				status = he.status
+			}
+			writeJSON(w, status, ErrorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, result)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decode decodes a request body.
+func decode(body []byte, v interface{}) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return badRequest("invalid request: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) rootResponse() *RootResponse {
+	return &RootResponse{Root: s.tree.Root(), HasherID: s.tree.HasherID(), Version: s.tree.Version()}
+}
+
+func (s *Server) root(body []byte) (interface{}, error) {
+	return s.rootResponse(), nil
+}
+
+// treeError returns the error of a tree operation on a key, which is a bad
+// request for keys of the wrong size.
+func treeError(err error) error {
+	if errors.Is(err, smt.ErrBadKeySize) {
+		return &httpError{http.StatusBadRequest, err}
+	}
+	return err
+}
+
+func (s *Server) get(body []byte) (interface{}, error) {
+	var req KeyRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	value, err := s.tree.Get(req.Key)
+	if err != nil {
+		return nil, treeError(err)
+	}
+	return &GetResponse{Key: req.Key, Value: value, Root: s.tree.Root()}, nil
+}
+
+func (s *Server) batchGet(body []byte) (interface{}, error) {
+	var req BatchGetRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	if len(req.Keys) > s.maxBatchSize {
+		return nil, &httpError{http.StatusRequestEntityTooLarge, fmt.Errorf("%d keys in batch, limit is %d", len(req.Keys), s.maxBatchSize)}
+	}
+	resp := &BatchGetResponse{Values: make([]Bytes, len(req.Keys)), Root: s.tree.Root()}
+	for i, key := range req.Keys {
+		value, err := s.tree.Get(key)
+		if err != nil {
+			return nil, treeError(fmt.Errorf("key %d: %w", i, err))
+		}
+		resp.Values[i] = value
+	}
+	return resp, nil
+}
+
+func (s *Server) update(body []byte) (interface{}, error) {
+	if s.readOnly {
+		return nil, &httpError{http.StatusForbidden, errors.New("tree is read-only")}
+	}
+	var req UpdateRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	if len(req.Value) == 0 {
+		return nil, badRequest("empty values cannot be stored; use /delete")
+	}
+	if _, err := s.tree.Update(req.Key, req.Value); err != nil {
+		return nil, treeError(err)
+	}
+	return s.rootResponse(), nil
+}
+
+func (s *Server) delete(body []byte) (interface{}, error) {
+	if s.readOnly {
+		return nil, &httpError{http.StatusForbidden, errors.New("tree is read-only")}
+	}
+	var req KeyRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	if _, err := s.tree.Delete(req.Key); err != nil {
+		return nil, treeError(err)
+	}
+	return s.rootResponse(), nil
+}
+
+func (s *Server) prove(body []byte) (interface{}, error) {
+	var req KeyRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	value, err := s.tree.Get(req.Key)
+	if err != nil {
+		return nil, treeError(err)
+	}
+	proof, err := s.tree.Prove(req.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &ProveResponse{Key: req.Key, Value: value, Root: s.tree.Root(), Proof: NewProof(proof)}, nil
+}
+
+func (s *Server) proveCompact(body []byte) (interface{}, error) {
+	var req KeyRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	value, err := s.tree.Get(req.Key)
+	if err != nil {
+		return nil, treeError(err)
+	}
+	proof, err := s.tree.ProveCompact(req.Key)
+	if err != nil {
+		return nil, err
+	}
+	return &ProveCompactResponse{Key: req.Key, Value: value, Root: s.tree.Root(), Proof: NewCompactProof(proof)}, nil
+}
+
+func (s *Server) verify(body []byte) (interface{}, error) {
+	var req VerifyRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	root := []byte(req.Root)
+	if len(root) == 0 {
+		root = s.tree.Root()
+	}
+	switch {
+	case req.Proof != nil && req.CompactProof == nil:
+		return &VerifyResponse{Valid: s.tree.VerifyProof(req.Proof.SparseMerkleProof(), root, req.Key, req.Value)}, nil
+	case req.CompactProof != nil && req.Proof == nil:
+		return &VerifyResponse{Valid: s.tree.VerifyCompactProof(req.CompactProof.SparseCompactMerkleProof(), root, req.Key, req.Value)}, nil
+	default:
+		return nil, badRequest("invalid request: want one of proof and compactProof")
+	}
+}
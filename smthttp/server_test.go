@@ -0,0 +1,110 @@
+package smthttp
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"MPT_MOI/smt-master"
+)
+
+func newTestServer(options ...ServerOption) (*smt.SparseMerkleTree, *Server) {
+	tree := smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New())
+	tree.Update([]byte("foo"), []byte("bar"))
+	return tree, NewServer(tree, options...)
+}
+
+// serve sends a request to a server and returns the status and body of the
+// response.
+func serve(s *Server, method, target, body string) (int, string) {
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return w.Code, w.Body.String()
+}
+
+func TestServer(t *testing.T) {
+	tree, s := newTestServer()
+
+	status, body := serve(s, http.MethodPost, "/get", `{"key":"666f6f"}`)
+	if status != http.StatusOK || !strings.Contains(body, `"value":"626172"`) {
+		t.Errorf("get: got %d %s", status, body)
+	}
+	status, body = serve(s, http.MethodPost, "/batch-get", `{"keys":["666f6f","0x62617a"]}`)
+	if status != http.StatusOK || !strings.Contains(body, `"values":["626172",""]`) {
+		t.Errorf("batch-get: got %d %s", status, body)
+	}
+
+	status, body = serve(s, http.MethodPost, "/update", `{"key":"62617a","value":"717578"}`)
+	var root RootResponse
+	if err := json.Unmarshal([]byte(body), &root); status != http.StatusOK || err != nil {
+		t.Fatalf("update: got %d %s", status, body)
+	}
+	if string(root.Root) != string(tree.Root()) || root.HasherID != smt.SHA256 {
+		t.Errorf("update: got root %x, want %x", root.Root, tree.Root())
+	}
+	if value, _ := tree.Get([]byte("baz")); string(value) != "qux" {
+		t.Errorf("got value %q after update, want qux", value)
+	}
+
+	status, body = serve(s, http.MethodPost, "/prove", `{"key":"62617a"}`)
+	var proveResp ProveResponse
+	if err := json.Unmarshal([]byte(body), &proveResp); status != http.StatusOK || err != nil {
+		t.Fatalf("prove: got %d %s", status, body)
+	}
+	if !smt.VerifyProof(proveResp.Proof.SparseMerkleProof(), tree.Root(), []byte("baz"), []byte("qux"), sha256.New()) {
+		t.Error("prove: proof does not verify")
+	}
+	proof, _ := json.Marshal(proveResp.Proof)
+	status, body = serve(s, http.MethodPost, "/verify", `{"key":"62617a","value":"717578","proof":`+string(proof)+`}`)
+	if status != http.StatusOK || !strings.Contains(body, `"valid":true`) {
+		t.Errorf("verify: got %d %s", status, body)
+	}
+
+	status, body = serve(s, http.MethodPost, "/delete", `{"key":"62617a"}`)
+	if status != http.StatusOK {
+		t.Errorf("delete: got %d %s", status, body)
+	}
+	if has, _ := tree.Has([]byte("baz")); has {
+		t.Error("key present after delete")
+	}
+
+	status, body = serve(s, http.MethodGet, "/root", "")
+	if status != http.StatusOK || !strings.Contains(body, `"version":0`) {
+		t.Errorf("root: got %d %s", status, body)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	_, s := newTestServer(ReadOnly(), MaxBodySize(64), MaxBatchSize(2))
+	tests := []struct {
+		method, target, body string
+		status               int
+	}{
+		{http.MethodPost, "/update", `{"key":"00","value":"00"}`, http.StatusForbidden},
+		{http.MethodPost, "/delete", `{"key":"666f6f"}`, http.StatusForbidden},
+		{http.MethodGet, "/get", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/root", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/get", `{"key":"zz"}`, http.StatusBadRequest},
+		{http.MethodPost, "/get", `{"key":"` + strings.Repeat("00", 40) + `"}`, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/batch-get", `{"keys":["00","01","02"]}`, http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/verify", `{"key":"00","value":""}`, http.StatusBadRequest},
+		{http.MethodPost, "/unknown", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		if status, body := serve(s, test.method, test.target, test.body); status != test.status {
+			t.Errorf("%s %s %s: got %d %s, want %d", test.method, test.target, test.body, status, body, test.status)
+		}
+	}
+
+	_, s = newTestServer()
+	if status, _ := serve(s, http.MethodPost, "/update", `{"key":"00","value":""}`); status != http.StatusBadRequest {
+		t.Errorf("update with empty value: got %d, want %d", status, http.StatusBadRequest)
+	}
+	tree := smt.NewSparseMerkleTree(smt.NewSimpleMap(), smt.NewSimpleMap(), sha256.New(), smt.RawKeys())
+	if status, _ := serve(NewServer(tree), http.MethodPost, "/get", `{"key":"00"}`); status != http.StatusBadRequest {
+		t.Errorf("get with bad key size: got %d, want %d", status, http.StatusBadRequest)
+	}
+}